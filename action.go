@@ -1,10 +1,14 @@
 package atf
 
 import (
+	"bufio"
+	"context"
 	"encoding/json"
 	"encoding/xml"
 	"fmt"
+	"io"
 	"strings"
+	"time"
 )
 
 // Action represents a single action.
@@ -18,39 +22,107 @@ import (
 type Action struct {
 
 	// Script to be executed
-	Script string
+	Script string `yaml:"script"`
 
 	// Args represents arguments to script (if needed)
-	Args string
+	Args string `yaml:"args"`
 
 	// Result is script execution success
-	Result TestResult `xml:"result,attr"`
+	Result TestResult `xml:"result,attr" yaml:"result"`
 
 	// Output is script execution output text
-	Output string
+	Output string `yaml:"output"`
 
 	// Description text, used mainly for manual actions
-	Description string
+	Description string `yaml:"description"`
 
 	// Executable: is this action executable?
-	Executable bool `xml:"executable,attr"`
+	Executable bool `xml:"executable,attr" yaml:"executable"`
 
 	// Manual: is this action manual?
-	Manual bool `xml:"manual,attr"`
+	Manual bool `xml:"manual,attr" yaml:"manual"`
+
+	// Duration is the time spent executing the action
+	Duration Duration `xml:",omitempty" json:",omitempty" yaml:"duration"`
+
+	// ExitCode is the exit code of the executed script/program
+	ExitCode int `xml:"exitcode,attr,omitempty" json:",omitempty" yaml:"exitcode"`
+
+	// Stdin is a text that is fed to the script/program standard input
+	Stdin string `xml:",omitempty" yaml:"stdin"`
+
+	// Assert is an in-process assertion evaluated instead of executing the script
+	Assert *Assertion `xml:",omitempty" yaml:"assert"`
+
+	// Classpath is a Java classpath used when the main class is defined
+	Classpath string `xml:",omitempty" yaml:"classpath"`
+
+	// MainClass is a Java class executed instead of the script (using the classpath)
+	MainClass string `xml:",omitempty" yaml:"mainclass"`
+
+	// Remote defines the remote host where the script (with arguments) is executed as a command; if not defined
+	// (default), the script is executed locally
+	Remote *SSHConfig `xml:",omitempty" json:",omitempty" yaml:"remote,omitempty"`
+}
+
+// ManualPromptFn is a callback that asks the operator to perform the manual action and returns the operator's verdict.
+type ManualPromptFn func(a *Action) (TestResult, error)
+
+// NewConsolePrompt creates a ManualPromptFn that displays the manual action description to the given writer and reads the
+// operator's verdict (Pass or Fail) from the given reader; the question is repeated until valid answer is given.
+func NewConsolePrompt(r io.Reader, w io.Writer) ManualPromptFn {
+
+	in := bufio.NewScanner(r)
+	return func(a *Action) (TestResult, error) {
+
+		fmt.Fprintf(w, "Manual action:\n%s\n", a.Description)
+		for {
+			fmt.Fprint(w, "Result [Pass/Fail]: ")
+			if !in.Scan() {
+				if err := in.Err(); err != nil {
+					return "", err
+				}
+				return "", io.ErrUnexpectedEOF
+			}
+			res, err := ParseTestResult(strings.TrimSpace(in.Text()))
+			if err == nil && (res == "Pass" || res == "Fail") {
+				return res, nil
+			}
+			fmt.Fprintln(w, "Please enter either Pass or Fail.")
+		}
+	}
 }
 
 // String returns a human-readable represenation of the Action instance.
 func (a *Action) String() string {
 
-	if a.Manual {
+	if a.IsManual() {
 		return fmt.Sprintf("Manual Action:\n%s", a.Description)
-	} else if a.Executable {
+	} else if a.IsExecutable() {
+		if a.Assert != nil {
+			return fmt.Sprintln(a.Assert.String())
+		}
+		if a.MainClass != "" {
+			return fmt.Sprintf("%s %s\n", a.MainClass, a.Args)
+		}
+		if a.Remote != nil {
+			return fmt.Sprintf("%s: %s %s\n", a.Remote.String(), a.Script, a.Args)
+		}
 		s := fmt.Sprintf("%s %s\n", a.Script, a.Args)
 		return s
 	} // if isexecutable
 	return fmt.Sprint(a.Script, " ", a.Args)
 }
 
+// IsExecutable returns true for automated (executable) action.
+func (a *Action) IsExecutable() bool { return a != nil && a.Executable && !a.Manual }
+
+// IsManual returns true for manual action.
+func (a *Action) IsManual() bool { return a != nil && a.Manual && !a.Executable }
+
+// IsEmpty returns true for empty (do-nothing) action; nil action is considered empty, too.
+func (a *Action) IsEmpty() bool { return a == nil || (!a.Executable && !a.Manual) }
+
 // Init initializes the action: check the manual and executable flags and set them properly.
 // This method is defined for convenience: it is advisable to run it when the action has NOT been defined using the 'Create*'
 // methods. This is the case when actions are defined by marshaling from XML or JSON config file.
@@ -63,9 +135,9 @@ func (a *Action) Init() {
 	a.Executable = false
 	a.Manual = false
 
-	// if the action script is defined, action is executable
+	// if the action script (or assertion or Java main class) is defined, action is executable
 	// we like executable actions, so we gave them precedence
-	if a.Script != "" {
+	if a.Script != "" || a.Assert != nil || a.MainClass != "" {
 		a.Executable = true
 		a.Manual = false
 	} else {
@@ -78,9 +150,13 @@ func (a *Action) Init() {
 }
 
 // XML returns an XML-encoded representation of the Action.
-func (a *Action) XML() (string, error) {
+func (a *Action) XML() (string, error) { return a.XMLIndent(DefaultXMLPrefix, DefaultXMLIndent) }
+
+// XMLIndent returns the same representation as XML(), but every line begins with the given prefix and is indented
+// with one or more copies of the given indent.
+func (a *Action) XMLIndent(prefix, indent string) (string, error) {
 
-	output, err := xml.MarshalIndent(a, "  ", "    ")
+	output, err := xml.MarshalIndent(a, prefix, indent)
 	if err != nil {
 		return "", err
 	}
@@ -102,18 +178,54 @@ func (a *Action) JSON() (string, error) {
 // script or a program. If 'manual' flag is set, the action is considered manual. If both arguments are reset, that action is
 // considered an empty (do-nothing) action. If we deal with non-executable action, 'description' is simply copied to
 // 'output' field. Also, 'success' has a meaning only if action is executed; if not, 'Result' is always set to "not tested".
-func (a *Action) Execute() string {
+func (a *Action) Execute() string { return a.ExecuteContext(context.Background()) }
+
+// ExecuteContext executes the action the same way as Execute() does, but the execution of script/program is aborted when
+// the given context is done; aborted action fails.
+func (a *Action) ExecuteContext(ctx context.Context) string { return a.ExecuteWithOptions(ctx, ExecOptions{}) }
+
+// ExecuteWithOptions executes the action the same way as ExecuteContext() does, using the given execution options.
+func (a *Action) ExecuteWithOptions(ctx context.Context, opts ExecOptions) string {
 
 	a.Result = "NotTested" // we assume neutral status
 
+	// assertions are evaluated in-process
+	if a.IsExecutable() && a.Assert != nil {
+
+		start := time.Now()
+		if err := a.Assert.Check(); err != nil {
+			a.Output = fmt.Sprintf("Assertion failed: %s\n", err)
+			a.Result = "Fail"
+		} else {
+			a.Output = fmt.Sprintf("Assertion passed: %s\n", a.Assert.String())
+			a.Result = "Pass"
+		}
+		a.Duration = Duration(time.Since(start))
+		return a.Output
+	}
+
 	// We execute the action only if it's marked executable
-	if a.Executable {
+	if a.IsExecutable() {
 
 		var err error
-		a.Output, err = Execute(a.Script, strings.Split(a.Args, " "))
+		start := time.Now()
+		switch {
+		case a.MainClass != "":
+			a.Output, err = executeJavaClass(ctx, a.Classpath, a.MainClass, strings.Fields(a.Args), a.Stdin, opts)
+			a.ExitCode = exitCode(err)
+		case a.Remote != nil:
+			a.Output, a.ExitCode, err = RemoteExec(ctx, a.Remote, strings.TrimSpace(a.Script+" "+a.Args), a.Stdin, opts)
+		default:
+			a.Output, err = ExecuteWithOptions(ctx, a.Script, strings.Fields(a.Args), a.Stdin, opts)
+			a.ExitCode = exitCode(err)
+		}
+		a.Duration = Duration(time.Since(start))
 
-		// if error has accured, script has failed; otherwise, it's OK
-		if err != nil {
+		// if error has accured, script has failed (or could not be executed at all); otherwise, it's OK
+		if operationalError(err) {
+			a.Output += fmt.Sprintf("Execution error: %s\n", err)
+			a.Result = "Error"
+		} else if err != nil {
 			a.Result = "Fail"
 		} else {
 			a.Result = "Pass"
@@ -121,16 +233,75 @@ func (a *Action) Execute() string {
 	} else {
 		// otherwise we just put description into output, success is already set
 		a.Output = a.Description
+
+		// ...unless the operator is prompted for the manual action verdict
+		if a.IsManual() && opts.ManualPrompt != nil {
+			start := time.Now()
+			if res, err := opts.ManualPrompt(a); err == nil {
+				a.Result = res
+			} else {
+				a.Output += fmt.Sprintf("\nPrompt failed: %s", err)
+			}
+			a.Duration = Duration(time.Since(start))
+		}
 	}
 	return a.Output
 }
 
+// Clone returns a copy of the action; nil is returned for nil action.
+func (a *Action) Clone() *Action {
+
+	if a == nil {
+		return nil
+	}
+	c := *a
+	if a.Assert != nil {
+		as := *a.Assert
+		c.Assert = &as
+	}
+	if a.Remote != nil {
+		r := *a.Remote
+		c.Remote = &r
+	}
+	return &c
+}
+
+// Reset the results of the previous execution; nothing is done for nil action.
+func (a *Action) reset() {
+
+	if a != nil {
+		a.Result = "NotTested"
+		a.Output = ""
+		a.Duration = 0
+		a.ExitCode = 0
+	}
+}
+
+// Private function that returns a deep copy of the given list of actions.
+func cloneActions(actions []*Action) []*Action {
+
+	if actions == nil {
+		return nil
+	}
+	c := make([]*Action, len(actions))
+	for ix, a := range actions {
+		c[ix] = a.Clone()
+	}
+	return c
+}
+
 // CreateAction creates a new Automated (executable) action.
 // The 'script' fields is mandatory, the 'args' field can be empty string. Also, the 'executed' flag must be set and the
 // 'manual' flag reset. The 'Result' flag is set to 'NotTested' by default. The 'description' field has no special meaning
 // with automated action.
 func CreateAction(script string, args string) *Action {
-	return &Action{script, args, "NotTested", "", "", true, false}
+	return &Action{Script: script, Args: args, Result: "NotTested", Executable: true}
+}
+
+// CreateJavaClassAction creates a new executable action that runs the given Java main class using the given classpath
+// (which may be empty).
+func CreateJavaClassAction(classpath, mainClass, args string) *Action {
+	return &Action{Args: args, Result: "NotTested", Executable: true, Classpath: classpath, MainClass: mainClass}
 }
 
 // CreateManualAction creates new a manual action.
@@ -138,10 +309,10 @@ func CreateAction(script string, args string) *Action {
 // The 'manual' flag is set and 'executable' flag is reset. Since this action is not executable, the success is set to
 // "not tested".
 func CreateManualAction(descr string) *Action {
-	return &Action{"", "", "NotTested", "", descr, false, true}
+	return &Action{Result: "NotTested", Description: descr, Manual: true}
 }
 
 // CreateEmptyAction creates a new empty (do-nothing) action.
 // This is creation function for empty (do-nothing) action. All fields are set apropriately: only flags are actually needed. The i
 // 'manual' and 'executable' flags are reset, 'success' flag is set to "not tested".
-func CreateEmptyAction() *Action { return &Action{"No action", "", "NotTested", "", "", false, false} }
+func CreateEmptyAction() *Action { return &Action{Script: "No action", Result: "NotTested"} }
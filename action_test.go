@@ -0,0 +1,194 @@
+package atf
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestActionKinds(t *testing.T) {
+
+	// return the action initialized as after unmarshaling
+	initialized := func(a *Action) *Action {
+		a.Init()
+		return a
+	}
+
+	tests := []struct {
+		name                        string
+		action                      *Action
+		executable, manual, isEmpty bool
+	}{
+		{"script", CreateAction("/bin/true", ""), true, false, false},
+		{"java class", CreateJavaClassAction("lib.jar", "org.example.Main", ""), true, false, false},
+		{"manual", CreateManualAction("Press the button"), false, true, false},
+		{"empty", CreateEmptyAction(), false, false, true},
+		{"nil", nil, false, false, true},
+		{"unmarshaled script", initialized(&Action{Script: "/bin/true", Description: "ignored"}), true, false, false},
+		{"unmarshaled assertion", initialized(&Action{Assert: &Assertion{}}), true, false, false},
+		{"unmarshaled manual", initialized(&Action{Description: "Press the button"}), false, true, false},
+		{"unmarshaled empty", initialized(&Action{}), false, false, true},
+		{"not initialized", &Action{Script: "/bin/true"}, false, false, true},
+		{"both flags set", &Action{Executable: true, Manual: true}, false, false, false},
+	}
+	for _, tt := range tests {
+		if got := tt.action.IsExecutable(); got != tt.executable {
+			t.Errorf("%s: IsExecutable() = %t, want %t", tt.name, got, tt.executable)
+		}
+		if got := tt.action.IsManual(); got != tt.manual {
+			t.Errorf("%s: IsManual() = %t, want %t", tt.name, got, tt.manual)
+		}
+		if got := tt.action.IsEmpty(); got != tt.isEmpty {
+			t.Errorf("%s: IsEmpty() = %t, want %t", tt.name, got, tt.isEmpty)
+		}
+	}
+}
+
+func TestConsolePrompt(t *testing.T) {
+
+	tests := []struct {
+		input   string
+		want    TestResult
+		err     error
+		retries int
+	}{
+		{"Pass\n", "Pass", nil, 0},
+		{"  fail \n", "Fail", nil, 0},
+		{"maybe\nXFail\n\nPass\n", "Pass", nil, 3},
+		{"Pass", "Pass", nil, 0},
+		{"", "", io.ErrUnexpectedEOF, 0},
+		{"NotTested\n", "", io.ErrUnexpectedEOF, 1},
+	}
+	for _, tt := range tests {
+		var out strings.Builder
+		prompt := NewConsolePrompt(strings.NewReader(tt.input), &out)
+		res, err := prompt(CreateManualAction("Press the button"))
+		if res != tt.want || !errors.Is(err, tt.err) {
+			t.Errorf("input %q: got %q, %v; want %q, %v", tt.input, res, err, tt.want, tt.err)
+		}
+		if !strings.HasPrefix(out.String(), "Manual action:\nPress the button\nResult [Pass/Fail]: ") {
+			t.Errorf("input %q: unexpected prompt %q", tt.input, out.String())
+		}
+		if got := strings.Count(out.String(), "Please enter either Pass or Fail."); got != tt.retries {
+			t.Errorf("input %q: question repeated %d times, want %d", tt.input, got, tt.retries)
+		}
+	}
+}
+
+func TestManualActionPrompt(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		prompt ManualPromptFn
+		result TestResult
+		status TestResult
+	}{
+		// without the operator, the manual action is not tested, so the step expected to pass fails
+		{"not prompted", nil, "NotTested", "Fail"},
+		{"operator passed", NewConsolePrompt(strings.NewReader("Pass\n"), io.Discard), "Pass", "Pass"},
+		{"operator failed", NewConsolePrompt(strings.NewReader("Fail\n"), io.Discard), "Fail", "Fail"},
+		{"prompt failed", NewConsolePrompt(strings.NewReader(""), io.Discard), "NotTested", "Fail"},
+	}
+	for _, tt := range tests {
+		ts := CreateTestSet("Set", "", nil, nil, nil)
+		tc := CreateTestCase("Case", "", nil, nil, "Pass", "NotTested")
+		tc.Append(CreateTestStep("Step", "", "Pass", "NotTested", CreateManualAction("Press the button")))
+		ts.Append(tc)
+		ts.ExecuteWithOptions(quietDisplay(), ExecOptions{ManualPrompt: tt.prompt})
+
+		step := tc.Steps[0]
+		if step.Action.Result != tt.result || step.Status != tt.status {
+			t.Errorf("%s: got result %s and status %s; want %s and %s",
+				tt.name, step.Action.Result, step.Status, tt.result, tt.status)
+		}
+		if !strings.HasPrefix(step.Output, "Press the button") {
+			t.Errorf("%s: unexpected output %q", tt.name, step.Output)
+		}
+	}
+}
+
+func TestActionXMLRoundTrip(t *testing.T) {
+
+	executed := CreateAction("check.py", "-v \"10.0.0.1\"")
+	executed.Result, executed.Output, executed.ExitCode = "Fail", "error: <timeout> & more\n", 2
+	executed.Duration, executed.Stdin = Duration(1500*time.Millisecond), "line 1\nline 2"
+	remote := CreateAction("uptime", "")
+	remote.Remote = &SSHConfig{Host: "10.0.0.1:2222", User: "admin", PasswordEnv: "PASS", KeyFile: "id_rsa",
+		KnownHosts: "known_hosts", InsecureIgnoreHostKey: true, ConnectTimeout: Duration(5 * time.Second)}
+
+	tests := []struct {
+		name   string
+		action *Action
+	}{
+		{"script", CreateAction("/bin/true", "")},
+		{"executed script", executed},
+		{"manual", CreateManualAction("Press the button")},
+		{"empty", CreateEmptyAction()},
+		{"assertion", CreateAssertAction(AssertMatches, "version 1.2", `^version \d+\.\d+$`)},
+		{"file assertion", CreateAssertAction(AssertFileExists, "/etc/hosts", "")},
+		{"java class", CreateJavaClassAction("lib.jar:classes", "org.example.Main", "-x")},
+		{"remote", remote},
+	}
+	for _, tt := range tests {
+		x, err := tt.action.XML()
+		if err != nil {
+			t.Fatalf("%s: XML() failed: %s", tt.name, err)
+		}
+		got := new(Action)
+		if err := FromXML(x, got); err != nil {
+			t.Fatalf("%s: XML cannot be decoded: %s", tt.name, err)
+		}
+		if !reflect.DeepEqual(got, tt.action) {
+			gx, _ := got.XML()
+			t.Errorf("%s: decoded action differs:\n%s\n%s", tt.name, x, gx)
+		}
+		// the kind of action is preserved, even without initialization
+		if got.IsExecutable() != tt.action.IsExecutable() || got.IsManual() != tt.action.IsManual() {
+			t.Errorf("%s: the kind of action has changed", tt.name)
+		}
+	}
+}
+
+func TestActionDurationEncoding(t *testing.T) {
+
+	executed := CreateAction("check.py", "")
+	executed.Result, executed.Duration, executed.ExitCode = "Fail", Duration(1500*time.Millisecond), 2
+	tests := []struct {
+		name   string
+		action *Action
+		json   []string
+		xml    []string
+	}{
+		{"executed", executed, []string{`"Duration":"1.5s"`, `"ExitCode":2`},
+			[]string{`<Duration>1.5s</Duration>`, `exitcode="2"`}},
+		{"not executed", CreateAction("check.py", ""), nil, nil},
+	}
+	for _, tt := range tests {
+		j, err := tt.action.JSON()
+		if err != nil {
+			t.Fatalf("%s: JSON() failed: %s", tt.name, err)
+		}
+		x, err := tt.action.XML()
+		if err != nil {
+			t.Fatalf("%s: XML() failed: %s", tt.name, err)
+		}
+		// duration is encoded as a duration string, while the unset values are omitted
+		for _, want := range tt.json {
+			if !strings.Contains(j, want) {
+				t.Errorf("%s: %s is missing in JSON: %s", tt.name, want, j)
+			}
+		}
+		for _, want := range tt.xml {
+			if !strings.Contains(x, want) {
+				t.Errorf("%s: %s is missing in XML: %s", tt.name, want, x)
+			}
+		}
+		if tt.json == nil && (strings.Contains(j, "Duration") || strings.Contains(j, "ExitCode") ||
+			strings.Contains(x, "Duration") || strings.Contains(x, "exitcode")) {
+			t.Errorf("%s: unset duration or exit code is encoded: %s, %s", tt.name, j, x)
+		}
+	}
+}
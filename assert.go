@@ -0,0 +1,91 @@
+package atf
+
+/*
+ * assert.go - simple in-process assertions
+ *
+ * Trivial checks do not need an external script: an action can define an
+ * assertion instead, which is evaluated in-process without spawning a
+ * process.
+ */
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// AssertOp defines the assertion operator.
+type AssertOp string
+
+const (
+	// AssertEquals checks that actual value equals the expected value
+	AssertEquals AssertOp = "equals"
+
+	// AssertContains checks that actual value contains the expected value
+	AssertContains AssertOp = "contains"
+
+	// AssertMatches checks that actual value matches the expected regular expression
+	AssertMatches AssertOp = "matches"
+
+	// AssertFileExists checks that the file named by actual value exists; expected value is not used
+	AssertFileExists AssertOp = "file-exists"
+)
+
+// Assertion represents a single in-process check.
+type Assertion struct {
+
+	// Op is an assertion operator; in XML, this is an attribute
+	Op AssertOp `xml:"op,attr" yaml:"op"`
+
+	// Actual is the value being checked
+	Actual string `yaml:"actual"`
+
+	// Expected is the value the actual value is compared to
+	Expected string `yaml:"expected"`
+}
+
+// String returns a human-readable representation of the Assertion.
+func (as *Assertion) String() string {
+
+	if as.Op == AssertFileExists {
+		return fmt.Sprintf("assert %s %q", as.Op, as.Actual)
+	}
+	return fmt.Sprintf("assert %q %s %q", as.Actual, as.Op, as.Expected)
+}
+
+// Check evaluates the assertion: nil is returned when assertion holds, otherwise an error describing the failure.
+func (as *Assertion) Check() error {
+
+	switch as.Op {
+	case AssertEquals:
+		if as.Actual != as.Expected {
+			return fmt.Errorf("%q is not equal to %q", as.Actual, as.Expected)
+		}
+	case AssertContains:
+		if !strings.Contains(as.Actual, as.Expected) {
+			return fmt.Errorf("%q does not contain %q", as.Actual, as.Expected)
+		}
+	case AssertMatches:
+		re, err := regexp.Compile(as.Expected)
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrorInvalidValue, err)
+		}
+		if !re.MatchString(as.Actual) {
+			return fmt.Errorf("%q does not match %q", as.Actual, as.Expected)
+		}
+	case AssertFileExists:
+		if _, err := os.Stat(as.Actual); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("%w: unknown assertion operator %q", ErrorInvalidValue, as.Op)
+	}
+	return nil
+}
+
+// CreateAssertAction creates a new executable action that evaluates the given assertion instead of executing a script.
+func CreateAssertAction(op AssertOp, actual, expected string) *Action {
+	return &Action{Result: "NotTested", Executable: true,
+		Assert: &Assertion{Op: op, Actual: actual, Expected: expected}}
+}
@@ -0,0 +1,79 @@
+package atf
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAssertion(t *testing.T) {
+
+	file := filepath.Join(t.TempDir(), "exists.txt")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		op               AssertOp
+		actual, expected string
+		result           TestResult
+		msg              string
+	}{
+		{AssertEquals, "1.2.3", "1.2.3", "Pass", "Assertion passed: assert \"1.2.3\" equals \"1.2.3\""},
+		{AssertEquals, "1.2.3", "1.2", "Fail", "\"1.2.3\" is not equal to \"1.2\""},
+		{AssertEquals, "", "", "Pass", "Assertion passed"},
+		{AssertContains, "link is up", "up", "Pass", "Assertion passed"},
+		{AssertContains, "link is up", "down", "Fail", "\"link is up\" does not contain \"down\""},
+		{AssertContains, "anything", "", "Pass", "Assertion passed"},
+		{AssertMatches, "version 1.2.3", `^version \d+\.\d+\.\d+$`, "Pass", "Assertion passed"},
+		{AssertMatches, "version 1.2", `^version \d+\.\d+\.\d+$`, "Fail", "does not match"},
+		{AssertMatches, "version", "(", "Fail", ErrorInvalidValue.Error()},
+		{AssertFileExists, file, "", "Pass", "Assertion passed: assert file-exists"},
+		{AssertFileExists, file + ".missing", "", "Fail", "no such file or directory"},
+		{"greater", "2", "1", "Fail", "unknown assertion operator \"greater\""},
+	}
+	for _, tt := range tests {
+		a := CreateAssertAction(tt.op, tt.actual, tt.expected)
+		out := a.ExecuteWithOptions(context.Background(), ExecOptions{})
+		if a.Result != tt.result || !strings.Contains(out, tt.msg) {
+			t.Errorf("%s %q %q: got %s, %q; want %s, %q", tt.op, tt.actual, tt.expected, a.Result, out, tt.result, tt.msg)
+		}
+		if err := a.Assert.Check(); (err == nil) != (tt.result == "Pass") {
+			t.Errorf("%s %q %q: Check() returned %v", tt.op, tt.actual, tt.expected, err)
+		}
+	}
+	if err := (&Assertion{Op: AssertMatches, Expected: "["}).Check(); !errors.Is(err, ErrorInvalidValue) {
+		t.Errorf("invalid regular expression returned %v", err)
+	}
+}
+
+func TestCollectAssertion(t *testing.T) {
+
+	dir := t.TempDir()
+	tests := []struct {
+		name string
+		text string
+	}{
+		{"set.yaml", "name: S\ncases:\n  - name: C\n    steps:\n      - name: s\n" +
+			"        action: {assert: {op: contains, actual: link is up, expected: up}}\n"},
+		{"set.json", `{"Name": "S", "Cases": [{"Name": "C", "Steps": [{"Name": "s", "Action": ` +
+			`{"Assert": {"Op": "contains", "Actual": "link is up", "Expected": "up"}}}]}]}`},
+		{"set.xml", `<TestSet name="S"><Cases><TestCase name="C"><Steps><TestStep name="s"><Action>` +
+			`<Assert op="contains"><Actual>link is up</Actual><Expected>up</Expected></Assert>` +
+			`</Action></TestStep></Steps></TestCase></Cases></TestSet>`},
+	}
+	for _, tt := range tests {
+		ts, err := Collect(writeConfig(t, dir, tt.name, tt.text))
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		ts.Execute(quietDisplay())
+		if step := ts.Cases[0].Steps[0]; step.Status != "Pass" || !strings.HasPrefix(step.Output, "Assertion passed") {
+			t.Errorf("%s: got status %s and output %q", tt.name, step.Status, step.Output)
+		}
+	}
+}
@@ -18,6 +18,16 @@ const (
 	ErrorUnknownReportType
 	// ErrorInvalidTestResult is FIXME
 	ErrorInvalidTestResult
+	// ErrorConfigSyntax represents a syntax error in the configuration
+	ErrorConfigSyntax
+	// ErrorUnknownConfigType represents an unrecognized configuration file type
+	ErrorUnknownConfigType
+	// ErrorExecTimeout represents the script/program execution that did not finish in time
+	ErrorExecTimeout
+	// ErrorInterpreterNotFound represents a missing script interpreter (or executable)
+	ErrorInterpreterNotFound
+	// ErrorConnectionFailed represents a failed connection to the remote host
+	ErrorConnectionFailed
 )
 
 // Error implements the 'error' interface
@@ -32,6 +42,68 @@ func (e Error) Error() string {
 		msg = "Unknown report type"
 	case ErrorInvalidTestResult:
 		msg = "Invalid test result value"
+	case ErrorConfigSyntax:
+		msg = "Configuration syntax error"
+	case ErrorUnknownConfigType:
+		msg = "Unknown configuration file type"
+	case ErrorExecTimeout:
+		msg = "Execution timed out"
+	case ErrorInterpreterNotFound:
+		msg = "Interpreter not found"
+	case ErrorConnectionFailed:
+		msg = "Connection failed"
 	}
 	return msg
 }
+
+// ATFError is an error carrying one of the Error codes together with the underlying cause and a context message.
+type ATFError struct {
+	// Code is the error code
+	Code Error
+	// Err is the underlying error (may be nil)
+	Err error
+	// Msg is an additional context message
+	Msg string
+}
+
+// Wrap creates a new ATFError with the given code, underlying error and context message.
+func Wrap(code Error, err error, msg string) *ATFError { return &ATFError{Code: code, Err: err, Msg: msg} }
+
+// WrapInvalidValue wraps the given error as ErrorInvalidValue.
+func WrapInvalidValue(err error, msg string) *ATFError { return Wrap(ErrorInvalidValue, err, msg) }
+
+// WrapInterpreterNotFound wraps the given error as ErrorInterpreterNotFound.
+func WrapInterpreterNotFound(err error, msg string) *ATFError {
+	return Wrap(ErrorInterpreterNotFound, err, msg)
+}
+
+// WrapExecTimeout wraps the given error as ErrorExecTimeout.
+func WrapExecTimeout(err error, msg string) *ATFError { return Wrap(ErrorExecTimeout, err, msg) }
+
+// WrapConnectionFailed wraps the given error as ErrorConnectionFailed.
+func WrapConnectionFailed(err error, msg string) *ATFError {
+	return Wrap(ErrorConnectionFailed, err, msg)
+}
+
+// Error implements the 'error' interface
+func (e *ATFError) Error() string {
+	msg := e.Code.Error()
+	if e.Msg != "" {
+		msg += ": " + e.Msg
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+// Unwrap returns the underlying error.
+func (e *ATFError) Unwrap() error { return e.Err }
+
+// Is reports whether the target is the error code of this error; this makes errors.Is(err, ErrorXyz) work.
+func (e *ATFError) Is(target error) bool {
+	if c, ok := target.(Error); ok {
+		return c == e.Code
+	}
+	return false
+}
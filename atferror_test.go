@@ -0,0 +1,94 @@
+package atf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestErrorValues(t *testing.T) {
+
+	codes := []Error{ErrorUnknown, ErrorInvalidValue, ErrorUnknownReportType, ErrorInvalidTestResult, ErrorConfigSyntax,
+		ErrorUnknownConfigType, ErrorExecTimeout, ErrorInterpreterNotFound, ErrorConnectionFailed}
+	msgs := make(map[string]bool)
+	for _, code := range codes {
+		msg := code.Error()
+		if msg == "" || msg == "Unknown error" || msgs[msg] {
+			t.Errorf("error %d has no distinct message: %q", int(code), msg)
+		}
+		msgs[msg] = true
+
+		wrapped := fmt.Errorf("context: %w", code)
+		for _, other := range codes {
+			if got := errors.Is(wrapped, other); got != (other == code) {
+				t.Errorf("errors.Is(%q, %q) = %t", wrapped, other, got)
+			}
+		}
+	}
+}
+
+func TestExecuteErrors(t *testing.T) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	tests := []struct {
+		ctx    context.Context
+		script string
+		args   []string
+		err    error
+	}{
+		{context.Background(), "/nonexistent/program", nil, ErrorInterpreterNotFound},
+		{context.Background(), "", nil, ErrorInvalidValue},
+		{ctx, "/bin/sleep", []string{"5"}, ErrorExecTimeout},
+	}
+	for _, tt := range tests {
+		if _, err := ExecuteWithOptions(tt.ctx, tt.script, tt.args, "", ExecOptions{}); !errors.Is(err, tt.err) {
+			t.Errorf("%q: expected %v, got %v", tt.script, tt.err, err)
+		}
+	}
+}
+
+func TestATFErrorUnwrap(t *testing.T) {
+
+	cause := &os.PathError{Op: "open", Path: "config.json", Err: os.ErrNotExist}
+	tests := []struct {
+		err  *ATFError
+		code Error
+		msg  string
+	}{
+		{WrapInvalidValue(cause, "reading config"), ErrorInvalidValue,
+			"Invalid value: reading config: open config.json: file does not exist"},
+		{WrapExecTimeout(context.DeadlineExceeded, ""), ErrorExecTimeout, "Execution timed out: context deadline exceeded"},
+		{WrapConnectionFailed(nil, "host"), ErrorConnectionFailed, "Connection failed: host"},
+		{Wrap(ErrorUnknown, nil, ""), ErrorUnknown, "Unknown Error"},
+	}
+	for _, tt := range tests {
+		var err error = fmt.Errorf("outer: %w", tt.err)
+		if !errors.Is(err, tt.code) || errors.Is(err, ErrorConfigSyntax) {
+			t.Errorf("%q: unexpected error code", tt.err)
+		}
+		if tt.err.Error() != tt.msg {
+			t.Errorf("expected message %q, got %q", tt.msg, tt.err.Error())
+		}
+		var ae *ATFError
+		if !errors.As(err, &ae) || ae != tt.err || errors.Unwrap(ae) != tt.err.Err {
+			t.Errorf("%q: cannot unwrap ATFError", err)
+		}
+	}
+
+	var pe *os.PathError
+	if err := error(tests[0].err); !errors.As(err, &pe) || !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("%q: cannot unwrap the cause", err)
+	}
+
+	// the executor wraps the underlying exec error
+	_, err := ExecuteWithOptions(context.Background(), "/nonexistent/program", nil, "", ExecOptions{})
+	var ee *exec.Error
+	if !errors.As(err, &ee) && !errors.As(err, &pe) {
+		t.Errorf("executor error does not wrap the cause: %#v", err)
+	}
+}
@@ -5,9 +5,8 @@ package atf
  *
  * Collector is a module that collects the configuration (from configuration
  * file) and builds the type hierarchy (that is: scripts) to be executed.
- * The configuration can be encoded as JSON or XML or plain text (that one is
- * not implemented yet and frankly I'm not sure that is actually needed; so it
- * might be omitted in the end...)
+ * The configuration can be encoded as JSON, XML, YAML or plain text (a simple
+ * line-oriented format, see TextCollector).
  *
  * History:
  *  1   Apr10   MR  The initial version
@@ -20,14 +19,53 @@ package atf
  */
 
 import (
+	"compress/gzip"
 	"encoding/json"
 	"encoding/xml"
+	"errors"
+	"fmt"
 	"github.com/mraitmaier/atf/utils"
+	"gopkg.in/yaml.v2"
 	"io"
+	"mime"
+	"net/http"
+	"os"
 	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
 )
 
-// Collector defines the types that implement Collect() method.
+// DefaultCollectTimeout defines how long to wait for the config to be fetched by CollectURL(), when not defined otherwise.
+const DefaultCollectTimeout = 30 * time.Second
+
+// CollectOptions defines how the configs are collected; the zero value defines the default behavior. The package-level
+// Collect*() functions use the default options.
+type CollectOptions struct {
+
+	// Validate defines whether the collected test set is validated (see TestSet.Validate()) before it is returned
+	Validate bool
+
+	// Timeout defines how long to wait for the config to be fetched by CollectURL(); DefaultCollectTimeout, when not
+	// defined
+	Timeout time.Duration
+
+	// RenameOnMerge defines how the test cases with duplicate names are treated when multiple config files are merged
+	// (see TestSet.Merge()): when set, the merged cases are renamed, otherwise an error is returned
+	RenameOnMerge bool
+
+	// StrictEnv defines how the unresolved ${VAR} references in collected configs are treated (see ExpandEnv()): when set,
+	// they are reported as an error, otherwise they are left verbatim
+	StrictEnv bool
+}
+
+// a regular expression matching the ${VAR} references
+var envRef = regexp.MustCompile(`\$\{(\w+)\}`)
+
+// Collector defines the types that implement Collect() method. The collector only parses the config text; the ${VAR}
+// references are expanded (see ExpandEnv()) afterwards, when the config is collected by Collect() and friends.
 type Collector interface {
 	Collect(pth string, ts *TestSet) error
 }
@@ -46,47 +84,522 @@ type XMLCollector string
 // Collect implements the Collector interface.
 func (c *XMLCollector) Collect(text string, ts *TestSet) error { return xml.Unmarshal([]byte(text), ts) }
 
+// YAMLCollector defines the YAML collector type.
+type YAMLCollector string
+
+// Collect implements the Collector interface.
+func (c *YAMLCollector) Collect(text string, ts *TestSet) error { return yaml.Unmarshal([]byte(text), ts) }
+
 // TextCollector defines the plain text collector type.
+//
+// The plain text configuration is line-oriented: every line is a "key: value" pair. Empty lines and lines starting with
+// '#' are ignored. The following keys are recognized:
+//
+//	set: <name>                 name of the test set
+//	description: <text>         description of the test set or (when defined after 'case:') the current test case
+//	setup: <script> [<args>]    setup action of the test set or (when defined after 'case:') the current test case
+//	cleanup: <script> [<args>]  cleanup action of the test set or (when defined after 'case:') the current test case
+//	case: <name>                starts a new test case
+//	step: <name>                starts a new test step in the current test case
+//	action: <script> [<args>]   executable action of the current test step
+//	manual: <text>              manual action of the current test step
+//	stdin: <text>               text fed to the standard input of the current test step action
+//	expected: <result>          expected result of the current test step or (when no step is defined yet) test case
+//
+// An example:
+//
+//	set: Smoke tests
+//	case: Ping
+//	step: Ping the gateway
+//	action: ping.py 192.168.1.1
+//	step: Check the LEDs
+//	manual: All LEDs should be green
 type TextCollector string
 
 // Collect implements the Collector interface.
-func (c *TextCollector) Collect(pth string, ts *TestSet) error {
-	// TODO: no implementation yet, returning empty pointer
-	return nil
+func (c *TextCollector) Collect(text string, ts *TestSet) error {
+
+	var tc *TestCase
+	var step *TestStep
+
+	for num, line := range strings.Split(text, "\n") {
+
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// every line is a "key: value" pair
+		kv := strings.SplitN(line, ":", 2)
+		if len(kv) != 2 {
+			return syntaxError(num, "missing ':' separator")
+		}
+		key, val := strings.ToLower(strings.TrimSpace(kv[0])), strings.TrimSpace(kv[1])
+		if val == "" {
+			return syntaxError(num, fmt.Sprintf("empty value for %q", key))
+		}
+
+		switch key {
+		case "set":
+			ts.Name = val
+		case "description":
+			if tc != nil {
+				tc.Description = val
+			} else {
+				ts.Description = val
+			}
+		case "setup":
+			if tc != nil {
+				tc.Setup = textAction(val)
+			} else {
+				ts.Setup = textAction(val)
+			}
+		case "cleanup":
+			if tc != nil {
+				tc.Cleanup = textAction(val)
+			} else {
+				ts.Cleanup = textAction(val)
+			}
+		case "case":
+			if err := checkTextStep(num, step); err != nil {
+				return err
+			}
+			tc = CreateTestCase(val, "", nil, nil, "Pass", "NotTested")
+			step = nil
+			ts.Append(tc)
+		case "step":
+			if tc == nil {
+				return syntaxError(num, "step defined outside of a test case")
+			}
+			if err := checkTextStep(num, step); err != nil {
+				return err
+			}
+			step = CreateTestStep(val, "", "", "NotTested", nil)
+			tc.Append(step)
+		case "action", "manual":
+			if step == nil {
+				return syntaxError(num, key+" defined outside of a test step")
+			}
+			if key == "manual" {
+				step.Action = CreateManualAction(val)
+			} else {
+				step.Action = textAction(val)
+			}
+		case "stdin":
+			if step == nil || step.Action == nil {
+				return syntaxError(num, "stdin defined outside of a test step action")
+			}
+			step.Action.Stdin = val
+		case "expected":
+			if !IsValidTestResult(val) {
+				return syntaxError(num, fmt.Sprintf("invalid expected result %q", val))
+			}
+			if step != nil {
+				step.Expected = TestResult(val)
+			} else if tc != nil {
+				tc.Expected = TestResult(val)
+			} else {
+				return syntaxError(num, "expected result defined outside of a test case")
+			}
+		default:
+			return syntaxError(num, fmt.Sprintf("unknown key %q", key))
+		}
+	}
+	return checkTextStep(-1, step)
 }
 
-// Collect is a public factory function that resolves the right collector type and reads the config. The final result is the
-// valid TestSet structure, ready to be executed.
-func Collect(pth string) (ts *TestSet) {
+// Create an executable action from the text config value: the first word is a script, the rest are arguments.
+func textAction(val string) *Action {
+	sa := strings.SplitN(val, " ", 2)
+	if len(sa) == 1 {
+		return CreateAction(sa[0], "")
+	}
+	return CreateAction(sa[0], strings.TrimSpace(sa[1]))
+}
+
+// Every test step needs an action: check that the last defined step has one.
+func checkTextStep(num int, step *TestStep) error {
+	if step != nil && step.Action == nil {
+		if num < 0 {
+			return fmt.Errorf("%w: test step %q has no action", ErrorConfigSyntax, step.Name)
+		}
+		return syntaxError(num, fmt.Sprintf("test step %q has no action", step.Name))
+	}
+	return nil
+}
 
-	// let's create empty TestSet
-	ts = new(TestSet)
+// Create a descriptive syntax error for the given (zero-based) line number.
+func syntaxError(num int, msg string) error {
+	return fmt.Errorf("%w: line %d: %s", ErrorConfigSyntax, num+1, msg)
+}
 
-	// we need one of the Collectors to get test set data
-	var c Collector
+// Private function that resolves the right collector type from the config file extension; for compressed files, the inner
+// extension is used (e.g. "cases.json.gz" is a JSON file). If the type of the file is not recognized, nil is returned.
+func newCollector(pth string) Collector {
 
-	// determine the type of config file and unmarshal the data into TestSet
-	switch path.Ext(pth) {
+	switch path.Ext(strings.TrimSuffix(pth, ".gz")) {
 	case ".json":
-		c = new(JSONCollector)
+		return new(JSONCollector)
 	case ".txt", ".cfg":
-		c = new(TextCollector)
+		return new(TextCollector)
 	case ".xml":
-		c = new(XMLCollector)
-	default:
-		return nil
+		return new(XMLCollector)
+	case ".yaml", ".yml":
+		return new(YAMLCollector)
+	}
+	return nil
+}
+
+// Collect is a public factory function that resolves the right collector type and reads the config. The final result is the
+// valid TestSet structure, ready to be executed. If the config file type is not recognized, ErrorUnknownConfigType is
+// returned. Files with the ".gz" suffix are transparently decompressed.
+func Collect(pth string) (*TestSet, error) { return CollectOptions{}.Collect(pth) }
+
+// Collect collects the config file the same way as the package-level Collect() does, using the options.
+func (o CollectOptions) Collect(pth string) (*TestSet, error) {
+
+	// we need one of the Collectors to get test set data
+	c := newCollector(pth)
+	if c == nil {
+		return nil, ErrorUnknownConfigType
 	}
 
 	// read the text file
-	text, err := utils.ReadTextFile(pth)
+	text, err := readConfig(pth)
 	if err != nil && err != io.EOF {
-		return nil
+		return nil, err
 	}
 
+	return o.collectText(c, text)
+}
+
+// Collect the given config text using the given collector. The ${VAR} references in the collected test set are expanded,
+// the test set is validated (when defined by the options) and initialized.
+func (o CollectOptions) collectText(c Collector, text string) (*TestSet, error) {
+
 	// now collect the test set structure and update flags for actions
-	c.Collect(text, ts)
+	ts := new(TestSet)
+	if err := c.Collect(text, ts); err != nil {
+		return nil, err
+	}
+	if err := ExpandEnv(ts, nil, o.StrictEnv); err != nil {
+		return nil, err
+	}
+	if err := parseResults(ts); err != nil {
+		return nil, err
+	}
+	// validate before initialization, since invalid test set might panic there
+	if o.Validate {
+		if errs := ts.Validate(); len(errs) > 0 {
+			return nil, errors.Join(errs...)
+		}
+	}
+	ts.Initialize()
+	return ts, nil
+}
+
+// CollectURL fetches the config from the given URL using HTTP GET and collects it. The right collector type is resolved
+// from the response content type (JSON, XML or YAML) or, when the content type is not specific, from the URL extension
+// (the same way as Collect() does). Responses with status other than 200 OK are reported as an error.
+func CollectURL(url string) (*TestSet, error) { return CollectOptions{}.CollectURL(url) }
+
+// CollectURL fetches and collects the config the same way as the package-level CollectURL() does, using the options.
+func (o CollectOptions) CollectURL(url string) (*TestSet, error) {
+
+	timeout := o.Timeout
+	if timeout <= 0 {
+		timeout = DefaultCollectTimeout
+	}
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: fetching %q: %s", ErrorInvalidValue, url, resp.Status)
+	}
+
+	c := collectorForContentType(resp.Header.Get("Content-Type"))
+	if c == nil {
+		c = newCollector(resp.Request.URL.Path)
+	}
+	if c == nil {
+		return nil, ErrorUnknownConfigType
+	}
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return o.collectText(c, string(b))
+}
+
+// Private function that resolves the right collector type from the given HTTP content type. If the content type is not
+// recognized, nil is returned.
+func collectorForContentType(ctype string) Collector {
+
+	mt, _, err := mime.ParseMediaType(ctype)
+	if err != nil {
+		return nil
+	}
+	switch mt {
+	case "application/json":
+		return new(JSONCollector)
+	case "application/xml", "text/xml":
+		return new(XMLCollector)
+	case "application/yaml", "application/x-yaml", "text/yaml":
+		return new(YAMLCollector)
+	}
+	return nil
+}
+
+// Private function that reads the config file; gzip-compressed file (with ".gz" suffix) is decompressed.
+func readConfig(pth string) (string, error) {
+
+	if path.Ext(pth) != ".gz" {
+		return utils.ReadTextFile(pth)
+	}
+	f, err := os.Open(pth)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return "", err
+	}
+	defer zr.Close()
+	b, err := io.ReadAll(zr)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// CollectDir walks the given directory and collects all the JSON, XML and YAML config files (compressed ones, too) found
+// into a single TestSet: the test sets of all the files are merged (see TestSet.Merge()) in the sorted (lexical) order of
+// filenames. The test set is named after the directory. If any of the files cannot be collected or merged, the error
+// (including the filename) is returned.
+func CollectDir(dir string) (*TestSet, error) { return CollectOptions{}.CollectDir(dir) }
+
+// CollectDir collects the config files in the given directory the same way as the package-level CollectDir() does, using
+// the options.
+func (o CollectOptions) CollectDir(dir string) (*TestSet, error) {
+
+	if !utils.FileExists(dir) || !utils.IsDir(dir) {
+		return nil, fmt.Errorf("%w: %q is not a directory", ErrorInvalidValue, dir)
+	}
+
+	// filepath.Walk() visits files in lexical order, so the order of cases is deterministic
+	var files []string
+	err := filepath.Walk(dir, func(pth string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		switch filepath.Ext(strings.TrimSuffix(pth, ".gz")) {
+		case ".json", ".xml", ".yaml", ".yml":
+			if !info.IsDir() {
+				files = append(files, pth)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return o.collectFiles(filepath.Base(dir), files)
+}
+
+// CollectGlob collects all the config files matching the given pattern (see filepath.Glob() for the pattern syntax) into a
+// single TestSet. Files can be of mixed formats: the right collector is determined for every file separately. The test
+// sets are merged (see TestSet.Merge()) in the sorted order of filenames.
+func CollectGlob(pattern string) (*TestSet, error) { return CollectOptions{}.CollectGlob(pattern) }
+
+// CollectGlob collects the config files matching the given pattern the same way as the package-level CollectGlob() does,
+// using the options.
+func (o CollectOptions) CollectGlob(pattern string) (*TestSet, error) {
+
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%w: no config files match %q", ErrorInvalidValue, pattern)
+	}
+	sort.Strings(files)
+	return o.collectFiles(pattern, files)
+}
+
+// Collect the given files and merge them (cases, SUT, topology, setup, cleanup and hooks) into a single TestSet with given
+// name. Collection stops at the first file that fails; the error then includes the filename.
+func (o CollectOptions) collectFiles(name string, files []string) (*TestSet, error) {
+
+	ts := new(TestSet)
+	ts.Name = name
+	for _, f := range files {
+		set, err := o.Collect(f)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f, err)
+		}
+		if err := ts.Merge(set, o.RenameOnMerge); err != nil {
+			return nil, fmt.Errorf("%s: %w", f, err)
+		}
+	}
 	ts.Initialize()
-	// silently drop error: if 'ts' is 'nil', it is an error already...
+	return ts, nil
+}
+
+// ExpandEnv expands the ${VAR} references in all the user-configured values of the test set: actions' scripts, arguments,
+// standard input, Java classes, assertions and remote hosts' data, steps' artifacts and SUT addresses (including the SUTs in
+// the topology). The values are taken from the given map or, when map is nil, from the environment. If 'strict' is set,
+// unresolved references are reported as an error (every variable only once); otherwise they are left verbatim.
+func ExpandEnv(ts *TestSet, env map[string]string, strict bool) error {
+
+	var missing []string
+	seen := make(map[string]bool)
+	expand := func(s string) string {
+		return envRef.ReplaceAllStringFunc(s, func(ref string) string {
+			name := envRef.FindStringSubmatch(ref)[1]
+			var val string
+			var ok bool
+			if env != nil {
+				val, ok = env[name]
+			} else {
+				val, ok = os.LookupEnv(name)
+			}
+			if !ok {
+				if !seen[name] {
+					seen[name] = true
+					missing = append(missing, name)
+				}
+				return ref
+			}
+			return val
+		})
+	}
+	expandAction := func(a *Action) {
+		if a != nil {
+			a.Script = expand(a.Script)
+			a.Args = expand(a.Args)
+			a.Stdin = expand(a.Stdin)
+			a.Classpath = expand(a.Classpath)
+			a.MainClass = expand(a.MainClass)
+			if a.Remote != nil {
+				a.Remote.Host = expand(a.Remote.Host)
+				a.Remote.User = expand(a.Remote.User)
+				a.Remote.KeyFile = expand(a.Remote.KeyFile)
+				a.Remote.KnownHosts = expand(a.Remote.KnownHosts)
+			}
+			if a.Assert != nil {
+				a.Assert.Actual = expand(a.Assert.Actual)
+				a.Assert.Expected = expand(a.Assert.Expected)
+			}
+		}
+	}
+
+	expandSut := func(sut *SysUnderTest) {
+		if sut != nil {
+			sut.IPaddr = expand(sut.IPaddr)
+			for ix, addr := range sut.Addresses {
+				sut.Addresses[ix] = expand(addr)
+			}
+		}
+	}
+
+	expandSut(ts.Sut)
+	if ts.Topology != nil {
+		for _, sut := range ts.Topology.Suts {
+			expandSut(sut)
+		}
+	}
+	expandAction(ts.Setup)
+	expandAction(ts.Cleanup)
+	for _, hooks := range [][]*Action{ts.BeforeAll, ts.AfterAll} {
+		for _, hook := range hooks {
+			expandAction(hook)
+		}
+	}
+	for _, tc := range ts.Cases {
+		expandAction(tc.Setup)
+		expandAction(tc.Cleanup)
+		expandAction(tc.BeforeEach)
+		expandAction(tc.AfterEach)
+		for _, step := range tc.Steps {
+			expandAction(step.Action)
+			for ix, a := range step.Artifacts {
+				step.Artifacts[ix] = expand(a)
+			}
+		}
+	}
+
+	if strict && len(missing) > 0 {
+		return fmt.Errorf("%w: unresolved variables: %s", ErrorInvalidValue, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// Private function that checks (and normalizes) all the test result values of the collected test set; empty values are
+// allowed, since they are initialized later.
+func parseResults(ts *TestSet) error {
+
+	parse := func(r *TestResult) error {
+		if *r == "" {
+			return nil
+		}
+		var err error
+		*r, err = ParseTestResult(string(*r))
+		return err
+	}
+	parseAction := func(a *Action) error {
+		if a == nil {
+			return nil
+		}
+		return parse(&a.Result)
+	}
 
-	return
+	if err := parseAction(ts.Setup); err != nil {
+		return err
+	}
+	if err := parseAction(ts.Cleanup); err != nil {
+		return err
+	}
+	for _, hooks := range [][]*Action{ts.BeforeAll, ts.AfterAll} {
+		for _, hook := range hooks {
+			if err := parseAction(hook); err != nil {
+				return err
+			}
+		}
+	}
+	for _, tc := range ts.Cases {
+		for _, r := range []*TestResult{&tc.Expected, &tc.Status} {
+			if err := parse(r); err != nil {
+				return fmt.Errorf("test case %q: %w", tc.Name, err)
+			}
+		}
+		if err := parseAction(tc.Setup); err != nil {
+			return fmt.Errorf("test case %q: %w", tc.Name, err)
+		}
+		if err := parseAction(tc.Cleanup); err != nil {
+			return fmt.Errorf("test case %q: %w", tc.Name, err)
+		}
+		if err := parseAction(tc.BeforeEach); err != nil {
+			return fmt.Errorf("test case %q: %w", tc.Name, err)
+		}
+		if err := parseAction(tc.AfterEach); err != nil {
+			return fmt.Errorf("test case %q: %w", tc.Name, err)
+		}
+		for _, step := range tc.Steps {
+			for _, r := range []*TestResult{&step.Expected, &step.Status} {
+				if err := parse(r); err != nil {
+					return fmt.Errorf("test case %q: step %q: %w", tc.Name, step.Name, err)
+				}
+			}
+			if err := parseAction(step.Action); err != nil {
+				return fmt.Errorf("test case %q: step %q: %w", tc.Name, step.Name, err)
+			}
+		}
+	}
+	return nil
 }
@@ -0,0 +1,487 @@
+package atf
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCollectYAML(t *testing.T) {
+
+	ts, err := Collect(filepath.Join("testdata", "smoke.yaml"))
+	if err != nil {
+		t.Fatalf("Collect() failed: %s", err)
+	}
+	if ts.Name != "Smoke tests" {
+		t.Errorf("unexpected test set name %q", ts.Name)
+	}
+	if ts.Sut == nil || ts.Sut.Systype != SutHardware || ts.Sut.IPaddr != "192.168.1.1" {
+		t.Errorf("unexpected SUT: %v", ts.Sut)
+	}
+	if !ts.Setup.IsExecutable() || ts.Setup.Script != "prepare.sh" {
+		t.Errorf("unexpected setup action: %v", ts.Setup)
+	}
+	if len(ts.Cases) != 2 {
+		t.Fatalf("expected 2 test cases, got %d", len(ts.Cases))
+	}
+	if n := ts.CountSteps(); n != 3 {
+		t.Errorf("expected 3 test steps, got %d", n)
+	}
+	if step := ts.Cases[0].Steps[1]; step.Expected != "XFail" || step.Action.Args != "10.255.255.1" {
+		t.Errorf("unexpected step: %v", step)
+	}
+	if !ts.Cases[1].Steps[0].Action.IsManual() {
+		t.Error("the action with description only should be manual")
+	}
+}
+
+func TestCollectText(t *testing.T) {
+
+	ts, err := Collect(filepath.Join("testdata", "smoke.txt"))
+	if err != nil {
+		t.Fatalf("Collect() failed: %s", err)
+	}
+	if ts.Name != "Smoke tests" || ts.Description != "Basic checks of the system under test" {
+		t.Errorf("unexpected test set: %q, %q", ts.Name, ts.Description)
+	}
+	if ts.Setup.Script != "prepare.sh" || ts.Setup.Args != "--clean" {
+		t.Errorf("unexpected setup action: %v", ts.Setup)
+	}
+	if len(ts.Cases) != 2 || ts.CountSteps() != 4 {
+		t.Fatalf("expected 2 cases and 4 steps, got %d and %d", len(ts.Cases), ts.CountSteps())
+	}
+
+	ping, login := ts.Cases[0], ts.Cases[1]
+	if ping.Description != "The gateway must respond" {
+		t.Errorf("unexpected case description %q", ping.Description)
+	}
+	if ping.Steps[0].Expected != "Pass" || ping.Steps[1].Expected != "XFail" {
+		t.Errorf("unexpected expected results: %q, %q", ping.Steps[0].Expected, ping.Steps[1].Expected)
+	}
+	if login.Cleanup.Script != "logout.sh" {
+		t.Errorf("unexpected case cleanup: %v", login.Cleanup)
+	}
+	if a := login.Steps[0].Action; a.Script != "login.exp" || a.Args != "admin" || a.Stdin != "secret" {
+		t.Errorf("unexpected action: %v (stdin %q)", a, a.Stdin)
+	}
+	if !login.Steps[1].Action.IsManual() {
+		t.Error("the manual step action should be manual")
+	}
+}
+
+func TestCollectTextBroken(t *testing.T) {
+
+	if _, err := Collect(filepath.Join("testdata", "broken.txt")); !errors.Is(err, ErrorConfigSyntax) ||
+		!strings.Contains(err.Error(), "line 7") {
+		t.Errorf("expected syntax error at line 7, got %v", err)
+	}
+
+	tests := []struct {
+		text string
+		line int
+	}{
+		{"set: x\ncase: a\nstep b", 3},
+		{"set: x\ncase: a\nstep:", 3},
+		{"step: outside", 1},
+		{"case: a\naction: x.sh", 2},
+		{"case: a\nstep: s\nstdin: text", 3},
+		{"case: a\nexpected: Maybe", 2},
+		{"expected: Pass", 1},
+		{"case: a\ncolor: red", 2},
+		{"case: a\nstep: s", -1},
+	}
+	for _, tt := range tests {
+		err := new(TextCollector).Collect(tt.text, new(TestSet))
+		if !errors.Is(err, ErrorConfigSyntax) {
+			t.Errorf("%q: expected syntax error, got %v", tt.text, err)
+			continue
+		}
+		if tt.line > 0 && !strings.Contains(err.Error(), fmt.Sprintf("line %d:", tt.line)) {
+			t.Errorf("%q: expected error at line %d, got %q", tt.text, tt.line, err)
+		}
+	}
+}
+
+// Write the config text into a file with the given name in the given directory and return its path.
+func writeConfig(t *testing.T, dir, name, text string) string {
+
+	t.Helper()
+	pth := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(pth), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(pth, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return pth
+}
+
+func TestCollectErrors(t *testing.T) {
+
+	dir := t.TempDir()
+	var syntax *json.SyntaxError
+	tests := []struct {
+		name    string
+		text    string
+		unknown bool
+	}{
+		{"malformed.json", `{"Name": "Broken", "Cases": [`, false},
+		{"wrong.json", `{"Name": ["not", "a", "string"]}`, false},
+		{"missing.json", "", false},
+		{"config.ini", "[set]\nname = Smoke tests\n", true},
+		{"noextension", `{"Name": "Smoke tests"}`, true},
+	}
+	for _, tt := range tests {
+		pth := filepath.Join(dir, tt.name)
+		if tt.name != "missing.json" {
+			pth = writeConfig(t, dir, tt.name, tt.text)
+		}
+		ts, err := Collect(pth)
+		if err == nil || ts != nil {
+			t.Errorf("%s: expected error, got %v", tt.name, ts)
+			continue
+		}
+		if got := errors.Is(err, ErrorUnknownConfigType); got != tt.unknown {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		}
+	}
+
+	if _, err := Collect(writeConfig(t, dir, "syntax.json", "{,}")); !errors.As(err, &syntax) {
+		t.Errorf("expected JSON syntax error, got %v", err)
+	}
+}
+
+// Create the config files of a small suite in the given directory: three files (in three formats) with a test case each,
+// and a file that is not a config.
+func writeSuite(t *testing.T, dir string) {
+
+	t.Helper()
+	writeConfig(t, dir, "b.json",
+		`{"Name": "B", "Cases": [{"Name": "Second", "Steps": [{"Name": "s", "Action": {"Script": "b.sh", "Executable": true}}]}]}`)
+	writeConfig(t, dir, "a.yaml",
+		"name: A\ncases:\n  - name: First\n    steps:\n      - name: s\n        action: {script: a.sh, executable: true}\n")
+	writeConfig(t, dir, filepath.Join("sub", "c.xml"),
+		`<TestSet name="C"><Cases><TestCase name="Third"><Steps><TestStep name="s">`+
+			`<Action executable="true"><Script>c.sh</Script></Action></TestStep></Steps></TestCase></Cases></TestSet>`)
+	writeConfig(t, dir, "notes.md", "not a config")
+}
+
+// Return the names of the test set's cases.
+func caseNames(ts *TestSet) []string {
+
+	names := make([]string, 0, len(ts.Cases))
+	for _, tc := range ts.Cases {
+		names = append(names, tc.Name)
+	}
+	return names
+}
+
+func TestCollectDir(t *testing.T) {
+
+	dir := t.TempDir()
+	writeSuite(t, dir)
+
+	ts, err := CollectDir(dir)
+	if err != nil {
+		t.Fatalf("CollectDir() failed: %s", err)
+	}
+	if ts.Name != filepath.Base(dir) {
+		t.Errorf("expected test set name %q, got %q", filepath.Base(dir), ts.Name)
+	}
+	if got := strings.Join(caseNames(ts), ","); got != "First,Second,Third" {
+		t.Errorf("unexpected cases: %s", got)
+	}
+	if script := ts.Cases[2].Steps[0].Action.Script; script != "c.sh" {
+		t.Errorf("unexpected XML step script %q", script)
+	}
+}
+
+func TestCollectDirErrors(t *testing.T) {
+
+	dir := t.TempDir()
+	writeSuite(t, dir)
+	broken := writeConfig(t, dir, "d.json", `{"Name": `)
+	dup := writeConfig(t, t.TempDir(), "dup.json", `{"Name": "Dup", "Cases": [{"Name": "First"}]}`)
+	writeConfig(t, filepath.Dir(dup), "a.yaml", "name: A\ncases:\n  - name: First\n")
+
+	tests := []struct {
+		dir  string
+		want string
+	}{
+		{dir, broken},
+		{filepath.Dir(dup), dup},
+		{filepath.Join(dir, "a.yaml"), "not a directory"},
+		{filepath.Join(dir, "nonexistent"), "not a directory"},
+	}
+	for _, tt := range tests {
+		if _, err := CollectDir(tt.dir); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expected error containing %q, got %v", tt.dir, tt.want, err)
+		}
+	}
+}
+
+func TestCollectGlob(t *testing.T) {
+
+	dir := t.TempDir()
+	writeSuite(t, dir)
+
+	tests := []struct {
+		pattern string
+		cases   string
+	}{
+		{"*.json", "Second"},
+		{"[ab].*", "First,Second"},
+		{filepath.Join("*", "*.xml"), "Third"},
+		{"*.yaml", "First"},
+	}
+	for _, tt := range tests {
+		ts, err := CollectGlob(filepath.Join(dir, tt.pattern))
+		if err != nil {
+			t.Errorf("%s: CollectGlob() failed: %s", tt.pattern, err)
+			continue
+		}
+		if got := strings.Join(caseNames(ts), ","); got != tt.cases {
+			t.Errorf("%s: expected cases %s, got %s", tt.pattern, tt.cases, got)
+		}
+	}
+
+	if _, err := CollectGlob(filepath.Join(dir, "*.toml")); !errors.Is(err, ErrorInvalidValue) {
+		t.Errorf("expected error for pattern without matches, got %v", err)
+	}
+	if _, err := CollectGlob(filepath.Join(dir, "*.*")); !errors.Is(err, ErrorUnknownConfigType) {
+		t.Errorf("expected ErrorUnknownConfigType for a non-config match, got %v", err)
+	}
+	if _, err := CollectGlob("["); err == nil {
+		t.Error("expected error for malformed pattern")
+	}
+}
+
+func TestExpandEnv(t *testing.T) {
+
+	env := map[string]string{"HOST": "10.0.0.1", "TOOLS": "/opt/tools"}
+	tests := []struct {
+		script string
+		args   string
+		strict bool
+		want   string
+		err    bool
+	}{
+		{"${TOOLS}/ping.py", "${HOST}", false, "/opt/tools/ping.py 10.0.0.1", false},
+		{"${TOOLS}/ping.py", "${HOST}", true, "/opt/tools/ping.py 10.0.0.1", false},
+		{"ping.py", "${MISSING} ${HOST}", false, "ping.py ${MISSING} 10.0.0.1", false},
+		{"ping.py", "${MISSING} ${MISSING}", true, "", true},
+		{"ping.py", "$HOST", true, "ping.py $HOST", false},
+	}
+	for _, tt := range tests {
+		ts := newReportSet(CreateTestStep("s", "", "Pass", "NotTested", CreateAction(tt.script, tt.args)))
+		ts.Sut = &SysUnderTest{IPaddr: "${HOST}"}
+		err := ExpandEnv(ts, env, tt.strict)
+		if tt.err {
+			if !errors.Is(err, ErrorInvalidValue) || strings.Count(err.Error(), "MISSING") != 1 {
+				t.Errorf("%s %s: expected single unresolved variable error, got %v", tt.script, tt.args, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s %s: ExpandEnv() failed: %s", tt.script, tt.args, err)
+			continue
+		}
+		a := ts.Cases[0].Steps[0].Action
+		if got := a.Script + " " + a.Args; got != tt.want {
+			t.Errorf("expected %q, got %q", tt.want, got)
+		}
+		if ts.Sut.IPaddr != "10.0.0.1" {
+			t.Errorf("SUT address not expanded: %q", ts.Sut.IPaddr)
+		}
+	}
+}
+
+func TestCollectStrictEnv(t *testing.T) {
+
+	t.Setenv("ATF_TEST_HOST", "10.0.0.1")
+	pth := writeConfig(t, t.TempDir(), "env.yaml", "name: Env\ncases:\n  - name: Ping\n    steps:\n"+
+		"      - name: s\n        action: {script: ping.py, args: '${ATF_TEST_HOST} ${ATF_TEST_UNDEFINED}', executable: true}\n")
+
+	ts, err := Collect(pth)
+	if err != nil {
+		t.Fatalf("Collect() failed: %s", err)
+	}
+	if args := ts.Cases[0].Steps[0].Action.Args; args != "10.0.0.1 ${ATF_TEST_UNDEFINED}" {
+		t.Errorf("unexpected arguments %q", args)
+	}
+	if _, err := (CollectOptions{StrictEnv: true}).Collect(pth); !errors.Is(err, ErrorInvalidValue) ||
+		!strings.Contains(err.Error(), "ATF_TEST_UNDEFINED") {
+		t.Errorf("expected unresolved variable error, got %v", err)
+	}
+}
+
+// Compress the given file into "<name>.gz" in the given directory and return the path of the compressed file.
+func gzipFile(t *testing.T, dir, pth string) string {
+
+	t.Helper()
+	data, err := os.ReadFile(pth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(data)
+	zw.Close()
+	return writeConfig(t, dir, filepath.Base(pth)+".gz", buf.String())
+}
+
+func TestCollectGzip(t *testing.T) {
+
+	dir := t.TempDir()
+	tests := []struct {
+		name  string
+		pth   string
+		steps int
+	}{
+		{"JSON fixture", filepath.Join("testdata", "smoke.json.gz"), 3},
+		{"YAML", gzipFile(t, dir, filepath.Join("testdata", "smoke.yaml")), 3},
+		{"text", gzipFile(t, dir, filepath.Join("testdata", "smoke.txt")), 4},
+		{"XML", gzipFile(t, dir, writeConfig(t, t.TempDir(), "set.xml",
+			`<TestSet name="Smoke tests"><Cases><TestCase name="Ping"><Steps><TestStep name="s">`+
+				`<Action><Script>ping.py</Script></Action></TestStep></Steps></TestCase></Cases></TestSet>`)), 1},
+	}
+	for _, tt := range tests {
+		ts, err := Collect(tt.pth)
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		if ts.Name != "Smoke tests" || ts.Cases[0].Name != "Ping" || ts.CountSteps() != tt.steps {
+			t.Errorf("%s: unexpected test set %q with %d steps", tt.name, ts.Name, ts.CountSteps())
+		}
+		if !ts.Cases[0].Steps[0].Action.IsExecutable() {
+			t.Errorf("%s: actions have not been initialized", tt.name)
+		}
+	}
+
+	// the compressed configs are also collected from the directories
+	suite := t.TempDir()
+	writeSuite(t, suite)
+	gzipFile(t, suite, filepath.Join(suite, "sub", "c.xml"))
+	os.Remove(filepath.Join(suite, "sub", "c.xml"))
+	if ts, err := CollectDir(suite); err != nil || strings.Join(caseNames(ts), " ") != "First Second Third" {
+		t.Errorf("CollectDir() returned %v, %v", ts, err)
+	}
+}
+
+func TestCollectGzipErrors(t *testing.T) {
+
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		text    string
+		unknown bool
+	}{
+		{"plain.json.gz", `{"Name": "Not compressed"}`, false},
+		{"empty.json.gz", "", false},
+		{"config.ini.gz", "[set]\n", true},
+		{"set.gz", "", true},
+	}
+	for _, tt := range tests {
+		ts, err := Collect(writeConfig(t, dir, tt.name, tt.text))
+		if err == nil || ts != nil {
+			t.Errorf("%s: expected error, got %v", tt.name, ts)
+			continue
+		}
+		if got := errors.Is(err, ErrorUnknownConfigType); got != tt.unknown {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		}
+	}
+
+	// truncated compressed file
+	data, _ := os.ReadFile(filepath.Join("testdata", "smoke.json.gz"))
+	if _, err := Collect(writeConfig(t, dir, "truncated.json.gz", string(data[:len(data)/2]))); err == nil {
+		t.Error("expected error for truncated file")
+	}
+}
+
+func TestCollectURL(t *testing.T) {
+
+	yamlText, err := os.ReadFile(filepath.Join("testdata", "smoke.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	jsonText := `{"Name": "Smoke tests", "Cases": [{"Name": "Ping", "Steps": [{"Name": "s", "Action": {"Script": "ping.py"}}]}]}`
+	xmlText := `<TestSet name="Smoke tests"><Cases><TestCase name="Ping"><Steps><TestStep name="s">` +
+		`<Action><Script>ping.py</Script></Action></TestStep></Steps></TestCase></Cases></TestSet>`
+	docs := map[string]struct{ ctype, text string }{
+		"/smoke.json":     {"application/json", jsonText},
+		"/smoke":          {"application/xml; charset=utf-8", xmlText},
+		"/smoke.xml":      {"text/plain", xmlText},
+		"/smoke.yaml":     {"application/octet-stream", string(yamlText)},
+		"/config":         {"text/yaml", string(yamlText)},
+		"/config.ini":     {"text/plain", "[set]\n"},
+		"/malformed.json": {"application/json", `{"Name": `},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/redirect":
+			http.Redirect(w, r, "/smoke.yaml", http.StatusFound)
+			return
+		case "/slow":
+			time.Sleep(500 * time.Millisecond)
+		}
+		doc, ok := docs[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", doc.ctype)
+		fmt.Fprint(w, doc.text)
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		path string
+		err  string
+	}{
+		{"/smoke.json", ""},
+		{"/smoke", ""},
+		{"/smoke.xml", ""},
+		{"/smoke.yaml", ""},
+		{"/config", ""},
+		{"/redirect", ""},
+		{"/missing.json", "404 Not Found"},
+		{"/config.ini", ErrorUnknownConfigType.Error()},
+		{"/malformed.json", "unexpected end of JSON input"},
+	}
+	for _, tt := range tests {
+		ts, err := CollectURL(srv.URL + tt.path)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: expected error %q, got %v", tt.path, tt.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", tt.path, err)
+			continue
+		}
+		if ts.Name != "Smoke tests" || ts.Cases[0].Name != "Ping" || !ts.Cases[0].Steps[0].Action.IsExecutable() {
+			t.Errorf("%s: unexpected test set %v", tt.path, ts)
+		}
+	}
+
+	// the fetching is aborted when it takes too long
+	start := time.Now()
+	if _, err := (CollectOptions{Timeout: 100 * time.Millisecond}).CollectURL(srv.URL + "/slow"); err == nil {
+		t.Error("expected timeout error")
+	}
+	if elapsed := time.Since(start); elapsed > 400*time.Millisecond {
+		t.Errorf("fetching has not been aborted in time: %s", elapsed)
+	}
+}
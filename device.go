@@ -1,4 +1,5 @@
 package atf
+
 /*
  * device.go - file defining Device struct and its methods
  *
@@ -8,37 +9,66 @@ import (
 	"encoding/json"
 	"encoding/xml"
 	"fmt"
+	"strings"
 )
 
 // DeviceType is an enum defining different device types.
 type DeviceType int
+
 const (
-    DevUnknown DeviceType = iota
-    DevServer
-    DevClient
-    DevEthernet
-    DevSwitch
-    DevRouter
-    DevPowerSwitch
-    DevPhySwitch
-    DevTrafficGenerator
-    DevTrafficSniffer
-    DevAttenuator
-    DevODU
-    DevCTR8300
-    DevCTR8540
-    DevCtr8560
-    DevWTM3300
-    DevWTM4100
-    DevWTM4200
+	DevUnknown DeviceType = iota
+	DevServer
+	DevClient
+	DevEthernet
+	DevSwitch
+	DevRouter
+	DevPowerSwitch
+	DevPhySwitch
+	DevTrafficGenerator
+	DevTrafficSniffer
+	DevAttenuator
+	DevODU
+	DevCTR8300
+	DevCTR8540
+	DevCtr8560
+	DevWTM3300
+	DevWTM4100
+	DevWTM4200
 )
 
+// device type names, indexed by DeviceType value
+var deviceTypeNames = []string{"Unknown", "Server", "Client", "Ethernet", "Switch", "Router", "PowerSwitch", "PhySwitch",
+	"TrafficGenerator", "TrafficSniffer", "Attenuator", "ODU", "CTR8300", "CTR8540", "CTR8560", "WTM3300", "WTM4100",
+	"WTM4200"}
+
+// String returns a human-readable representation of the DeviceType value.
+func (d DeviceType) String() string {
+	if d < 0 || int(d) >= len(deviceTypeNames) {
+		return deviceTypeNames[DevUnknown]
+	}
+	return deviceTypeNames[d]
+}
+
+// DeviceTypeFromString converts device type given as string into proper DeviceType value (case-insensitive).
+// If invalid string is given, function returns 'DevUnknown' value.
+func DeviceTypeFromString(s string) DeviceType {
+	for ix, name := range deviceTypeNames {
+		if strings.EqualFold(name, s) {
+			return DeviceType(ix)
+		}
+	}
+	return DevUnknown
+}
+
 // Device is a generic interface for all types of devices
 type Device interface {
-    // TODO
+	DeviceName() string
+	Type() DeviceType
+	String() string
+	XML() (string, error)
+	JSON() (string, error)
 }
 
-
 // GenericDevice represents a system...
 type GenericDevice struct {
 	// Name of the SUT
@@ -47,172 +77,164 @@ type GenericDevice struct {
 	Dtype DeviceType `xml:"Type"`
 	// Description is a SUT description text
 	Description string `xml:"Description"`
-    //
-    Family string
-    //
-    Model string
-    //
-    Management []string
-    //
-    Location string
-    // Is this device a DUT (Device under test)?
-    IsDUT bool
-}
-
-// NewgenericDevice creates a new GenericDevice instance.
+	// Family is a device family
+	Family string
+	// Model is a device model
+	Model string
+	// Management is a list of management addresses
+	Management []string
+	// Location is a physical location of the device
+	Location string
+	// Is this device a DUT (Device under test)?
+	IsDUT bool
+}
+
+// NewGenericDevice creates a new GenericDevice instance.
 func NewGenericDevice(name string, dtype DeviceType) *GenericDevice {
 	return &GenericDevice{
-        Name: name,
-        Dtype: dtype,
-        Description: "",
-        Family: "",
-        Model: "",
-        Management: nil,
-        Location: make([]string, 0),
-        IsDut: false,
-        }
-}
-
-//
+		Name:        name,
+		Dtype:       dtype,
+		Description: "",
+		Family:      "",
+		Model:       "",
+		Management:  nil,
+		Location:    "",
+		IsDUT:       false,
+	}
+}
+
+// DeviceName returns the name of the device.
+func (g *GenericDevice) DeviceName() string { return g.Name }
+
+// Type returns the type of the device.
+func (g *GenericDevice) Type() DeviceType { return g.Dtype }
+
+// String returns a human-readable representation of the GenericDevice instance.
+func (g *GenericDevice) String() string { return "Device:\n" + g.details() }
+
+// Return the details of the generic device as text, used by String() methods of all devices.
+func (g *GenericDevice) details() string {
+
+	txt := fmt.Sprintf("          Name: %s\n", g.Name)
+	txt += fmt.Sprintf("          Type: %s\n", g.Dtype)
+	txt += fmt.Sprintf("        Family: %s\n", g.Family)
+	txt += fmt.Sprintf("         Model: %s\n", g.Model)
+	txt += fmt.Sprintf("    Management: %s\n", strings.Join(g.Management, ", "))
+	txt += fmt.Sprintf("      Location: %s\n", g.Location)
+	txt += fmt.Sprintf("          DUT?: %t\n", g.IsDUT)
+	txt += fmt.Sprintf("   Description: \n%s\n", g.Description)
+	return txt
+}
+
+// XML returns a XML-encoded representation of the GenericDevice instance.
+func (g *GenericDevice) XML() (string, error) { return g.XMLIndent(DefaultXMLPrefix, DefaultXMLIndent) }
+
+// XMLIndent returns the same representation as XML(), but every line begins with the given prefix and is indented
+// with one or more copies of the given indent.
+func (g *GenericDevice) XMLIndent(prefix, indent string) (string, error) {
+
+	output, err := xml.MarshalIndent(g, prefix, indent)
+	if err != nil {
+		return "", err
+	}
+	return string(output), nil
+}
+
+// JSON returns an JSON-encoded representation of the GenericDevice instance.
+func (g *GenericDevice) JSON() (string, error) {
+
+	b, err := json.Marshal(g)
+	if err != nil {
+		return "", err
+	}
+	return string(b[:]), err
+}
+
+// EthernetDevice represents a device with ethernet ports.
 type EthernetDevice struct {
-    //
-    GenericDevice
-    // Ports is a list of ports
-    Ports []Port
+	// EthernetDevice is a generic device with ports
+	GenericDevice
+	// Ports is a list of ports
+	Ports []Port `xml:"Ports>Port"`
 }
 
 // NewEthernetDevice creates a new EthernetDevice instance.
 func NewEthernetDevice(name string) *EthernetDevice {
 	return &EthernetDevice{
-        Name: name,
-        Dtype: DeviceType.DevEthernet,
-        Description: "",
-        Family: "",
-        Model: "",
-        Management: nil,
-        Location: make([]string, 0),
-        IsDut: false,
-        Ports: make([]Port, 0),
-        }
-}
-
-//
-type Server struct {
-    //
-    GenericDevice
-    // Ports is a list of ports
-    URI string
+		GenericDevice: *NewGenericDevice(name, DevEthernet),
+		Ports:         make([]Port, 0),
+	}
 }
 
-// NewServer creates a new Server instance.
-func NewServer(name string) *Server{
-	return &Server{
-        Name: name,
-        Dtype: DeviceType.DevEthernet,
-        Description: "",
-        Family: "",
-        Model: "",
-        Management: nil,
-        Location: make([]string, 0),
-        IsDut: false,
-        URI: '',
-        }
-}
-
-// PortType is an enum defining a device port type.
-type PortType int
-const (
-    PortTypeUnknown PortType = iota << 1
-    PortCopper
-    PortFiber
-    PortHDX
-    PortFDX
-    Port1M
-    Port10M
-    Port100M
-    Port1G
-    Port10G
-    Port40G
-    Port100G
-)
+// String returns a human-readable representation of the EthernetDevice instance.
+func (e *EthernetDevice) String() string {
 
-//
-func (p PortType) IsCopper() bool { return p & p.PortCopper }
-//
-func (p PortType) IsFiber() bool { return p & p.PortFiber }
-//
-func (p PortType) IsHalfDuplex() bool { return p & p.PortHDX }
-//
-func (p PortType) IsFullDuplex() bool { return p & p.PortFDX }
-//
-func (p PortType) IsMegabit() bool { return p & p.Port1M }
-//
-func (p PortType) Is10Megabit() bool { return p & p.Port10M }
-//
-func (p PortType) Is100Megabit() bool { return p & p.Port100M }
-//
-func (p PortType) IsGigabit() bool { return p & p.Port1G }
-//
-func (p PortType) Is10Gigabit() bool { return p & p.Port10G }
-//
-func (p PortType) Is40Gigabit() bool { return p & p.Port40G }
-//
-func (p PortType) Is100Gigabit() bool { return p & p.Port100G }
-
-// Port is ...
-type Port struct {
-    //
-    Name string
-    //
-    Description string
-    //
-    PortType
+	txt := "EthernetDevice:\n" + e.details()
+	for _, p := range e.Ports {
+		txt += fmt.Sprintf("          Port: %s [%s] %s\n", p.Name, p.PortType, p.Description)
+	}
+	return txt
 }
 
-// NewPort creates a new instance of Port.
-func NewPort() *Port {
-    return &Port{
-        Name: '',
-        Description: '',
-        PortType: PortTypeUnknown
-    }
+// XML returns a XML-encoded representation of the EthernetDevice instance.
+func (e *EthernetDevice) XML() (string, error) { return e.XMLIndent(DefaultXMLPrefix, DefaultXMLIndent) }
+
+// XMLIndent returns the same representation as XML(), but every line begins with the given prefix and is indented
+// with one or more copies of the given indent.
+func (e *EthernetDevice) XMLIndent(prefix, indent string) (string, error) {
+
+	output, err := xml.MarshalIndent(e, prefix, indent)
+	if err != nil {
+		return "", err
+	}
+	return string(output), nil
 }
 
-// CreatePort creates a new instance of Port from known parameters.
-func CreatePort(name, desc string, ptype PortType) *Port {
-    return &Port{
-        Name: name,
-        Description: desc,
-        PortType: ptype
-    }
+// JSON returns an JSON-encoded representation of the EthernetDevice instance.
+func (e *EthernetDevice) JSON() (string, error) {
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	return string(b[:]), err
 }
 
-/*
-// String returns a human-readable representation of the SUT instance.
-func (s *SysUnderTest) String() string {
-
-	txt := "SystemUnderTest:\n"
-	txt += fmt.Sprintf("          Name: %s\n", s.Name)
-	txt += fmt.Sprintf("          Type: %s\n", s.Systype)
-	txt += fmt.Sprintf("       Version: %s\n", s.Version)
-	txt += fmt.Sprintf("    IP address: %s\n", s.IPaddr)
-	txt += fmt.Sprintf("   Description: \n%s\n", s.Description)
-	txt += fmt.Sprintf("         is Up? %s\n", s.IsUp)
-	return txt
+// Server represents a server device.
+type Server struct {
+	// Server is a generic device with URI
+	GenericDevice
+	// URI is the server URI
+	URI string
+}
+
+// NewServer creates a new Server instance.
+func NewServer(name string) *Server {
+	return &Server{
+		GenericDevice: *NewGenericDevice(name, DevServer),
+		URI:           "",
+	}
 }
 
-// XML returns a XML-encoded representation of the SUT instance.
-func (s *SysUnderTest) XML() (string, error) {
+// String returns a human-readable representation of the Server instance.
+func (s *Server) String() string { return "Server:\n" + s.details() + fmt.Sprintf("           URI: %s\n", s.URI) }
+
+// XML returns a XML-encoded representation of the Server instance.
+func (s *Server) XML() (string, error) { return s.XMLIndent(DefaultXMLPrefix, DefaultXMLIndent) }
+
+// XMLIndent returns the same representation as XML(), but every line begins with the given prefix and is indented
+// with one or more copies of the given indent.
+func (s *Server) XMLIndent(prefix, indent string) (string, error) {
 
-	output, err := xml.MarshalIndent(s, "  ", "    ")
+	output, err := xml.MarshalIndent(s, prefix, indent)
 	if err != nil {
 		return "", err
 	}
 	return string(output), nil
 }
 
-// JSON returns an JSON-encoded representation of the SUT instance.
-func (s *SysUnderTest) JSON() (string, error) {
+// JSON returns an JSON-encoded representation of the Server instance.
+func (s *Server) JSON() (string, error) {
 
 	b, err := json.Marshal(s)
 	if err != nil {
@@ -220,4 +242,108 @@ func (s *SysUnderTest) JSON() (string, error) {
 	}
 	return string(b[:]), err
 }
-*/
+
+// PortType is a bitmask defining the device port capabilities: medium, speed and duplex. Capabilities can be combined,
+// e.g. PortFiber|Port10G|PortFDX.
+type PortType int
+
+// PortTypeUnknown represents a port with unknown capabilities.
+const PortTypeUnknown PortType = 0
+
+const (
+	PortCopper PortType = 1 << iota
+	PortFiber
+	PortHDX
+	PortFDX
+	Port1M
+	Port10M
+	Port100M
+	Port1G
+	Port10G
+	Port40G
+	Port100G
+)
+
+// port capability names, in the order they're listed by PortType.String()
+var portTypeNames = []struct {
+	flag PortType
+	name string
+}{
+	{PortCopper, "Copper"},
+	{PortFiber, "Fiber"},
+	{Port1M, "1M"},
+	{Port10M, "10M"},
+	{Port100M, "100M"},
+	{Port1G, "1G"},
+	{Port10G, "10G"},
+	{Port40G, "40G"},
+	{Port100G, "100G"},
+	{PortHDX, "HDX"},
+	{PortFDX, "FDX"},
+}
+
+// String returns a human-readable list of the port capabilities, e.g. "Copper,1G,FDX".
+func (p PortType) String() string {
+
+	names := make([]string, 0)
+	for _, n := range portTypeNames {
+		if p&n.flag != 0 {
+			names = append(names, n.name)
+		}
+	}
+	if len(names) == 0 {
+		return "Unknown"
+	}
+	return strings.Join(names, ",")
+}
+
+// IsCopper reports whether the port is a copper port.
+func (p PortType) IsCopper() bool { return p&PortCopper != 0 }
+// IsFiber reports whether the port is a fiber port.
+func (p PortType) IsFiber() bool { return p&PortFiber != 0 }
+// IsHalfDuplex reports whether the port is a half-duplex port.
+func (p PortType) IsHalfDuplex() bool { return p&PortHDX != 0 }
+// IsFullDuplex reports whether the port is a full-duplex port.
+func (p PortType) IsFullDuplex() bool { return p&PortFDX != 0 }
+// IsMegabit reports whether the port is a 1 Mbit port.
+func (p PortType) IsMegabit() bool { return p&Port1M != 0 }
+// Is10Megabit reports whether the port is a 10 Mbit port.
+func (p PortType) Is10Megabit() bool { return p&Port10M != 0 }
+// Is100Megabit reports whether the port is a 100 Mbit port.
+func (p PortType) Is100Megabit() bool { return p&Port100M != 0 }
+// IsGigabit reports whether the port is a 1 Gbit port.
+func (p PortType) IsGigabit() bool { return p&Port1G != 0 }
+// Is10Gigabit reports whether the port is a 10 Gbit port.
+func (p PortType) Is10Gigabit() bool { return p&Port10G != 0 }
+// Is40Gigabit reports whether the port is a 40 Gbit port.
+func (p PortType) Is40Gigabit() bool { return p&Port40G != 0 }
+// Is100Gigabit reports whether the port is a 100 Gbit port.
+func (p PortType) Is100Gigabit() bool { return p&Port100G != 0 }
+
+// Port represents a single device port.
+type Port struct {
+	// Name of the port
+	Name string
+	// Description is a port description text
+	Description string
+	// PortType defines the port capabilities
+	PortType
+}
+
+// NewPort creates a new instance of Port.
+func NewPort() *Port {
+	return &Port{
+		Name:        "",
+		Description: "",
+		PortType:    PortTypeUnknown,
+	}
+}
+
+// CreatePort creates a new instance of Port from known parameters.
+func CreatePort(name, desc string, ptype PortType) *Port {
+	return &Port{
+		Name:        name,
+		Description: desc,
+		PortType:    ptype,
+	}
+}
@@ -0,0 +1,169 @@
+package atf
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNewDevices(t *testing.T) {
+
+	tests := []struct {
+		dev   Device
+		dtype DeviceType
+	}{
+		{NewGenericDevice("switch", DevSwitch), DevSwitch},
+		{NewGenericDevice("unknown", DevUnknown), DevUnknown},
+		{NewEthernetDevice("eth"), DevEthernet},
+		{NewServer("srv"), DevServer},
+	}
+	for _, tt := range tests {
+		if tt.dev.Type() != tt.dtype || tt.dev.DeviceName() == "" {
+			t.Errorf("%s: unexpected type %s", tt.dev.DeviceName(), tt.dev.Type())
+		}
+	}
+
+	g := NewGenericDevice("dut", DevRouter)
+	if g.Location != "" || g.IsDUT || len(g.Management) != 0 {
+		t.Errorf("unexpected generic device defaults: %+v", g)
+	}
+	if e := NewEthernetDevice("eth"); e.Ports == nil || len(e.Ports) != 0 {
+		t.Errorf("unexpected ethernet device ports: %v", e.Ports)
+	}
+	if p := CreatePort("eth0", "uplink", PortCopper); p.Name != "eth0" || !p.IsCopper() || p.IsFiber() {
+		t.Errorf("unexpected port: %+v", p)
+	}
+	if p := NewPort(); p.PortType != PortTypeUnknown {
+		t.Errorf("unexpected new port type: %s", p.PortType)
+	}
+}
+
+func TestPortType(t *testing.T) {
+
+	tests := []struct {
+		p    PortType
+		name string
+		is   []func(PortType) bool
+	}{
+		{PortTypeUnknown, "Unknown", nil},
+		{PortCopper, "Copper", []func(PortType) bool{PortType.IsCopper}},
+		{PortFiber | Port10G | PortFDX, "Fiber,10G,FDX",
+			[]func(PortType) bool{PortType.IsFiber, PortType.Is10Gigabit, PortType.IsFullDuplex}},
+		{PortCopper | Port1G | PortFDX, "Copper,1G,FDX",
+			[]func(PortType) bool{PortType.IsCopper, PortType.IsGigabit, PortType.IsFullDuplex}},
+		{PortCopper | Port10M | Port100M | PortHDX, "Copper,10M,100M,HDX",
+			[]func(PortType) bool{PortType.IsCopper, PortType.Is10Megabit, PortType.Is100Megabit, PortType.IsHalfDuplex}},
+		{Port1M | Port40G | Port100G, "1M,40G,100G",
+			[]func(PortType) bool{PortType.IsMegabit, PortType.Is40Gigabit, PortType.Is100Gigabit}},
+	}
+	all := []func(PortType) bool{PortType.IsCopper, PortType.IsFiber, PortType.IsHalfDuplex, PortType.IsFullDuplex,
+		PortType.IsMegabit, PortType.Is10Megabit, PortType.Is100Megabit, PortType.IsGigabit, PortType.Is10Gigabit,
+		PortType.Is40Gigabit, PortType.Is100Gigabit}
+
+	for _, tt := range tests {
+		if got := tt.p.String(); got != tt.name {
+			t.Errorf("expected %q, got %q", tt.name, got)
+		}
+		// exactly the predicates of the set flags are true
+		count := 0
+		for _, is := range all {
+			if is(tt.p) {
+				count++
+			}
+		}
+		for _, is := range tt.is {
+			if !is(tt.p) {
+				t.Errorf("%s: predicate is false", tt.name)
+			}
+		}
+		if count != len(tt.is) {
+			t.Errorf("%s: expected %d true predicates, got %d", tt.name, len(tt.is), count)
+		}
+	}
+
+	// the flags are distinct powers of two
+	seen := PortTypeUnknown
+	for _, n := range portTypeNames {
+		if n.flag&(n.flag-1) != 0 || seen&n.flag != 0 {
+			t.Errorf("flag %s overlaps other flags", n.name)
+		}
+		seen |= n.flag
+	}
+}
+
+func TestDeviceTypeString(t *testing.T) {
+
+	for d := DevUnknown; d <= DevWTM4200; d++ {
+		name := d.String()
+		if name == "" || (d != DevUnknown && name == "Unknown") {
+			t.Errorf("device type %d has no name", int(d))
+		}
+		if got := DeviceTypeFromString(name); got != d {
+			t.Errorf("%q: expected %d, got %d", name, int(d), int(got))
+		}
+	}
+
+	tests := []struct {
+		s string
+		d DeviceType
+	}{
+		{"router", DevRouter},
+		{"CTR8300", DevCTR8300},
+		{"ctr8560", DevCtr8560},
+		{"toaster", DevUnknown},
+		{"", DevUnknown},
+	}
+	for _, tt := range tests {
+		if got := DeviceTypeFromString(tt.s); got != tt.d {
+			t.Errorf("%q: expected %s, got %s", tt.s, tt.d, got)
+		}
+	}
+	if s := DeviceType(-1).String(); s != "Unknown" {
+		t.Errorf("invalid device type: expected Unknown, got %q", s)
+	}
+}
+
+func TestDeviceRoundTrip(t *testing.T) {
+
+	g := NewGenericDevice("dut", DevRouter)
+	g.Description, g.Family, g.Model, g.Location, g.IsDUT = "Core <router>", "CTR", "8300", "Lab 1", true
+	g.Management = []string{"10.0.0.1", "10.0.0.2"}
+	e := NewEthernetDevice("switch")
+	e.GenericDevice.Management = []string{"10.0.1.1"}
+	e.Ports = []Port{*CreatePort("eth0", "uplink", PortFiber|Port10G|PortFDX), *CreatePort("eth1", "", PortCopper)}
+	s := NewServer("srv")
+	s.URI = "https://srv.example.com/api?x=1&y=2"
+
+	tests := []struct {
+		dev Device
+		new func() Device
+	}{
+		{g, func() Device { return new(GenericDevice) }},
+		{e, func() Device { return new(EthernetDevice) }},
+		{s, func() Device { return new(Server) }},
+	}
+	for _, tt := range tests {
+		text, err := tt.dev.XML()
+		if err != nil {
+			t.Fatalf("%s: XML() failed: %s", tt.dev.DeviceName(), err)
+		}
+		x := tt.new()
+		if err := xml.Unmarshal([]byte(text), x); err != nil || !reflect.DeepEqual(x, tt.dev) {
+			t.Errorf("%s: XML round-trip: expected %+v, got %+v (%v)", tt.dev.DeviceName(), tt.dev, x, err)
+		}
+
+		if text, err = tt.dev.JSON(); err != nil {
+			t.Fatalf("%s: JSON() failed: %s", tt.dev.DeviceName(), err)
+		}
+		j := tt.new()
+		if err := json.Unmarshal([]byte(text), j); err != nil || !reflect.DeepEqual(j, tt.dev) {
+			t.Errorf("%s: JSON round-trip: expected %+v, got %+v (%v)", tt.dev.DeviceName(), tt.dev, j, err)
+		}
+
+		if !strings.Contains(tt.dev.String(), tt.dev.DeviceName()) {
+			t.Errorf("%s: String() does not contain the name", tt.dev.DeviceName())
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package atf
+
+/*
+ * events.go - typed execution events
+ *
+ * The execution engine reports its progress using the display callback, which
+ * is meant for humans. Events defined here are the machine-readable
+ * alternative: they are emitted into an EventSink during the execution of the
+ * test sets, cases and steps.
+ */
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// EventType defines the type of the execution event.
+type EventType string
+
+const (
+	// SetStarted is emitted when test set execution starts
+	SetStarted EventType = "SetStarted"
+
+	// SetFinished is emitted when test set execution finishes
+	SetFinished EventType = "SetFinished"
+
+	// CaseStarted is emitted when test case execution starts
+	CaseStarted EventType = "CaseStarted"
+
+	// CaseFinished is emitted when test case execution finishes
+	CaseFinished EventType = "CaseFinished"
+
+	// CaseSkipped is emitted when test case is not executed
+	CaseSkipped EventType = "CaseSkipped"
+
+	// StepStarted is emitted when test step execution starts
+	StepStarted EventType = "StepStarted"
+
+	// StepFinished is emitted when test step execution finishes
+	StepFinished EventType = "StepFinished"
+
+	// SetupFailed is emitted when test set or test case setup action fails
+	SetupFailed EventType = "SetupFailed"
+
+	// HookFailed is emitted when any of the hooks fails
+	HookFailed EventType = "HookFailed"
+)
+
+// Event represents a single execution event. Only the fields meaningful for the event type are set: for instance, the
+// StepFinished event defines the Set, Case, Step, Status and Duration fields.
+type Event struct {
+
+	// Type is the type of the event
+	Type EventType `json:"type"`
+
+	// Time is the time when the event has occured
+	Time time.Time `json:"time"`
+
+	// Set is the name of the test set
+	Set string `json:"set,omitempty"`
+
+	// Case is the name of the test case
+	Case string `json:"case,omitempty"`
+
+	// Step is the name of the test step
+	Step string `json:"step,omitempty"`
+
+	// Status is the status of the finished test case or step
+	Status TestResult `json:"status,omitempty"`
+
+	// Duration is the duration of the finished test set, case or step
+	Duration time.Duration `json:"duration,omitempty"`
+
+	// Message is an additional message
+	Message string `json:"message,omitempty"`
+}
+
+// EventSink is an interface that receives the execution events.
+type EventSink interface {
+	Emit(Event)
+}
+
+// Private function that timestamps the event and emits it into the given sink; nothing is done when sink is not defined.
+func emit(sink EventSink, e Event) {
+	if sink != nil {
+		e.Time = time.Now()
+		sink.Emit(e)
+	}
+}
+
+// JSONLSink is an EventSink that writes events as JSON lines: one JSON-encoded event per line.
+type JSONLSink struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	err error
+}
+
+// NewJSONLSink creates a new JSONLSink writing to the given writer.
+func NewJSONLSink(w io.Writer) *JSONLSink { return &JSONLSink{enc: json.NewEncoder(w)} }
+
+// Emit writes a single event. After the first write error, all the events are dropped.
+func (s *JSONLSink) Emit(e Event) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err == nil {
+		s.err = s.enc.Encode(e)
+	}
+}
+
+// Err returns the first write error that has occured, if any.
+func (s *JSONLSink) Err() error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
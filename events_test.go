@@ -0,0 +1,70 @@
+package atf
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestEventSequence(t *testing.T) {
+
+	ts := newRecordingSet("/bin/true", []string{"a", "b"})
+	ts.Cases[0].Append(CreateTestStep("failing", "", "Pass", "NotTested", CreateAction("/bin/false", "")))
+	ts.Cases[1].DependsOn = []string{"a"}
+	var buf bytes.Buffer
+	sink := NewJSONLSink(&buf)
+	ts.Events = sink
+	ts.Execute(quietDisplay())
+
+	want := []string{
+		"SetStarted Set",
+		"CaseStarted Set/a",
+		"StepStarted Set/a/step",
+		"StepFinished Set/a/step Pass",
+		"StepStarted Set/a/failing",
+		"StepFinished Set/a/failing Fail",
+		"CaseFinished Set/a Fail",
+		"CaseSkipped Set/b",
+		"SetFinished Set",
+	}
+	got := make([]string, 0)
+	lines := bufio.NewScanner(&buf)
+	for lines.Scan() {
+		var e Event
+		if err := json.Unmarshal(lines.Bytes(), &e); err != nil {
+			t.Fatalf("invalid JSON line %q: %s", lines.Text(), err)
+		}
+		if e.Time.IsZero() {
+			t.Errorf("event %s has no time", e.Type)
+		}
+		s := string(e.Type) + " " + strings.Trim(strings.Join([]string{e.Set, e.Case, e.Step}, "/"), "/")
+		if e.Status != "" {
+			s += " " + string(e.Status)
+		}
+		got = append(got, s)
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("expected events:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+	if sink.Err() != nil {
+		t.Errorf("unexpected sink error: %s", sink.Err())
+	}
+}
+
+// A writer that always fails.
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errors.New("disk full") }
+
+func TestJSONLSinkError(t *testing.T) {
+
+	sink := NewJSONLSink(failingWriter{})
+	sink.Emit(Event{Type: SetStarted})
+	sink.Emit(Event{Type: SetFinished})
+	if err := sink.Err(); err == nil || err.Error() != "disk full" {
+		t.Errorf("expected write error, got %v", err)
+	}
+}
@@ -18,10 +18,18 @@ package atf
  */
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/mraitmaier/atf/utils"
+	"os"
 	"os/exec"
-	//"fmt"
 	"path"
+	"path/filepath"
 	"runtime"
+	"strings"
+	"time"
 )
 
 // ExecDisplayFnCback is an alias for a closure that is used as a parameter of Execute() method of the Executor interface
@@ -29,6 +37,30 @@ import (
 // therefore more or less a log function.
 type ExecDisplayFnCback func(...string)
 
+// NewLevelDisplay creates a display callback that sends the messages to the given log. The message category (the first
+// argument: "error", "warning", "notice", "info"...) is mapped into the log severity (unknown categories are treated as
+// "info") and messages less severe than the given minimum are dropped: e.g. with Notice minimum, the verbose "info"
+// output dumps are suppressed, while with Debug minimum, everything is logged.
+func NewLevelDisplay(log *utils.Log, min utils.Severity) *ExecDisplayFnCback {
+
+	var display ExecDisplayFnCback = func(args ...string) {
+		if len(args) == 0 {
+			return
+		}
+		sev, msg := utils.Informational, strings.Join(args, "")
+		if len(args) > 1 {
+			if s := utils.SeverityFromString(args[0]); s != utils.UnknownSeverity {
+				sev = s
+			}
+			msg = strings.Join(args[1:], "")
+		}
+		if sev <= min {
+			log.Log(sev, msg)
+		}
+	}
+	return &display
+}
+
 // Executor interface defin the Execute() method
 type Executor interface {
 	Execute(ExecDisplayFnCback) string
@@ -61,9 +93,6 @@ const (
 	// TclScript represents a Tcl script
 	TclScript
 
-	// IxiaTclScript represents a Tcl script specialized for Ixia machinery
-	//IxiaTclScript
-
 	// ExpectScript represents an Expect (Tcl) script
 	ExpectScript
 
@@ -81,8 +110,160 @@ const (
 
 	// LuaScript represents a Lua script
 	LuaScript
+
+	// IxiaTclScript represents a Tcl script specialized for Ixia machinery
+	IxiaTclScript
 )
 
+// Return the directory of the virtual environment's executables.
+func (o ExecOptions) virtualEnvBin() string {
+	if runtime.GOOS == "windows" {
+		return filepath.Join(o.VirtualEnv, "Scripts")
+	}
+	return filepath.Join(o.VirtualEnv, "bin")
+}
+
+// Return the python interpreter: the one from the virtual environment, when defined.
+func (o ExecOptions) pythonExec() string {
+	if o.VirtualEnv == "" {
+		return pyExec
+	}
+	return filepath.Join(o.virtualEnvBin(), pyExec)
+}
+
+// Return the environment of the activated virtual environment: the current process' environment with VIRTUAL_ENV set and
+// the environment's executables prepended to PATH. When virtual environment is not defined, nil is returned (the current
+// process' environment is used as is).
+func (o ExecOptions) virtualEnv() []string {
+
+	if o.VirtualEnv == "" {
+		return nil
+	}
+	env := make([]string, 0)
+	for _, kv := range os.Environ() {
+		key := strings.SplitN(kv, "=", 2)[0]
+		if strings.EqualFold(key, "PATH") || key == "VIRTUAL_ENV" || key == "PYTHONHOME" {
+			continue
+		}
+		env = append(env, kv)
+	}
+	pth := o.virtualEnvBin()
+	if p := os.Getenv("PATH"); p != "" {
+		pth += string(os.PathListSeparator) + p
+	}
+	return append(env, "VIRTUAL_ENV="+o.VirtualEnv, "PATH="+pth)
+}
+
+// ExecOptions defines how the scripts/programs are executed; the zero value defines the default behavior. The options are
+// given to the execution methods (see e.g. TestSet.ExecuteWithOptions()) and are passed down to all the executed actions.
+type ExecOptions struct {
+
+	// MaxOutputBytes limits the size of the captured output of the executed script/program; the output beyond the limit
+	// is discarded and the truncation is marked. Zero (the default) means no limit.
+	MaxOutputBytes int64
+
+	// ManualPrompt is used to prompt the operator when manual action is executed; when not defined (default), the manual
+	// actions are not prompted and their results are always "not tested"
+	ManualPrompt ManualPromptFn
+
+	// VirtualEnv defines the Python virtual environment (its root directory) used to run Python scripts: the interpreter
+	// is taken from the environment and the environment is activated for the script, so it doesn't have to be activated
+	// in the shell beforehand. By default, no virtual environment is used
+	VirtualEnv string
+
+	// PlainOutput defines how the execution engine displays the output of the executed scripts/programs: when set, the
+	// output is displayed as is (see FmtOutputPlain()), which is suitable for machine-readable logs; otherwise, it is
+	// wrapped in banner lines (see FmtOutput())
+	PlainOutput bool
+
+	// ArtifactDir defines the directory where the step artifacts are collected after the step is executed: when set,
+	// every artifact is copied into the "<ArtifactDir>/<case>/<step>" directory and its path is updated to the copy. By
+	// default, artifacts are left where they are
+	ArtifactDir string
+
+	// SutPingTimeout defines how long to wait for the SUT to respond when its reachability is checked (see
+	// TestSet.PingSut); DefaultPingTimeout, when not defined
+	SutPingTimeout time.Duration
+
+	// IxiaTclExec defines the interpreter used for Ixia Tcl scripts (with ".ixiatcl" extension); it should be set to the
+	// Ixia-aware tclsh (the one with Ixia packages available) installed on the machine. By default, the plain tclsh is used
+	IxiaTclExec string
+}
+
+// Return the SUT ping timeout: the default one, when not defined.
+func (o ExecOptions) sutPingTimeout() time.Duration {
+	if o.SutPingTimeout <= 0 {
+		return DefaultPingTimeout
+	}
+	return o.SutPingTimeout
+}
+
+// Return the Ixia Tcl interpreter: the plain tclsh, when not defined.
+func (o ExecOptions) ixiaTclExec() string {
+	if o.IxiaTclExec == "" {
+		return tclExec
+	}
+	return o.IxiaTclExec
+}
+
+// limitedBuffer is a writer capturing the output up to the given limit; it counts all the bytes written.
+type limitedBuffer struct {
+	buf   bytes.Buffer
+	max   int64
+	total int64
+}
+
+// Write implements the io.Writer interface; the write always succeeds, so the program is not disturbed by the limit.
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+
+	n := int64(len(p))
+	if b.max <= 0 {
+		b.buf.Write(p)
+	} else if room := b.max - b.total; room > 0 {
+		if n > room {
+			b.buf.Write(p[:room])
+		} else {
+			b.buf.Write(p)
+		}
+	}
+	b.total += n
+	return len(p), nil
+}
+
+// String returns the captured output, with truncation marker appended when the output has been truncated.
+func (b *limitedBuffer) String() string {
+
+	if b.max > 0 && b.total > b.max {
+		return fmt.Sprintf("%s\n[output truncated: %d bytes total]\n", b.buf.String(), b.total)
+	}
+	return b.buf.String()
+}
+
+// Private function that returns the given context or, when not defined, the background context.
+func orBackground(ctx context.Context) context.Context {
+	if ctx == nil {
+		return context.Background()
+	}
+	return ctx
+}
+
+// Format the output text from script/program according to the PlainOutput option.
+func (o ExecOptions) formatOutput(out string) string {
+	if o.PlainOutput {
+		return FmtOutputPlain(out)
+	}
+	return FmtOutput(out)
+}
+
+// FmtOutputPlain formats the output text from script/program without any decoration: only the terminating newline is
+// added, when missing.
+func FmtOutputPlain(o string) string {
+	if o == "" || strings.HasSuffix(o, "\n") {
+		return o
+	}
+	return o + "\n"
+}
+
 // FmtOutput formats the output text from script/program.
 func FmtOutput(o string) string {
 	s := "Displaying output:\n################### OUTPUT ##################\n"
@@ -94,15 +275,20 @@ func FmtOutput(o string) string {
 // Function execute is a private function that actually executes the given script/program and returns the output and/or error code.
 //
 // Input:
+//       ctx - a context; execution is aborted when it is done
 //       exe - an interpreter for given script or program to be executed
 //      args - arguments to the interpreter as slice of string; the script
 //          name is always included, of course. Any additional argument are to
 //          be a part of this slice.
+//     stdin - a text fed to the standard input; may be empty
+//       env - an environment of the process; when nil, the current process' environment is used
+//      opts - the execution options
 //
 // Returns:
 //      output - is the text output from the executed script/program
 //         err - error code; if everything is OK, it should be nil
-func execute(exe string, args []string) (output string, err error) {
+func execute(ctx context.Context, exe string, args []string, stdin string, env []string, opts ExecOptions) (output string,
+	err error) {
 
 	output = ""
 	// simple error check
@@ -111,29 +297,78 @@ func execute(exe string, args []string) (output string, err error) {
 		return
 	}
 
+	// interpreter (or executable) must be available
+	if _, e := exec.LookPath(exe); e != nil {
+		err = WrapInterpreterNotFound(e, exe)
+		return
+	}
+
 	// prepare data for execution
-	cmd := exec.Command(exe, args...)
+	cmd := exec.CommandContext(ctx, exe, args...)
 	if cmd == nil {
 		return
 	}
 
-	// run the command and wait for output text from STDIN and STDERR combined
-	var out []byte
-	out, err = cmd.CombinedOutput()
-	output = string(out)
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+	cmd.Env = env
+
+	// run the command and wait for output text from STDOUT and STDERR combined
+	out := &limitedBuffer{max: opts.MaxOutputBytes}
+	cmd.Stdout = out
+	cmd.Stderr = out
+	err = cmd.Run()
+	output = out.String()
+	// non-zero exit status is reported as is, cancelled execution as timeout, other errors are wrapped
+	if err != nil {
+		if ctx.Err() != nil {
+			err = WrapExecTimeout(ctx.Err(), exe)
+		} else if _, ok := err.(*exec.ExitError); !ok {
+			err = WrapInvalidValue(err, exe)
+		}
+	}
 	return
 }
 
+// A private function that extracts the exit code from the error returned by the execution.
+//
+// Input:
+//      err - an error returned by the execution of the script/program
+//
+// Returns:
+//      the exit code; 0 when there's no error and -1 when the script/program
+//      has not been run at all
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var e *exec.ExitError
+	if errors.As(err, &e) {
+		return e.ExitCode()
+	}
+	return -1
+}
+
+// A private function that checks whether the error returned by the execution is operational: the script/program could
+// not be executed properly (interpreter not found, execution timed out, invalid script...) rather than it has failed.
+func operationalError(err error) bool {
+	return errors.Is(err, ErrorInterpreterNotFound) || errors.Is(err, ErrorExecTimeout) || errors.Is(err, ErrorInvalidValue) ||
+		errors.Is(err, ErrorConnectionFailed)
+}
+
 // A private function that prepares arguments for executing the JARs.
 //
 // Input:
 //      jar  - a java JAR to be run
 //      args - additional arguments for the JAR as a slice of strings
+//      stdin - a text fed to the standard input; may be empty
+//      opts - the execution options
 //
 // Returns:
 //      out - is the text output from the executed script/program
 //      err - error code; if everything is OK, it should be nil
-func executeJava(jar string, args []string) (out string, err error) {
+func executeJava(ctx context.Context, jar string, args []string, stdin string, opts ExecOptions) (out string, err error) {
 	realargs := make([]string, len(args)+3)
 	realargs[0] = "-jar"
 	realargs[1] = jar
@@ -142,7 +377,7 @@ func executeJava(jar string, args []string) (out string, err error) {
 			realargs[ix+3] = val
 		} // for
 	} // if
-	out, err = execute(javaExec, realargs)
+	out, err = execute(ctx, javaExec, realargs, stdin, nil, opts)
 	return out, err
 }
 
@@ -152,11 +387,15 @@ func executeJava(jar string, args []string) (out string, err error) {
 //      exe - an executable that'll run the script (interpreter)
 //      script  - a python script to be run
 //      args - additional arguments for the script as a slice of strings
+//      stdin - a text fed to the standard input; may be empty
+//      env - an environment of the process; may be nil
+//      opts - the execution options
 //
 // Returns:
 //      out - is the text output from the executed script/program
 //      err - error code; if everything is OK, it should be nil
-func executeScript(exe string, script string, args []string) (out string, err error) {
+func executeScript(ctx context.Context, exe string, script string, args []string, stdin string, env []string,
+	opts ExecOptions) (out string, err error) {
 	// we need to insert an empty string before our args for python script to
 	// run properly
 	realargs := make([]string, len(args)+2)
@@ -166,7 +405,7 @@ func executeScript(exe string, script string, args []string) (out string, err er
 			realargs[ix+2] = val
 		} // for
 	} // if
-	out, err = execute(exe, realargs)
+	out, err = execute(ctx, exe, realargs, stdin, env, opts)
 	return out, err
 }
 
@@ -190,6 +429,8 @@ func determineType(scr string) ScriptType {
 		t = PerlScript
 	case ".tcl":
 		t = TclScript
+	case ".ixiatcl":
+		t = IxiaTclScript
 	case ".exp":
 		t = ExpectScript
 	case ".rb":
@@ -204,6 +445,107 @@ func determineType(scr string) ScriptType {
 	return t
 }
 
+// Function executeJavaClass is a private function that runs the given Java main class using the given classpath (omitted
+// when empty): "java -cp <classpath> <mainClass> <args>".
+func executeJavaClass(ctx context.Context, cp, mainClass string, args []string, stdin string, opts ExecOptions) (string,
+	error) {
+	return execute(ctx, javaExec, javaClassArgs(cp, mainClass, args), stdin, nil, opts)
+}
+
+// Private function that builds the argument vector for java executing the given main class.
+func javaClassArgs(cp, mainClass string, args []string) []string {
+
+	realargs := make([]string, 0, len(args)+3)
+	if cp != "" {
+		realargs = append(realargs, "-cp", cp)
+	}
+	realargs = append(realargs, mainClass)
+	return append(realargs, args...)
+}
+
+// Return the interpreter needed to run the script of the given type; for native executables, the script itself is returned.
+// Empty string is returned for unknown script types.
+func (o ExecOptions) interpreter(t ScriptType, script string) string {
+
+	switch t {
+	case PythonScript:
+		return o.pythonExec()
+	case PerlScript:
+		return plExec
+	case TclScript:
+		return tclExec
+	case IxiaTclScript:
+		return o.ixiaTclExec()
+	case ExpectScript:
+		// expect on Win is only a TCL extension, not the separate interpreter
+		if runtime.GOOS == "windows" {
+			return tclExec
+		}
+		return expExec
+	case NativeExecutable:
+		return script
+	case JavaExecutable:
+		return javaExec
+	case RubyScript:
+		return rubyExec
+	case GroovyScript:
+		return groovyExec
+	}
+	return ""
+}
+
+// CheckInterpreters checks whether the interpreters needed by all the executable actions of the given test set are
+// available (in PATH) and returns a list of errors, one for every missing interpreter; the list is empty when everything
+// can be executed. Scripts of unknown type are reported, too. Assertions are evaluated in-process and remote actions are
+// executed on the remote host, so they are not checked.
+func CheckInterpreters(ts *TestSet) []error { return ExecOptions{}.CheckInterpreters(ts) }
+
+// CheckInterpreters checks the interpreters the same way as the package-level CheckInterpreters() does, using the options
+// (e.g. the Python interpreter is taken from the virtual environment, when defined).
+func (o ExecOptions) CheckInterpreters(ts *TestSet) []error {
+
+	errs := make([]error, 0)
+	checked := make(map[string]bool)
+	check := func(a *Action) {
+		if !a.IsExecutable() || a.Assert != nil || a.Remote != nil {
+			return
+		}
+		exe := o.interpreter(determineType(a.Script), a.Script)
+		if a.MainClass != "" {
+			exe = javaExec
+		}
+		if exe == "" {
+			errs = append(errs, fmt.Errorf("%w: %q: unknown script type", ErrorInvalidValue, a.Script))
+			return
+		}
+		if checked[exe] {
+			return
+		}
+		checked[exe] = true
+		if _, err := exec.LookPath(exe); err != nil {
+			errs = append(errs, WrapInterpreterNotFound(err, exe))
+		}
+	}
+
+	check(ts.Setup)
+	check(ts.Cleanup)
+	for _, hooks := range [][]*Action{ts.BeforeAll, ts.AfterAll} {
+		for _, hook := range hooks {
+			check(hook)
+		}
+	}
+	for _, tc := range ts.Cases {
+		check(tc.Setup)
+		check(tc.Cleanup)
+		check(tc.BeforeEach)
+		check(tc.AfterEach)
+		for _, step := range tc.Steps {
+			check(step.Action)
+		}
+	}
+	return errs
+}
+
 // Execute executes the given script/program and returns the text output of the command (STDOUT & STDERR) and error code
 // if something goes wrong.
 //
@@ -215,6 +557,25 @@ func determineType(scr string) ScriptType {
 //      output - is the text output from the executed script/program
 //         err - error code; if everything is OK, it should be nil
 func Execute(script string, args []string) (output string, err error) {
+	return ExecuteWithInput(script, args, "")
+}
+
+// ExecuteWithInput executes the given script/program the same way as Execute() does, additionally feeding the given text
+// to its standard input.
+func ExecuteWithInput(script string, args []string, stdin string) (output string, err error) {
+	return ExecuteContext(context.Background(), script, args, stdin)
+}
+
+// ExecuteContext executes the given script/program the same way as ExecuteWithInput() does; the execution is aborted when
+// the given context is done (cancelled or its deadline is exceeded) and ErrorExecTimeout is returned.
+func ExecuteContext(ctx context.Context, script string, args []string, stdin string) (output string, err error) {
+	return ExecuteWithOptions(ctx, script, args, stdin, ExecOptions{})
+}
+
+// ExecuteWithOptions executes the given script/program the same way as ExecuteContext() does, using the given execution
+// options.
+func ExecuteWithOptions(ctx context.Context, script string, args []string, stdin string, opts ExecOptions) (output string,
+	err error) {
 
 	var scrtype ScriptType
 
@@ -222,27 +583,29 @@ func Execute(script string, args []string) (output string, err error) {
 
 	switch scrtype {
 	case PythonScript:
-		output, err = executeScript(pyExec, script, args)
+		output, err = executeScript(ctx, opts.pythonExec(), script, args, stdin, opts.virtualEnv(), opts)
 	case PerlScript:
-		output, err = executeScript(plExec, script, args)
+		output, err = executeScript(ctx, plExec, script, args, stdin, nil, opts)
 	case TclScript:
-		output, err = executeScript(tclExec, script, args)
+		output, err = executeScript(ctx, tclExec, script, args, stdin, nil, opts)
+	case IxiaTclScript:
+		output, err = executeScript(ctx, opts.ixiaTclExec(), script, args, stdin, nil, opts)
 	case ExpectScript:
 		// if we execute the script on WinXY, expect scripts are treated as
 		// the TCL scripts; expect on Win is only a TCL extension, not the
 		// separate interpreter
 		if runtime.GOOS == "windows" {
-			output, err = executeScript(tclExec, script, args)
+			output, err = executeScript(ctx, tclExec, script, args, stdin, nil, opts)
 		}
-		output, err = executeScript(expExec, script, args)
+		output, err = executeScript(ctx, expExec, script, args, stdin, nil, opts)
 	case NativeExecutable:
-		output, err = execute(script, args)
+		output, err = execute(ctx, script, args, stdin, nil, opts)
 	case JavaExecutable:
-		output, err = executeJava(script, args)
+		output, err = executeJava(ctx, script, args, stdin, opts)
 	case RubyScript:
-		output, err = executeScript(rubyExec, script, args)
+		output, err = executeScript(ctx, rubyExec, script, args, stdin, nil, opts)
 	case GroovyScript:
-		output, err = executeScript(groovyExec, script, args)
+		output, err = executeScript(ctx, groovyExec, script, args, stdin, nil, opts)
 	default:
 		output = "XXX: Invalid output"
 		err = ErrorInvalidValue
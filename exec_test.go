@@ -0,0 +1,481 @@
+package atf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/mraitmaier/atf/utils"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestExecuteWithInput(t *testing.T) {
+
+	// a script that reads its input line by line and writes it in upper case
+	script := filepath.Join(t.TempDir(), "upper")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\nwhile read -r line; do echo \"$line\" | tr a-z A-Z; done\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		script string
+		stdin  string
+		want   string
+	}{
+		{"/bin/cat", "payload", "payload"},
+		{"/bin/cat", "first line\nsecond line\n", "first line\nsecond line\n"},
+		{"/bin/cat", "", ""},
+		{script, "first\nsecond\n", "FIRST\nSECOND\n"},
+	}
+	for _, tt := range tests {
+		out, err := ExecuteWithInput(tt.script, nil, tt.stdin)
+		if err != nil || out != tt.want {
+			t.Errorf("%s with input %q: got %q, %v; want %q", tt.script, tt.stdin, out, err, tt.want)
+		}
+	}
+}
+
+func TestCollectStdin(t *testing.T) {
+
+	dir := t.TempDir()
+	tests := []struct {
+		name string
+		text string
+	}{
+		{"set.txt", "set: S\ncase: C\nstep: s\naction: /bin/cat\nstdin: payload\n"},
+		{"set.yaml", "name: S\ncases:\n  - name: C\n    steps:\n      - name: s\n        action: {script: /bin/cat, stdin: payload}\n"},
+		{"set.json", `{"Name": "S", "Cases": [{"Name": "C", "Steps": [{"Name": "s", "Action": {"Script": "/bin/cat", "Stdin": "payload"}}]}]}`},
+		{"set.xml", `<TestSet name="S"><Cases><TestCase name="C"><Steps><TestStep name="s">` +
+			`<Action><Script>/bin/cat</Script><Stdin>payload</Stdin></Action></TestStep></Steps></TestCase></Cases></TestSet>`},
+	}
+	for _, tt := range tests {
+		ts, err := Collect(writeConfig(t, dir, tt.name, tt.text))
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		ts.Execute(quietDisplay())
+		step := ts.Cases[0].Steps[0]
+		if step.Action.Stdin != "payload" || step.Output != "payload" || step.Status != "Pass" {
+			t.Errorf("%s: got stdin %q, output %q and status %s", tt.name, step.Action.Stdin, step.Output, step.Status)
+		}
+	}
+}
+
+func TestLimitedBuffer(t *testing.T) {
+
+	tests := []struct {
+		max    int64
+		writes []string
+		want   string
+	}{
+		{0, []string{"abc", "def"}, "abcdef"},
+		{6, []string{"abc", "def"}, "abcdef"},
+		{4, []string{"abc", "def"}, "abcd\n[output truncated: 6 bytes total]\n"},
+		{2, []string{"abc", "def"}, "ab\n[output truncated: 6 bytes total]\n"},
+		{3, []string{"abc", "", "d"}, "abc\n[output truncated: 4 bytes total]\n"},
+		{5, nil, ""},
+	}
+	for _, tt := range tests {
+		b := &limitedBuffer{max: tt.max}
+		for _, w := range tt.writes {
+			if n, err := b.Write([]byte(w)); n != len(w) || err != nil {
+				t.Errorf("max %d: Write(%q) = %d, %v", tt.max, w, n, err)
+			}
+		}
+		if got := b.String(); got != tt.want {
+			t.Errorf("max %d, writes %q: got %q, want %q", tt.max, tt.writes, got, tt.want)
+		}
+	}
+}
+
+func TestExecuteMaxOutput(t *testing.T) {
+
+	// a script producing 1 MiB of output to stdout and a line to stderr
+	const size = 1 << 20
+	script := filepath.Join(t.TempDir(), "flood")
+	text := fmt.Sprintf("#!/bin/sh\nhead -c %d /dev/zero | tr '\\0' x\necho error >&2\n", size)
+	if err := os.WriteFile(script, []byte(text), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		max  int64
+		want string
+	}{
+		{0, strings.Repeat("x", size) + "error\n"},
+		{size + 6, strings.Repeat("x", size) + "error\n"},
+		{10, strings.Repeat("x", 10) + fmt.Sprintf("\n[output truncated: %d bytes total]\n", size+6)},
+		{size + 2, strings.Repeat("x", size) + fmt.Sprintf("er\n[output truncated: %d bytes total]\n", size+6)},
+	}
+	for _, tt := range tests {
+		out, err := ExecuteWithOptions(context.Background(), script, nil, "", ExecOptions{MaxOutputBytes: tt.max})
+		if err != nil || out != tt.want {
+			t.Errorf("max %d: got %d bytes (%q...), %v; want %d bytes", tt.max, len(out), out[:min(len(out), 20)], err,
+				len(tt.want))
+		}
+	}
+
+	// the limit is passed down to the executed steps
+	ts := newRecordingSet(script, []string{"a"})
+	ts.ExecuteWithOptions(quietDisplay(), ExecOptions{MaxOutputBytes: 10})
+	if step := ts.Cases[0].Steps[0]; !strings.HasSuffix(step.Output, "[output truncated: 1048582 bytes total]\n") ||
+		step.Status != "Pass" {
+		t.Errorf("step output has not been truncated: %q (%s)", step.Output, step.Status)
+	}
+}
+
+func TestCheckInterpreters(t *testing.T) {
+
+	// create a test set with a case holding a step for every given action
+	set := func(actions ...*Action) *TestSet {
+		ts := CreateTestSet("Set", "", nil, nil, nil)
+		tc := CreateTestCase("Case", "", nil, nil, "Pass", "NotTested")
+		for _, a := range actions {
+			tc.Append(CreateTestStep("Step", "", "Pass", "NotTested", a))
+		}
+		ts.Append(tc)
+		return ts
+	}
+	remote := CreateAction("bogus-remote-tool", "")
+	remote.Remote = &SSHConfig{Host: "10.0.0.1", User: "admin"}
+	hooked := set(CreateAction("/bin/true", ""))
+	hooked.Setup, hooked.AfterAll = CreateAction("/missing/setup", ""), []*Action{CreateAction("/missing/after", "")}
+	hooked.Cases[0].BeforeEach = CreateAction("/missing/before-each", "")
+
+	tests := []struct {
+		name    string
+		ts      *TestSet
+		opts    ExecOptions
+		missing []string
+	}{
+		{"available", set(CreateAction("/bin/true", ""), CreateAction("/bin/true", "-v")), ExecOptions{}, nil},
+		{"not executable", set(CreateManualAction("Press the button"), CreateEmptyAction(), remote,
+			CreateAssertAction(AssertEquals, "1", "1")), ExecOptions{}, nil},
+		{"bogus interpreter", set(CreateAction("test.ixiatcl", ""), CreateAction("other.ixiatcl", "")),
+			ExecOptions{IxiaTclExec: "bogus-ixia-tclsh"}, []string{"bogus-ixia-tclsh"}},
+		{"missing executable", set(CreateAction("/missing/tool", ""), CreateAction("/bin/true", "")), ExecOptions{},
+			[]string{"/missing/tool"}},
+		{"unknown script type", set(CreateAction("script.unknown", "")), ExecOptions{}, []string{"unknown script type"}},
+		{"virtual environment", set(CreateAction("test.py", "")), ExecOptions{VirtualEnv: "/missing/venv"},
+			[]string{filepath.Join("/missing/venv", "bin", "python")}},
+		{"hooks", hooked, ExecOptions{}, []string{"/missing/setup", "/missing/after", "/missing/before-each"}},
+	}
+	for _, tt := range tests {
+		errs := tt.opts.CheckInterpreters(tt.ts)
+		if len(errs) != len(tt.missing) {
+			t.Errorf("%s: expected %d errors, got %v", tt.name, len(tt.missing), errs)
+			continue
+		}
+		for ix, err := range errs {
+			if !strings.Contains(err.Error(), tt.missing[ix]) {
+				t.Errorf("%s: error %q does not mention %q", tt.name, err, tt.missing[ix])
+			}
+			if !strings.Contains(tt.missing[ix], "unknown") && !errors.Is(err, ErrorInterpreterNotFound) {
+				t.Errorf("%s: unexpected error %v", tt.name, err)
+			}
+		}
+	}
+	if errs := CheckInterpreters(set(CreateAction("/bin/true", ""))); len(errs) != 0 {
+		t.Errorf("unexpected errors %v", errs)
+	}
+}
+
+func TestJavaClassArgs(t *testing.T) {
+
+	tests := []struct {
+		cp, mainClass string
+		args          []string
+		want          string
+	}{
+		{"lib.jar:classes", "org.example.Main", []string{"-v", "10.0.0.1"},
+			"-cp lib.jar:classes org.example.Main -v 10.0.0.1"},
+		{"lib.jar", "Main", nil, "-cp lib.jar Main"},
+		{"", "org.example.Main", []string{"x"}, "org.example.Main x"},
+		{"", "Main", nil, "Main"},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(javaClassArgs(tt.cp, tt.mainClass, tt.args), " "); got != tt.want {
+			t.Errorf("%q, %q, %q: expected %q, got %q", tt.cp, tt.mainClass, tt.args, tt.want, got)
+		}
+	}
+}
+
+func TestJavaClassAction(t *testing.T) {
+
+	// a fake java printing its arguments, one per line
+	dir := t.TempDir()
+	script := "#!/bin/sh\nfor a in \"$@\"; do echo \"$a\"; done\n"
+	if err := os.WriteFile(filepath.Join(dir, "java"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	tests := []struct {
+		action *Action
+		want   string
+	}{
+		{CreateJavaClassAction("lib.jar:classes", "org.example.Main", "-v 10.0.0.1"),
+			"-cp\nlib.jar:classes\norg.example.Main\n-v\n10.0.0.1\n"},
+		{CreateJavaClassAction("", "Main", ""), "Main\n"},
+	}
+	for _, tt := range tests {
+		if out := tt.action.Execute(); out != tt.want || tt.action.Result != "Pass" {
+			t.Errorf("%s: got %q (%s), want %q", tt.action.String(), out, tt.action.Result, tt.want)
+		}
+		ts := newReportSet(CreateTestStep("Step", "", "Pass", "NotTested", tt.action))
+		if errs := CheckInterpreters(ts); len(errs) != 0 {
+			t.Errorf("%s: unexpected errors %v", tt.action.String(), errs)
+		}
+	}
+}
+
+func TestDetermineType(t *testing.T) {
+
+	tests := []struct {
+		script      string
+		typ         ScriptType
+		interpreter string
+	}{
+		{"traffic.ixiatcl", IxiaTclScript, "ixia-tclsh"},
+		{"/opt/tests/traffic.ixiatcl", IxiaTclScript, "ixia-tclsh"},
+		{"check.tcl", TclScript, "tclsh"},
+		{"login.exp", ExpectScript, "expect"},
+		{"check.py", PythonScript, "python"},
+		{"check.pl", PerlScript, "perl"},
+		{"check.rb", RubyScript, "ruby"},
+		{"check.groovy", GroovyScript, "groovy"},
+		{"check.jar", JavaExecutable, "java"},
+		{"/bin/true", NativeExecutable, "/bin/true"},
+		{"check.exe", NativeExecutable, "check.exe"},
+		{"check.ixia", UnknownScript, ""},
+		{"check.TCL", UnknownScript, ""},
+	}
+	for _, tt := range tests {
+		if got := determineType(tt.script); got != tt.typ {
+			t.Errorf("%s: expected type %d, got %d", tt.script, tt.typ, got)
+		}
+		if tt.typ == ExpectScript && runtime.GOOS == "windows" {
+			continue
+		}
+		if got := (ExecOptions{IxiaTclExec: "ixia-tclsh"}).interpreter(tt.typ, tt.script); got != tt.interpreter {
+			t.Errorf("%s: expected interpreter %q, got %q", tt.script, tt.interpreter, got)
+		}
+	}
+}
+
+func TestIxiaTclInterpreter(t *testing.T) {
+
+	if exe := (ExecOptions{}).interpreter(IxiaTclScript, "traffic.ixiatcl"); exe != "tclsh" {
+		t.Errorf("the plain tclsh should be the default Ixia interpreter, got %q", exe)
+	}
+
+	// a fake Ixia-aware interpreter printing the script it runs
+	opts := ExecOptions{IxiaTclExec: filepath.Join(t.TempDir(), "ixia-tclsh")}
+	if err := os.WriteFile(opts.IxiaTclExec, []byte("#!/bin/sh\necho \"ixia $1\"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		script string
+		want   string
+	}{
+		{"traffic.ixiatcl", "ixia traffic.ixiatcl\n"},
+		{"/opt/tests/traffic.ixiatcl", "ixia /opt/tests/traffic.ixiatcl\n"},
+	}
+	for _, tt := range tests {
+		out, err := ExecuteWithOptions(context.Background(), tt.script, []string{"-port", "1"}, "", opts)
+		if out != tt.want || err != nil {
+			t.Errorf("%s: got %q, %v; want %q", tt.script, out, err, tt.want)
+		}
+	}
+}
+
+func TestVirtualEnv(t *testing.T) {
+
+	t.Setenv("PATH", "/usr/bin:/bin")
+	t.Setenv("VIRTUAL_ENV", "/other/venv")
+	t.Setenv("PYTHONHOME", "/usr/lib/python")
+	t.Setenv("ATF_TEST", "kept")
+
+	tests := []struct {
+		venv   string
+		python string
+		env    map[string]string
+	}{
+		{"", "python", nil},
+		{"/opt/venv", "/opt/venv/bin/python",
+			map[string]string{"VIRTUAL_ENV": "/opt/venv", "PATH": "/opt/venv/bin:/usr/bin:/bin", "PYTHONHOME": "",
+				"ATF_TEST": "kept"}},
+	}
+	for _, tt := range tests {
+		opts := ExecOptions{VirtualEnv: tt.venv}
+		if got := opts.pythonExec(); got != tt.python {
+			t.Errorf("%q: expected interpreter %q, got %q", tt.venv, tt.python, got)
+		}
+		env := opts.virtualEnv()
+		if tt.env == nil {
+			if env != nil {
+				t.Errorf("%q: expected the process environment, got %v", tt.venv, env)
+			}
+			continue
+		}
+		got := make(map[string]string)
+		for _, kv := range env {
+			key, val, _ := strings.Cut(kv, "=")
+			if _, dup := got[key]; dup {
+				t.Errorf("%q: duplicate variable %q", tt.venv, key)
+			}
+			got[key] = val
+		}
+		for key, val := range tt.env {
+			if got[key] != val {
+				t.Errorf("%q: expected %s=%q, got %q", tt.venv, key, val, got[key])
+			}
+		}
+	}
+}
+
+func TestVirtualEnvExecute(t *testing.T) {
+
+	// a fake virtual environment with python printing the environment it runs in
+	venv := t.TempDir()
+	python := "#!/bin/sh\necho \"$VIRTUAL_ENV\"\necho \"${PATH%%:*}\"\necho \"$1\"\n"
+	if err := os.MkdirAll(filepath.Join(venv, "bin"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(venv, "bin", "python"), []byte(python), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	ts := newReportSet(CreateTestStep("Step", "", "Pass", "NotTested", CreateAction("check.py", "")))
+	ts.ExecuteWithOptions(quietDisplay(), ExecOptions{VirtualEnv: venv})
+	want := fmt.Sprintf("%s\n%s\ncheck.py\n", venv, filepath.Join(venv, "bin"))
+	if step := ts.Cases[0].Steps[0]; step.Output != want || step.Status != "Pass" {
+		t.Errorf("got %q (%s), want %q", step.Output, step.Status, want)
+	}
+}
+
+func TestFmtOutput(t *testing.T) {
+	banner := "Displaying output:\n################### OUTPUT ##################\n"
+	end := "################ OUTPUT END #################\n"
+	tests := []struct {
+		name  string
+		in    string
+		plain string
+	}{
+		{"empty", "", ""},
+		{"no newline", "text", "text\n"},
+		{"newline", "text\n", "text\n"},
+		{"multi-line", "one\ntwo\n", "one\ntwo\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FmtOutputPlain(tt.in); got != tt.plain {
+				t.Errorf("FmtOutputPlain(%q) = %q, want %q", tt.in, got, tt.plain)
+			}
+			if got := (ExecOptions{PlainOutput: true}).formatOutput(tt.in); got != tt.plain {
+				t.Errorf("plain formatOutput(%q) = %q, want %q", tt.in, got, tt.plain)
+			}
+			want := banner + tt.in + end
+			if got := FmtOutput(tt.in); got != want {
+				t.Errorf("FmtOutput(%q) = %q, want %q", tt.in, got, want)
+			}
+			if got := (ExecOptions{}).formatOutput(tt.in); got != want {
+				t.Errorf("formatOutput(%q) = %q, want %q", tt.in, got, want)
+			}
+		})
+	}
+}
+
+func TestNewLevelDisplay(t *testing.T) {
+
+	messages := [][]string{
+		{"error", "failed\n"},
+		{"warning", "careful\n"},
+		{"notice", "step started\n"},
+		{"info", "output dump\n"},
+		{"debug", "details\n"},
+		{"bogus", "unknown category\n"},
+		{"no category\n"},
+		{},
+	}
+	all := []string{"ERROR failed", "WARNING careful", "NOTICE step started", "INFO output dump", "DEBUG details",
+		"INFO unknown category", "INFO no category"}
+	tests := []struct {
+		name string
+		min  utils.Severity
+		want []string
+	}{
+		{"quiet", utils.Error, all[:1]},
+		{"notice", utils.Notice, all[:3]},
+		{"info", utils.Informational, []string{all[0], all[1], all[2], all[3], all[5], all[6]}},
+		{"debug", utils.Debug, all},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := filepath.Join(t.TempDir(), "display.log")
+			h, err := utils.NewFileHandler(name, "%[2]s %[3]s", utils.Debug)
+			if err != nil {
+				t.Fatal(err)
+			}
+			log := utils.NewLog()
+			log.AddHandler(h)
+			if err := log.Start(); err != nil {
+				t.Fatal(err)
+			}
+			disp := *NewLevelDisplay(log, tt.min)
+			for _, msg := range messages {
+				disp(msg...)
+			}
+			log.Close()
+
+			text, err := os.ReadFile(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Split(strings.TrimSpace(string(text)), "\n"); strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("expected messages:\n%s\ngot:\n%s", strings.Join(tt.want, "\n"), text)
+			}
+		})
+	}
+}
+
+func TestNewLevelDisplayExecution(t *testing.T) {
+
+	tests := []struct {
+		min  utils.Severity
+		dump bool
+	}{
+		{utils.Notice, false},
+		{utils.Informational, true},
+	}
+	for _, tt := range tests {
+		name := filepath.Join(t.TempDir(), "display.log")
+		h, err := utils.NewFileHandler(name, "%[3]s", utils.Debug)
+		if err != nil {
+			t.Fatal(err)
+		}
+		log := utils.NewLog()
+		log.AddHandler(h)
+		if err := log.Start(); err != nil {
+			t.Fatal(err)
+		}
+		ts := newReportSet(CreateTestStep("Step", "", "Pass", "NotTested", CreateAction("/bin/echo", "hello")))
+		ts.Execute(NewLevelDisplay(log, tt.min))
+		log.Close()
+
+		text, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(text), "Test step evaluated to") {
+			t.Errorf("%s: notices are missing:\n%s", tt.min, text)
+		}
+		if strings.Contains(string(text), "OUTPUT") != tt.dump {
+			t.Errorf("%s: unexpected output dump:\n%s", tt.min, text)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+// Package mongostore implements the atf.ReportStore storing the test reports into MongoDB.
+package mongostore
+
+/*
+ * mongostore.go - persistence of the test reports in MongoDB
+ *
+ * The MongoDB driver is kept out of the atf package: the reports are encoded
+ * with the BSON registry defined here, which knows how to encode the types
+ * (e.g. the topology) that cannot be encoded by the default registry.
+ */
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/mraitmaier/atf"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Registry is a BSON registry encoding and decoding the atf types; the topology is encoded the same way as in YAML.
+var Registry = newRegistry()
+
+// Create the BSON registry with the topology codec registered.
+func newRegistry() *bson.Registry {
+
+	reg := bson.NewRegistry()
+	typ := reflect.TypeOf(atf.Topology{})
+	reg.RegisterTypeEncoder(typ, bson.ValueEncoderFunc(encodeTopology))
+	reg.RegisterTypeDecoder(typ, bson.ValueDecoderFunc(decodeTopology))
+	return reg
+}
+
+// Encode the topology: its devices (of different types) are encoded the same way as they are decoded.
+func encodeTopology(ec bson.EncodeContext, vw bson.ValueWriter, val reflect.Value) error {
+
+	t := reflect.New(val.Type())
+	t.Elem().Set(val)
+	data, err := t.Interface().(*atf.Topology).MarshalYAML()
+	if err != nil {
+		return err
+	}
+	enc, err := ec.LookupEncoder(reflect.TypeOf(data))
+	if err != nil {
+		return err
+	}
+	return enc.EncodeValue(ec, vw, reflect.ValueOf(data))
+}
+
+// Decode the topology from the document encoded by encodeTopology().
+func decodeTopology(dc bson.DecodeContext, vr bson.ValueReader, val reflect.Value) error {
+
+	var raw bson.Raw
+	dec, err := dc.LookupDecoder(reflect.TypeOf(raw))
+	if err != nil {
+		return err
+	}
+	if err := dec.DecodeValue(dc, vr, reflect.ValueOf(&raw).Elem()); err != nil {
+		return err
+	}
+	var t atf.Topology
+	if err := t.UnmarshalYAML(func(v interface{}) error { return bson.Unmarshal(raw, v) }); err != nil {
+		return err
+	}
+	val.Set(reflect.ValueOf(t))
+	return nil
+}
+
+// Marshal marshals the given value (e.g. the test report) into BSON document using the Registry.
+func Marshal(v interface{}) (bson.Raw, error) {
+
+	buf := new(bytes.Buffer)
+	enc := bson.NewEncoder(bson.NewDocumentWriter(buf))
+	enc.SetRegistry(Registry)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bson.Raw(buf.Bytes()), nil
+}
+
+// Unmarshal unmarshals the given BSON document into value (e.g. the test report) using the Registry.
+func Unmarshal(doc []byte, v interface{}) error {
+
+	dec := bson.NewDecoder(bson.NewDocumentReader(bytes.NewReader(doc)))
+	dec.SetRegistry(Registry)
+	return dec.Decode(v)
+}
+
+// ReportStore is an atf.ReportStore storing the test reports into MongoDB collection.
+type ReportStore struct {
+
+	// Collection is a MongoDB collection holding the reports
+	Collection *mongo.Collection
+
+	// Timeout limits the duration of a single DB operation (no limit, when zero)
+	Timeout time.Duration
+}
+
+var _ atf.ReportStore = (*ReportStore)(nil)
+
+// NewReportStore creates a new ReportStore using the given collection.
+func NewReportStore(coll *mongo.Collection, timeout time.Duration) *ReportStore {
+	return &ReportStore{Collection: coll, Timeout: timeout}
+}
+
+// Return a context for a single DB operation.
+func (s *ReportStore) context() (context.Context, context.CancelFunc) {
+
+	if s.Timeout > 0 {
+		return context.WithTimeout(context.Background(), s.Timeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// Save stores the given report into collection: existing report (with the same ID) is replaced.
+func (s *ReportStore) Save(tr *atf.TestReport) (string, error) {
+
+	if tr == nil {
+		return "", fmt.Errorf("%w: report is nil", atf.ErrorInvalidValue)
+	}
+	if tr.ID == "" {
+		tr.ID = bson.NewObjectID().Hex()
+	}
+	doc, err := Marshal(tr)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := s.context()
+	defer cancel()
+	opts := options.Replace().SetUpsert(true)
+	if _, err := s.Collection.ReplaceOne(ctx, bson.M{"_id": tr.ID}, doc, opts); err != nil {
+		return "", err
+	}
+	return tr.ID, nil
+}
+
+// Load retrieves the report with the given ID from collection.
+func (s *ReportStore) Load(id string) (*atf.TestReport, error) {
+
+	ctx, cancel := s.context()
+	defer cancel()
+	doc, err := s.Collection.FindOne(ctx, bson.M{"_id": id}).Raw()
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, fmt.Errorf("%w: report %q not found", atf.ErrorInvalidValue, id)
+		}
+		return nil, err
+	}
+	tr := new(atf.TestReport)
+	if err := Unmarshal(doc, tr); err != nil {
+		return nil, err
+	}
+	return tr, nil
+}
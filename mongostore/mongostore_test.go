@@ -0,0 +1,101 @@
+package mongostore
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/mraitmaier/atf"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Create a topology with a switch connecting two servers and a router.
+func newStarTopology() *atf.Topology {
+
+	sw := atf.NewEthernetDevice("switch")
+	for _, p := range []string{"eth1", "eth2", "eth3"} {
+		sw.Ports = append(sw.Ports, *atf.CreatePort(p, "", atf.PortCopper|atf.Port1G|atf.PortFDX))
+	}
+	srv1, srv2 := atf.NewServer("srv1"), atf.NewServer("srv2")
+	srv1.URI = "http://srv1"
+	router := atf.NewGenericDevice("router", atf.DevRouter)
+
+	t := atf.NewTopology()
+	t.Suts = append(t.Suts, atf.CreateSUT("Gateway", "Hardware", "1.0", "", "10.0.0.1"))
+	t.AddLink(sw, srv1, &sw.Ports[0], nil)
+	t.AddLink(sw, srv2, &sw.Ports[1], nil)
+	t.AddLink(router, sw, nil, &sw.Ports[2])
+	return t
+}
+
+// Create a test set with a single case containing the given steps.
+func newReportSet(steps ...*atf.TestStep) *atf.TestSet {
+
+	tc := atf.CreateTestCase("Case", "", nil, nil, "Pass", "NotTested")
+	tc.Append(steps...)
+	ts := atf.CreateTestSet("Set", "", nil, nil, nil)
+	ts.Append(tc)
+	return ts
+}
+
+func TestReportBSON(t *testing.T) {
+
+	ts := newReportSet(atf.CreateTestStep("Step", "", "Pass", "Fail", atf.CreateAction("/bin/false", "")))
+	ts.ID = "set-1"
+	ts.Events = &atf.JSONLSink{}
+	ts.OnProgress = func(atf.Progress) {}
+	ts.Topology = newStarTopology()
+	tr := atf.CreateTestReport(ts)
+	tr.ID = bson.NewObjectID().Hex()
+
+	doc, err := Marshal(tr)
+	if err != nil {
+		t.Fatalf("marshaling to BSON failed: %s", err)
+	}
+	if id, ok := doc.Lookup("_id").StringValueOK(); !ok || id != tr.ID {
+		t.Errorf("unexpected document ID: %v", doc.Lookup("_id"))
+	}
+	var got atf.TestReport
+	if err := Unmarshal(doc, &got); err != nil {
+		t.Fatalf("unmarshaling from BSON failed: %s", err)
+	}
+	if got.ID != tr.ID || got.TestSet.ID != "set-1" || got.TestSet.Cases[0].Steps[0].Status != "Fail" {
+		t.Errorf("unexpected report: %+v", got)
+	}
+	topo := got.TestSet.Topology
+	if topo == nil {
+		t.Fatal("topology is missing")
+	}
+	if !reflect.DeepEqual(topo.Devices, ts.Topology.Devices) {
+		t.Errorf("expected devices %v, got %v", ts.Topology.Devices, topo.Devices)
+	}
+	if len(topo.Suts) != 1 || topo.Suts[0].IPaddr != "10.0.0.1" {
+		t.Errorf("unexpected SUTs %v", topo.Suts)
+	}
+	if len(topo.Links) != len(ts.Topology.Links) {
+		t.Fatalf("expected %d links, got %d", len(ts.Topology.Links), len(topo.Links))
+	}
+	for ix, l := range topo.Links {
+		if l.String() != ts.Topology.Links[ix].String() {
+			t.Errorf("expected link %s, got %s", ts.Topology.Links[ix], l)
+		}
+	}
+
+	// the report without topology is encoded, too
+	ts.Topology = nil
+	if doc, err = Marshal(tr); err != nil {
+		t.Fatalf("marshaling report without topology failed: %s", err)
+	}
+	got = atf.TestReport{}
+	if err := Unmarshal(doc, &got); err != nil || got.TestSet.Topology != nil {
+		t.Errorf("unexpected report without topology: %v, %+v", err, got.TestSet.Topology)
+	}
+}
+
+func TestReportStoreSave(t *testing.T) {
+
+	// invalid report is refused before the collection is used
+	if _, err := NewReportStore(nil, 0).Save(nil); !errors.Is(err, atf.ErrorInvalidValue) {
+		t.Errorf("saving nil report returned %v", err)
+	}
+}
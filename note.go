@@ -3,6 +3,8 @@ package atf
 //
 
 import (
+	"encoding/json"
+	"encoding/xml"
 	"fmt"
 	"time"
 )
@@ -11,24 +13,44 @@ import (
 // (format: "2012-12-15 15:05:05")
 type Note struct {
 
-	/* a string representing a note */
-	note string
+	// Text is a string representing a note
+	Text string `xml:",chardata"`
 
-	/* a string representing a formatted timestamp */
-	created string
+	// Created is a string representing a formatted timestamp
+	Created string `xml:"created,attr"`
 }
 
+// NewNote creates a new instance of Note with given text, stamped with the current time.
+func NewNote(text string) *Note { return &Note{Text: text, Created: time.Now().Format("2006-01-02 15:04:05")} }
+
 // String returns a human readable representation of the Note.
 func (n *Note) String() string {
-	return fmt.Sprintf("[%s] %s\n", n.created, n.note)
+	return fmt.Sprintf("[%s] %s\n", n.Created, n.Text)
+}
+
+// XML returns an XML-encoded representation of the Note.
+func (n *Note) XML() (string, error) { return n.XMLIndent(DefaultXMLPrefix, DefaultXMLIndent) }
+
+// XMLIndent returns the same representation as XML(), but every line begins with the given prefix and is indented
+// with one or more copies of the given indent.
+func (n *Note) XMLIndent(prefix, indent string) (string, error) {
+
+	output, err := xml.MarshalIndent(n, prefix, indent)
+	if err != nil {
+		return "", err
+	}
+	return string(output), nil
 }
 
-// AppendNote appends a new note to a list.
-func AppendNote(notes []Note, s string) []Note {
-	if notes != nil {
-		t := time.Now()
-		note := &Note{s, t.Format("2012-12-15 15:04:05")}
-		notes = append(notes, *note)
+// JSON returns a JSON-encoded representation of the Note.
+func (n *Note) JSON() (string, error) {
+
+	b, err := json.Marshal(n)
+	if err != nil {
+		return "", err
 	}
-	return notes
+	return string(b[:]), err
 }
+
+// AppendNote appends a new note to a list; the list can be nil (when the first note is added).
+func AppendNote(notes []Note, s string) []Note { return append(notes, *NewNote(s)) }
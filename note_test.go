@@ -0,0 +1,62 @@
+package atf
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"testing"
+	"time"
+)
+
+func TestAppendNote(t *testing.T) {
+
+	tests := []struct {
+		notes []Note
+		want  int
+	}{
+		{nil, 1},
+		{[]Note{}, 1},
+		{[]Note{{"first", "2024-01-01 10:00:00"}}, 2},
+	}
+	for _, tt := range tests {
+		before := time.Now().Truncate(time.Second)
+		notes := AppendNote(tt.notes, "a new note")
+		if len(notes) != tt.want {
+			t.Fatalf("expected %d notes, got %d", tt.want, len(notes))
+		}
+		n := notes[len(notes)-1]
+		if n.Text != "a new note" {
+			t.Errorf("unexpected note text %q", n.Text)
+		}
+		created, err := time.ParseInLocation("2006-01-02 15:04:05", n.Created, time.Local)
+		if err != nil || created.Before(before) || created.After(time.Now()) {
+			t.Errorf("unexpected note timestamp %q (%v)", n.Created, err)
+		}
+	}
+}
+
+func TestNoteRoundTrip(t *testing.T) {
+
+	tests := []*Note{
+		NewNote("plain text"),
+		{"special <chars> & \"quotes\"", "2024-01-01 10:00:00"},
+		{"", ""},
+	}
+	for _, n := range tests {
+		text, err := n.XML()
+		if err != nil {
+			t.Fatalf("XML() failed: %s", err)
+		}
+		x := new(Note)
+		if err := xml.Unmarshal([]byte(text), x); err != nil || *x != *n {
+			t.Errorf("XML round-trip: expected %+v, got %+v (%v)", n, x, err)
+		}
+
+		if text, err = n.JSON(); err != nil {
+			t.Fatalf("JSON() failed: %s", err)
+		}
+		j := new(Note)
+		if err := json.Unmarshal([]byte(text), j); err != nil || *j != *n {
+			t.Errorf("JSON round-trip: expected %+v, got %+v (%v)", n, j, err)
+		}
+	}
+}
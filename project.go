@@ -34,9 +34,13 @@ func (p *Project) String() string {
 }
 
 // XML returns an XML-encoded representation of the Project instance
-func (p *Project) XML() (string, error) {
+func (p *Project) XML() (string, error) { return p.XMLIndent(DefaultXMLPrefix, DefaultXMLIndent) }
 
-	out, err := xml.MarshalIndent(p, "  ", "    ")
+// XMLIndent returns the same representation as XML(), but every line begins with the given prefix and is indented
+// with one or more copies of the given indent.
+func (p *Project) XMLIndent(prefix, indent string) (string, error) {
+
+	out, err := xml.MarshalIndent(p, prefix, indent)
 	if err != nil {
 		return "", err
 	}
@@ -51,3 +55,62 @@ func (p *Project) JSON() (string, error) {
 	}
 	return string(b[:]), err
 }
+
+// ProjectList is a collection of projects.
+type ProjectList struct {
+
+	// XMLName defines the root XML element
+	XMLName xml.Name `xml:"Projects" json:"-"`
+
+	// Projects is a list of projects
+	Projects []*Project `xml:"Project"`
+}
+
+// NewProjectList creates a new empty instance of ProjectList.
+func NewProjectList() *ProjectList { return &ProjectList{Projects: make([]*Project, 0)} }
+
+// String returns a human-readable representation of the ProjectList instance
+func (pl *ProjectList) String() string {
+
+	txt := "PROJECTS\n"
+	for _, p := range pl.Projects {
+		txt += fmt.Sprintf("%s\n", p.String())
+	}
+	return txt
+}
+
+// Add appends one or more projects to the list.
+func (pl *ProjectList) Add(projects ...*Project) { pl.Projects = append(pl.Projects, projects...) }
+
+// Find returns the project with the given short name; the boolean flag is false when project is not found.
+func (pl *ProjectList) Find(short string) (*Project, bool) {
+	for _, p := range pl.Projects {
+		if p.Short == short {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+// XML returns an XML-encoded representation of the ProjectList instance
+func (pl *ProjectList) XML() (string, error) { return pl.XMLIndent(DefaultXMLPrefix, DefaultXMLIndent) }
+
+// XMLIndent returns the same representation as XML(), but every line begins with the given prefix and is indented
+// with one or more copies of the given indent.
+func (pl *ProjectList) XMLIndent(prefix, indent string) (string, error) {
+
+	out, err := xml.MarshalIndent(pl, prefix, indent)
+	if err != nil {
+		return "", err
+	}
+	return string(out), err
+}
+
+// JSON returns a JSON-encoded representation of the ProjectList instance
+func (pl *ProjectList) JSON() (string, error) {
+	b, err := json.Marshal(pl)
+	if err != nil {
+		return "", err
+	}
+	return string(b[:]), err
+}
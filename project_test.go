@@ -0,0 +1,77 @@
+package atf
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Create a list of sample projects.
+func newProjectList() *ProjectList {
+
+	pl := NewProjectList()
+	pl.Add(CreateProject("Gateway firmware", "GW", "Firmware of the home gateway"))
+	pl.Add(NewProject("Access point", "AP"), NewProject("Access point, legacy", "AP"))
+	return pl
+}
+
+func TestProjectListFind(t *testing.T) {
+
+	pl := newProjectList()
+	tests := []struct {
+		short string
+		name  string
+		found bool
+	}{
+		{"GW", "Gateway firmware", true},
+		{"AP", "Access point", true}, // the first project with the given short name
+		{"gw", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		p, found := pl.Find(tt.short)
+		if found != tt.found || (found && p.Name != tt.name) || (!found && p != nil) {
+			t.Errorf("Find(%q) = %v, %t; want %q, %t", tt.short, p, found, tt.name, tt.found)
+		}
+	}
+	if _, found := NewProjectList().Find("GW"); found {
+		t.Errorf("project found in empty list")
+	}
+}
+
+func TestProjectListRoundTrip(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		enc    func(pl *ProjectList) (string, error)
+		dec    func(s string, pl *ProjectList) error
+		prefix string
+	}{
+		{"XML", (*ProjectList).XML, func(s string, pl *ProjectList) error { return xml.Unmarshal([]byte(s), pl) },
+			"<Projects>"},
+		{"JSON", (*ProjectList).JSON, func(s string, pl *ProjectList) error { return json.Unmarshal([]byte(s), pl) },
+			`{"Projects":[`},
+	}
+	for _, tt := range tests {
+		pl := newProjectList()
+		s, err := tt.enc(pl)
+		if err != nil {
+			t.Fatalf("%s: encoding failed: %s", tt.name, err)
+		}
+		if !strings.HasPrefix(s, tt.prefix) {
+			t.Errorf("%s: unexpected encoding %q", tt.name, s)
+		}
+		got := new(ProjectList)
+		if err := tt.dec(s, got); err != nil {
+			t.Fatalf("%s: decoding failed: %s", tt.name, err)
+		}
+		if !reflect.DeepEqual(got.Projects, pl.Projects) {
+			t.Errorf("%s: expected projects %v, got %v", tt.name, pl.Projects, got.Projects)
+		}
+		if p, found := got.Find("GW"); !found || p.Description != "Firmware of the home gateway" {
+			t.Errorf("%s: decoded project not found: %v", tt.name, p)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package atf
+
+/*
+ * remote.go - execution of the actions on the remote host over SSH
+ *
+ * When the action defines the remote host, its script (together with the
+ * arguments) is executed as a command on that host instead of locally.
+ */
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// SSHConfig defines the remote host where the action is executed and the credentials used to log in.
+type SSHConfig struct {
+
+	// Host is the remote host address, optionally with a port ("host:port"); the default port is 22
+	Host string `xml:"host,attr" yaml:"host"`
+
+	// User is the name of the remote user
+	User string `xml:"user,attr" yaml:"user"`
+
+	// Password is used for password authentication (if defined); it's never serialized, so it can only be set in code (see
+	// PasswordEnv for configs)
+	Password string `xml:"-" json:"-" yaml:"-" bson:"-"`
+
+	// PasswordEnv is a name of the environment variable holding the password (if defined); the variable is read when
+	// connecting, so the password never appears in the configs or reports
+	PasswordEnv string `xml:",omitempty" json:",omitempty" yaml:"passwordenv,omitempty"`
+
+	// KeyFile is a path to the private key file used for public key authentication (if defined)
+	KeyFile string `xml:",omitempty" json:",omitempty" yaml:"keyfile,omitempty"`
+
+	// KnownHosts is a path to the known_hosts file used to verify the host key; if empty, "~/.ssh/known_hosts" is used
+	KnownHosts string `xml:",omitempty" json:",omitempty" yaml:"knownhosts,omitempty"`
+
+	// InsecureIgnoreHostKey disables the host key verification; it must be set explicitly (e.g. for the lab hosts that are
+	// often reinstalled), since the host is not authenticated at all then
+	InsecureIgnoreHostKey bool `xml:"insecureIgnoreHostKey,attr,omitempty" json:",omitempty" yaml:"insecureignorehostkey,omitempty"`
+
+	// ConnectTimeout limits the duration of connecting to the host, including the SSH handshake; DefaultSSHTimeout, when
+	// not defined. In XML, this is an attribute
+	ConnectTimeout Duration `xml:"connectTimeout,attr,omitempty" json:",omitempty" yaml:"connecttimeout,omitempty"`
+}
+
+// DefaultSSHTimeout defines how long to wait for the remote host to connect (including the SSH handshake), when the
+// connect timeout is not defined.
+const DefaultSSHTimeout = 10 * time.Second
+
+// String returns a human-readable representation of the SSHConfig instance.
+func (c *SSHConfig) String() string { return fmt.Sprintf("%s@%s", c.User, c.Host) }
+
+// Return the address of the remote host, with default port added when not given.
+func (c *SSHConfig) addr() string {
+
+	if _, _, err := net.SplitHostPort(c.Host); err != nil {
+		return net.JoinHostPort(c.Host, "22")
+	}
+	return c.Host
+}
+
+// Return the connect timeout: the default one, when not defined.
+func (c *SSHConfig) timeout() time.Duration {
+	if c.ConnectTimeout <= 0 {
+		return DefaultSSHTimeout
+	}
+	return time.Duration(c.ConnectTimeout)
+}
+
+// Return the SSH client configuration: authentication methods, host key verification and connect timeout.
+func (c *SSHConfig) clientConfig() (*ssh.ClientConfig, error) {
+
+	auth := make([]ssh.AuthMethod, 0)
+	if c.KeyFile != "" {
+		key, err := os.ReadFile(c.KeyFile)
+		if err != nil {
+			return nil, WrapInvalidValue(err, c.KeyFile)
+		}
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, WrapInvalidValue(err, c.KeyFile)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	password := c.Password
+	if c.PasswordEnv != "" {
+		pwd, ok := os.LookupEnv(c.PasswordEnv)
+		if !ok {
+			return nil, fmt.Errorf("%w: password variable %q is not defined", ErrorInvalidValue, c.PasswordEnv)
+		}
+		password = pwd
+	}
+	if password != "" {
+		auth = append(auth, ssh.Password(password))
+	}
+
+	// the host key is always verified, unless explicitly disabled
+	hostKey := ssh.InsecureIgnoreHostKey()
+	if !c.InsecureIgnoreHostKey {
+		known := c.KnownHosts
+		if known == "" {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return nil, WrapInvalidValue(err, "known_hosts")
+			}
+			known = filepath.Join(home, ".ssh", "known_hosts")
+		}
+		var err error
+		if hostKey, err = knownhosts.New(known); err != nil {
+			return nil, WrapInvalidValue(err, known)
+		}
+	}
+	return &ssh.ClientConfig{User: c.User, Auth: auth, HostKeyCallback: hostKey, Timeout: c.timeout()}, nil
+}
+
+// RemoteExecFn is a callback that executes the given command (with the given standard input) on the remote host using the
+// given execution options and returns its output (STDOUT & STDERR combined), the exit code and an error if something goes
+// wrong.
+type RemoteExecFn func(ctx context.Context, cfg *SSHConfig, command, stdin string, opts ExecOptions) (output string,
+	exitCode int, err error)
+
+// RemoteExec is used to execute the remote actions; by default, the commands are executed over SSH. It can be replaced
+// e.g. to use a different transport.
+var RemoteExec RemoteExecFn = executeSSH
+
+// A private function that executes the given command on the remote host over SSH.
+//
+// Input:
+//
+//	    ctx - the context of the execution; the command is aborted when it's done
+//	    cfg - the remote host configuration
+//	command - the command to be executed (with arguments)
+//	  stdin - the text fed to the command standard input
+//	   opts - the execution options
+//
+// Returns:
+//
+//	  output - is the text output from the executed command
+//	exitCode - is the exit code of the command (-1 if the command has not been executed properly)
+//	     err - error code; if everything is OK, it should be nil
+func executeSSH(ctx context.Context, cfg *SSHConfig, command, stdin string, opts ExecOptions) (output string, exitCode int,
+	err error) {
+
+	if cfg == nil || cfg.Host == "" || command == "" {
+		return "", -1, ErrorInvalidValue
+	}
+	ccfg, err := cfg.clientConfig()
+	if err != nil {
+		return "", -1, err
+	}
+
+	// connect to the remote host; the handshake must finish in time, too (or before the context is done)...
+	conn, err := (&net.Dialer{Timeout: ccfg.Timeout}).DialContext(ctx, "tcp", cfg.addr())
+	if err != nil {
+		return "", -1, WrapConnectionFailed(err, cfg.String())
+	}
+	deadline := time.Now().Add(ccfg.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+	c, chans, reqs, err := ssh.NewClientConn(conn, cfg.addr(), ccfg)
+	if err != nil {
+		conn.Close()
+		return "", -1, WrapConnectionFailed(err, cfg.String())
+	}
+	conn.SetDeadline(time.Time{})
+	client := ssh.NewClient(c, chans, reqs)
+	defer client.Close()
+
+	// ...and execute the command in a new session
+	session, err := client.NewSession()
+	if err != nil {
+		return "", -1, WrapConnectionFailed(err, cfg.String())
+	}
+	defer session.Close()
+	if stdin != "" {
+		session.Stdin = strings.NewReader(stdin)
+	}
+	out := &limitedBuffer{max: opts.MaxOutputBytes}
+	session.Stdout = out
+	session.Stderr = out
+
+	done := make(chan error, 1)
+	go func() { done <- session.Run(command) }()
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		client.Close() // this aborts the running command
+		<-done
+		return out.String(), -1, WrapExecTimeout(ctx.Err(), command)
+	}
+
+	// non-zero exit status is reported as is, other errors mean that the connection has failed
+	var e *ssh.ExitError
+	switch {
+	case err == nil:
+		return out.String(), 0, nil
+	case errors.As(err, &e):
+		return out.String(), e.ExitStatus(), err
+	}
+	return out.String(), -1, WrapConnectionFailed(err, cfg.String())
+}
@@ -0,0 +1,321 @@
+package atf
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// A mock SSH server: it accepts the "admin" user with the "secret" password or the client key, and executes the following
+// commands: "echo <text>", "cat" (echoes the standard input), "exit <status>" and "sleep" (runs until the client is gone).
+type mockSSHServer struct {
+	addr    string
+	hostKey ssh.PublicKey
+	keyFile string
+}
+
+// Generate a new ed25519 key.
+func newSSHKey(t *testing.T) (ed25519.PrivateKey, ssh.Signer) {
+
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return priv, signer
+}
+
+// Start a mock SSH server listening on the local host; it's stopped when the test is finished.
+func newMockSSHServer(t *testing.T) *mockSSHServer {
+
+	t.Helper()
+	_, hostSigner := newSSHKey(t)
+	clientKey, clientSigner := newSSHKey(t)
+	block, err := ssh.MarshalPrivateKey(clientKey, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "id_ed25519")
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if c.User() == "admin" && string(pass) == "secret" {
+				return nil, nil
+			}
+			return nil, errors.New("access denied")
+		},
+		PublicKeyCallback: func(c ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if c.User() == "admin" && bytes.Equal(key.Marshal(), clientSigner.PublicKey().Marshal()) {
+				return nil, nil
+			}
+			return nil, errors.New("access denied")
+		},
+	}
+	cfg.AddHostKey(hostSigner)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveSSH(nc, cfg)
+		}
+	}()
+	return &mockSSHServer{addr: ln.Addr().String(), hostKey: hostSigner.PublicKey(), keyFile: keyFile}
+}
+
+// Serve a single SSH connection of the mock server.
+func serveSSH(nc net.Conn, cfg *ssh.ServerConfig) {
+
+	conn, chans, reqs, err := ssh.NewServerConn(nc, cfg)
+	if err != nil {
+		nc.Close()
+		return
+	}
+	defer conn.Close()
+	go ssh.DiscardRequests(reqs)
+	for nch := range chans {
+		if nch.ChannelType() != "session" {
+			nch.Reject(ssh.UnknownChannelType, "unsupported channel")
+			continue
+		}
+		ch, requests, err := nch.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for req := range requests {
+				if req.Type != "exec" {
+					req.Reply(false, nil)
+					continue
+				}
+				var cmd struct{ Command string }
+				ssh.Unmarshal(req.Payload, &cmd)
+				req.Reply(true, nil)
+				status := runMockCommand(conn, ch, cmd.Command)
+				ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+				ch.Close()
+			}
+		}()
+	}
+}
+
+// Run the command of the mock SSH server and return its exit status.
+func runMockCommand(conn ssh.Conn, ch ssh.Channel, command string) uint32 {
+
+	name, arg, _ := strings.Cut(command, " ")
+	switch name {
+	case "echo":
+		fmt.Fprintln(ch, arg)
+	case "cat":
+		io.Copy(ch, ch)
+	case "exit":
+		status, _ := strconv.Atoi(arg)
+		fmt.Fprintf(ch.Stderr(), "exiting with %d\n", status)
+		return uint32(status)
+	case "sleep":
+		conn.Wait()
+	default:
+		fmt.Fprintf(ch.Stderr(), "%s: command not found\n", name)
+		return 127
+	}
+	return 0
+}
+
+// Write the known_hosts file with the given host key for the given address.
+func writeKnownHosts(t *testing.T, addr string, key ssh.PublicKey) string {
+
+	t.Helper()
+	name := filepath.Join(t.TempDir(), "known_hosts")
+	line := ""
+	if key != nil {
+		line = knownhosts.Line([]string{addr}, key) + "\n"
+	}
+	if err := os.WriteFile(name, []byte(line), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestExecuteSSH(t *testing.T) {
+
+	srv := newMockSSHServer(t)
+	_, otherKey := newSSHKey(t)
+	known := writeKnownHosts(t, srv.addr, srv.hostKey)
+	t.Setenv("ATF_SSH_PASSWORD", "secret")
+
+	// a host accepting connections, but never starting the SSH handshake
+	silent, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+
+	password := func(host string) *SSHConfig {
+		return &SSHConfig{Host: host, User: "admin", Password: "secret", InsecureIgnoreHostKey: true}
+	}
+	tests := []struct {
+		name    string
+		cfg     *SSHConfig
+		command string
+		stdin   string
+		timeout time.Duration
+		out     string
+		code    int
+		err     error
+	}{
+		{"password", password(srv.addr), "echo hello", "", 0, "hello\n", 0, nil},
+		{"password variable", &SSHConfig{Host: srv.addr, User: "admin", PasswordEnv: "ATF_SSH_PASSWORD",
+			KnownHosts: known}, "echo hello", "", 0, "hello\n", 0, nil},
+		{"key file", &SSHConfig{Host: srv.addr, User: "admin", KeyFile: srv.keyFile, KnownHosts: known},
+			"echo hello", "", 0, "hello\n", 0, nil},
+		{"stdin", password(srv.addr), "cat", "line 1\nline 2\n", 0, "line 1\nline 2\n", 0, nil},
+		{"exit status", password(srv.addr), "exit 3", "", 0, "exiting with 3\n", 3, nil},
+		{"unknown command", password(srv.addr), "uptime", "", 0, "uptime: command not found\n", 127, nil},
+		{"timeout", password(srv.addr), "sleep", "", 200 * time.Millisecond, "", -1, ErrorExecTimeout},
+		{"wrong password", &SSHConfig{Host: srv.addr, User: "admin", Password: "guess", InsecureIgnoreHostKey: true},
+			"echo hello", "", 0, "", -1, ErrorConnectionFailed},
+		{"unknown host key", &SSHConfig{Host: srv.addr, User: "admin", Password: "secret",
+			KnownHosts: writeKnownHosts(t, srv.addr, nil)}, "echo hello", "", 0, "", -1, ErrorConnectionFailed},
+		{"changed host key", &SSHConfig{Host: srv.addr, User: "admin", Password: "secret",
+			KnownHosts: writeKnownHosts(t, srv.addr, otherKey.PublicKey())}, "echo hello", "", 0, "", -1,
+			ErrorConnectionFailed},
+		{"missing known_hosts", &SSHConfig{Host: srv.addr, User: "admin", Password: "secret",
+			KnownHosts: filepath.Join(t.TempDir(), "missing")}, "echo hello", "", 0, "", -1, ErrorInvalidValue},
+		{"undefined password variable", &SSHConfig{Host: srv.addr, User: "admin", PasswordEnv: "ATF_SSH_UNDEFINED",
+			InsecureIgnoreHostKey: true}, "echo hello", "", 0, "", -1, ErrorInvalidValue},
+		{"missing key file", &SSHConfig{Host: srv.addr, User: "admin", KeyFile: filepath.Join(t.TempDir(), "id"),
+			InsecureIgnoreHostKey: true}, "echo hello", "", 0, "", -1, ErrorInvalidValue},
+		{"handshake timeout", &SSHConfig{Host: silent.Addr().String(), User: "admin", Password: "secret",
+			InsecureIgnoreHostKey: true, ConnectTimeout: Duration(200 * time.Millisecond)}, "echo hello", "", 0, "", -1,
+			ErrorConnectionFailed},
+		{"no host", &SSHConfig{User: "admin"}, "echo hello", "", 0, "", -1, ErrorInvalidValue},
+		{"no command", password(srv.addr), "", "", 0, "", -1, ErrorInvalidValue},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+			start := time.Now()
+			out, code, err := executeSSH(ctx, tt.cfg, tt.command, tt.stdin, ExecOptions{})
+			if tt.err != nil && !errors.Is(err, tt.err) {
+				t.Errorf("expected error %v, got %v", tt.err, err)
+			}
+			if tt.err == nil && tt.code == 0 && err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+			if out != tt.out || code != tt.code {
+				t.Errorf("expected output %q (exit code %d), got %q (exit code %d)", tt.out, tt.code, out, code)
+			}
+			if time.Since(start) > 5*time.Second {
+				t.Errorf("execution has not been aborted in time: %s", time.Since(start))
+			}
+		})
+	}
+}
+
+func TestRemoteAction(t *testing.T) {
+
+	srv := newMockSSHServer(t)
+	remote := func(script, args string) *Action {
+		a := CreateAction(script, args)
+		a.Remote = &SSHConfig{Host: srv.addr, User: "admin", Password: "secret", InsecureIgnoreHostKey: true}
+		return a
+	}
+	tests := []struct {
+		name   string
+		action *Action
+		result TestResult
+		code   int
+		out    string
+	}{
+		{"pass", remote("echo", "hello"), "Pass", 0, "hello\n"},
+		{"fail", remote("exit", "2"), "Fail", 2, "exiting with 2\n"},
+	}
+	for _, tt := range tests {
+		step := CreateTestStep("Remote", "", "Pass", "NotTested", tt.action)
+		step.Execute(quietDisplay())
+		if a := step.Action; a.Result != tt.result || a.ExitCode != tt.code || a.Output != tt.out {
+			t.Errorf("%s: expected %s (exit code %d, output %q), got %s (exit code %d, output %q)", tt.name, tt.result,
+				tt.code, tt.out, a.Result, a.ExitCode, a.Output)
+		}
+		if step.Status != tt.result || step.Output != tt.out {
+			t.Errorf("%s: expected step %s with output %q, got %s with %q", tt.name, tt.result, tt.out, step.Status,
+				step.Output)
+		}
+	}
+
+	// remote executor can be replaced
+	defer func(fn RemoteExecFn) { RemoteExec = fn }(RemoteExec)
+	var got string
+	RemoteExec = func(ctx context.Context, cfg *SSHConfig, command, stdin string, opts ExecOptions) (string, int, error) {
+		got = fmt.Sprintf("%s %s %q", cfg, command, stdin)
+		return "mocked\n", 0, nil
+	}
+	a := remote("show", "version")
+	a.Stdin = "yes"
+	if out := a.ExecuteWithOptions(context.Background(), ExecOptions{}); out != "mocked\n" || a.Result != "Pass" {
+		t.Errorf("expected mocked output, got %q (%s)", out, a.Result)
+	}
+	if want := `admin@` + srv.addr + ` show version "yes"`; got != want {
+		t.Errorf("expected remote execution %s, got %s", want, got)
+	}
+}
+
+func TestSSHConfigPassword(t *testing.T) {
+
+	a := CreateAction("uptime", "")
+	a.Remote = &SSHConfig{Host: "10.0.0.1", User: "admin", Password: "top-secret", PasswordEnv: "PASS"}
+	tests := []struct {
+		name string
+		enc  func(a *Action) ([]byte, error)
+	}{
+		{"XML", func(a *Action) ([]byte, error) { return xml.Marshal(a) }},
+		{"JSON", func(a *Action) ([]byte, error) { return json.Marshal(a) }},
+	}
+	for _, tt := range tests {
+		b, err := tt.enc(a)
+		if err != nil {
+			t.Fatalf("%s: encoding failed: %s", tt.name, err)
+		}
+		if strings.Contains(string(b), "top-secret") || !strings.Contains(string(b), "PASS") {
+			t.Errorf("%s: password is serialized:\n%s", tt.name, b)
+		}
+	}
+	if s := a.String(); strings.Contains(s, "top-secret") {
+		t.Errorf("password is displayed: %s", s)
+	}
+}
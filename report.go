@@ -4,7 +4,7 @@ package atf
  * report.go - implementation of the Reporter module
  *
  * This module is repsonsible for creating reports. According to input data,
- * different reports can be created: HTML, XML, JSON and plain text (the last
+ * different reports can be created: HTML, XML, JSON, CSV and plain text (the last
  * one has not been implemented yet and it might be omitted in the end, since
  * I'm not sure this is actually needed). These reports are written as files to
  * a specified path. By default, only HTML report is
@@ -15,6 +15,7 @@ package atf
  */
 
 import (
+	"errors"
 	"path"
 	"path/filepath"
 	//    "fmt"
@@ -30,12 +31,34 @@ type Reporter interface {
 // It wraps all types of reports that ATF is aware of and defines the operations on all of those reports.
 type Report struct {
 	reports map[string]string
+
+	// base name of the report files, "report" by default
+	basename string
+
+	// Timestamped: should the report filenames include the timestamp?
+	Timestamped bool
 }
 
 // CreateReport creates an empty report structure
 func CreateReport() *Report {
 	var rpt = make(map[string]string)
-	return &Report{rpt}
+	return &Report{reports: rpt, basename: "report"}
+}
+
+// SetBaseName sets the base name of the report files (without extension); empty name resets it to default "report".
+func (r *Report) SetBaseName(name string) {
+	if name == "" {
+		name = "report"
+	}
+	r.basename = name
+}
+
+// Private method that creates the report filename (without extension), optionally with the timestamp appended.
+func (r *Report) filename() string {
+	if r.Timestamped {
+		return r.basename + "_" + utils.NowFile()
+	}
+	return r.basename
 }
 
 // AddHTML adds a reference to HTML report
@@ -47,6 +70,9 @@ func (r *Report) AddXML() { r.reports["xml"] = "" }
 // AddJSON adds a reference to JSON report
 func (r *Report) AddJSON() { r.reports["json"] = "" }
 
+// AddCSV adds a reference to CSV report
+func (r *Report) AddCSV() { r.reports["csv"] = "" }
+
 // AddText adds a reference to text report
 func (r *Report) AddText() { r.reports["txt"] = "" }
 
@@ -61,6 +87,8 @@ func (r *Report) create(tr *TestReport, typ string) (rpt string, err error) {
 	case "txt": // TODO: TextReport not implemented yet
 	case "json":
 		rpt, err = tr.JSON()
+	case "csv":
+		rpt, err = tr.CSV()
 	default:
 		rpt = "Unknown report type"
 		err = ErrorUnknownReportType
@@ -69,7 +97,9 @@ func (r *Report) create(tr *TestReport, typ string) (rpt string, err error) {
 }
 
 // Create all the defined reports and write them.
-func (r *Report) Create(tr *TestReport, pth string) (err error) {
+// A failure to create or write a single report doesn't stop the others from being created: all errors are collected and
+// returned together.
+func (r *Report) Create(tr *TestReport, pth string) error {
 
 	// if path is empty, create the default path
 	if pth == "" {
@@ -77,17 +107,19 @@ func (r *Report) Create(tr *TestReport, pth string) (err error) {
 	}
 
 	// iterate through existing report (types), create them and write them as
-	// "report.<type>" into given path
-	for i, contents := range r.reports {
-		contents, err = r.create(tr, i)
+	// "<basename>.<type>" into given path
+	var errs []error
+	name := r.filename()
+	for i := range r.reports {
+		contents, err := r.create(tr, i)
 		if err != nil {
-			return err
+			errs = append(errs, err)
+			continue
 		}
-		filename := filepath.ToSlash(path.Join(pth, "report."+i))
-		err = utils.WriteTextFile(filename, contents)
-		if err != nil {
-			return err
+		filename := filepath.ToSlash(path.Join(pth, name+"."+i))
+		if err = utils.WriteTextFileAtomic(filename, contents); err != nil {
+			errs = append(errs, err)
 		}
 	}
-	return
+	return errors.Join(errs...)
 }
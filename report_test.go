@@ -0,0 +1,56 @@
+package atf
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReportCreatePartialFailure(t *testing.T) {
+
+	dir := t.TempDir()
+	r := CreateReport()
+	r.AddJSON()
+	r.AddCSV()
+	r.reports["bogus"] = "" // this one always fails
+
+	err := r.Create(CreateTestReport(newReportSet()), dir)
+	if !errors.Is(err, ErrorUnknownReportType) {
+		t.Errorf("expected ErrorUnknownReportType, got %v", err)
+	}
+	for _, name := range []string{"report.json", "report.csv"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("report %q has not been created: %s", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "report.bogus")); err == nil {
+		t.Error("failed report has been written")
+	}
+}
+
+func TestReportFilename(t *testing.T) {
+
+	tests := []struct {
+		base        string
+		timestamped bool
+		pattern     string
+	}{
+		{"", false, "report.json"},
+		{"nightly", false, "nightly.json"},
+		{"nightly", true, "nightly_*_*_*_*_*_*.json"},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		r := CreateReport()
+		r.SetBaseName(tt.base)
+		r.Timestamped = tt.timestamped
+		r.AddJSON()
+		if err := r.Create(CreateTestReport(newReportSet()), dir); err != nil {
+			t.Fatalf("Create() failed: %s", err)
+		}
+		if files, _ := filepath.Glob(filepath.Join(dir, tt.pattern)); len(files) != 1 {
+			t.Errorf("base name %q, timestamped %v: no report matches %q", tt.base, tt.timestamped, tt.pattern)
+		}
+	}
+}
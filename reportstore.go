@@ -0,0 +1,18 @@
+package atf
+
+/*
+ * reportstore.go - persistence of the test reports
+ *
+ * Test reports are stored into database by means of the ReportStore
+ * interface. MongoDB implementation is provided by the mongostore package.
+ */
+
+// ReportStore is an interface defining the persistence of test reports.
+type ReportStore interface {
+
+	// Save stores the given report and returns its ID; when report has no ID, a new one is assigned.
+	Save(*TestReport) (string, error)
+
+	// Load retrieves the report with the given ID.
+	Load(string) (*TestReport, error)
+}
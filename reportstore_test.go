@@ -0,0 +1,91 @@
+package atf
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// An in-memory ReportStore keeping the reports as JSON documents.
+type memReportStore struct {
+	docs map[string][]byte
+	next int
+}
+
+func (s *memReportStore) Save(tr *TestReport) (string, error) {
+
+	if tr == nil {
+		return "", fmt.Errorf("%w: report is nil", ErrorInvalidValue)
+	}
+	if tr.ID == "" {
+		s.next++
+		tr.ID = fmt.Sprintf("report-%d", s.next)
+	}
+	doc, err := json.Marshal(tr)
+	if err != nil {
+		return "", err
+	}
+	s.docs[tr.ID] = doc
+	return tr.ID, nil
+}
+
+func (s *memReportStore) Load(id string) (*TestReport, error) {
+
+	doc, ok := s.docs[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: report %q not found", ErrorInvalidValue, id)
+	}
+	tr := new(TestReport)
+	if err := json.Unmarshal(doc, tr); err != nil {
+		return nil, err
+	}
+	return tr, nil
+}
+
+var _ ReportStore = (*memReportStore)(nil)
+
+func TestReportStore(t *testing.T) {
+
+	var store ReportStore = &memReportStore{docs: make(map[string][]byte)}
+	first := CreateTestReport(newReportSet(CreateTestStep("Step", "", "Pass", "Pass", CreateAction("/bin/true", ""))))
+	first.TestSet.ID, first.Started = "set-1", "2024-01-02 03:04:05"
+
+	tests := []struct {
+		name   string
+		report *TestReport
+		id     string
+		status TestResult
+		err    error
+	}{
+		{"new report", first, "report-1", "Pass", nil},
+		{"another report", CreateTestReport(newReportSet()), "report-2", "NotTested", nil},
+		{"existing report", &TestReport{TestSet: newReportSet(), ID: "report-1"}, "report-1", "NotTested", nil},
+		{"nil report", nil, "", "", ErrorInvalidValue},
+	}
+	for _, tt := range tests {
+		id, err := store.Save(tt.report)
+		if !errors.Is(err, tt.err) || id != tt.id {
+			t.Errorf("%s: Save() = %q, %v; want %q, %v", tt.name, id, err, tt.id, tt.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		tr, err := store.Load(id)
+		if err != nil {
+			t.Errorf("%s: Load(%q) failed: %s", tt.name, id, err)
+			continue
+		}
+		// the saved report is replaced, when report with the same ID is saved again
+		if tr.ID != id || tr.Started != tt.report.Started || tr.TestSet.Cases[0].Status != tt.report.TestSet.Cases[0].Status {
+			t.Errorf("%s: loaded report differs: %+v", tt.name, tr)
+		}
+	}
+	if tr, err := store.Load("report-1"); err != nil || tr.Started != "" || tr.TestSet.ID != "" {
+		t.Errorf("report has not been replaced: %+v, %v", tr, err)
+	}
+	if _, err := store.Load("missing"); !errors.Is(err, ErrorInvalidValue) {
+		t.Errorf("loading missing report returned %v", err)
+	}
+}
@@ -26,17 +26,20 @@ type Requirement struct {
 	Description string
 
 	// Project represents a project that is related to the requirement
-	Project
+	Project Project `xml:"Project"`
 
 	// Labels is a list of string labels that are associated ot requirement; it gives a requirement a classification
 	// and a filtering ability
 	Labels []string
 
 	// Status represents the current status
-	Status ReqStatus `xml:"status:attr"`
+	Status ReqStatus `xml:"status,attr"`
 
 	// Priority represents the priority (low, normal, high) of the requirement
 	Priority `xml:"priority,attr"`
+
+	// Notes is a changelog of the requirement
+	Notes []Note `xml:"Notes>Note"`
 }
 
 // NewRequirement creates a new  empty instance of Requirement type.
@@ -49,6 +52,7 @@ func NewRequirement() *Requirement {
 		Status:      ReqStatus("NEW"),
 		Priority:    Priority("UNKNOWN"),
 		Labels:      make([]string, 0),
+		Notes:       make([]Note, 0),
 	}
 }
 
@@ -63,9 +67,13 @@ func (r *Requirement) String() string {
 }
 
 // XML returns an XML-encoded representation of the requirement.
-func (r *Requirement) XML() (string, error) {
+func (r *Requirement) XML() (string, error) { return r.XMLIndent(DefaultXMLPrefix, DefaultXMLIndent) }
+
+// XMLIndent returns the same representation as XML(), but every line begins with the given prefix and is indented
+// with one or more copies of the given indent.
+func (r *Requirement) XMLIndent(prefix, indent string) (string, error) {
 
-	output, err := xml.MarshalIndent(r, "", "  ")
+	output, err := xml.MarshalIndent(r, prefix, indent)
 	if err != nil {
 		return "", err
 	}
@@ -84,6 +92,30 @@ func (r *Requirement) JSON() (string, error) {
 
 }
 
+// SetStatus changes the status of the requirement. Only legal transitions are allowed (see above); on success, the change
+// is recorded into the changelog.
+func (r *Requirement) SetStatus(s ReqStatus) error {
+
+	from, to := ReqStatus(r.Status.String()), ReqStatus(s.String())
+	if !IsValidReqStatus(to) {
+		return fmt.Errorf("%w: invalid requirement status %q", ErrorInvalidValue, s)
+	}
+	if from == to {
+		return nil
+	}
+	for _, st := range reqStatusTransitions[from] {
+		if st == to {
+			r.Status = to
+			r.AddNote(fmt.Sprintf("Status changed from %s to %s", from, to))
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: illegal requirement status transition %s -> %s", ErrorInvalidValue, from, to)
+}
+
+// AddNote adds a new note to the requirement's changelog.
+func (r *Requirement) AddNote(text string) { r.Notes = AppendNote(r.Notes, text) }
+
 // AppendLabels appends one or more labels to Requirement.
 func (r *Requirement) AppendLabel(labels ...string) {
 	r.Labels = append(r.Labels, labels...)
@@ -98,6 +130,18 @@ var ValidReqStatus = []string{"NEW", "ACKNOWLEDGED", "PENDING", "APPROVED", "REJ
 // String returns a human-readable representation for the ReqStatus type.
 func (r ReqStatus) String() string { return strings.ToUpper(string(r)) }
 
+// legal requirement status transitions: NEW -> ACKNOWLEDGED -> PENDING -> APPROVED/REJECTED; a requirement can be rejected
+// at any point of the lifecycle, while APPROVED and REJECTED are final. A requirement with UNKNOWN status can be set to any
+// status.
+var reqStatusTransitions = map[ReqStatus][]ReqStatus{
+	"NEW":          {"ACKNOWLEDGED", "REJECTED"},
+	"ACKNOWLEDGED": {"PENDING", "REJECTED"},
+	"PENDING":      {"APPROVED", "REJECTED"},
+	"APPROVED":     {},
+	"REJECTED":     {},
+	"UNKNOWN":      {"NEW", "ACKNOWLEDGED", "PENDING", "APPROVED", "REJECTED"},
+}
+
 // IsValidReqStatus checks whether the given requirement status is valid or not.
 func IsValidReqStatus(s ReqStatus) bool {
 
@@ -0,0 +1,134 @@
+package atf
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRequirementNotesJSON(t *testing.T) {
+
+	r := NewRequirement()
+	r.AddNote("first")
+	r.AddNote("second")
+	text, err := r.JSON()
+	if err != nil {
+		t.Fatalf("JSON() failed: %s", err)
+	}
+	got := new(Requirement)
+	if err := json.Unmarshal([]byte(text), got); err != nil {
+		t.Fatalf("JSON cannot be unmarshaled: %s", err)
+	}
+	if !reflect.DeepEqual(got.Notes, r.Notes) {
+		t.Errorf("expected notes %+v, got %+v", r.Notes, got.Notes)
+	}
+}
+
+// Create a requirement with all the fields set.
+func newTestRequirement() *Requirement {
+
+	r := NewRequirement()
+	r.Name, r.Short, r.Description = "Login", "REQ-1", "Users <must> log in & out"
+	r.Project = *CreateProject("Gateway", "GW", "The gateway firmware")
+	r.Status, r.Priority = "PENDING", "HIGH"
+	r.AppendLabel("security", "ui")
+	r.Notes = []Note{{"created", "2024-01-01 10:00:00"}, {"reviewed", "2024-01-02 11:00:00"}}
+	return r
+}
+
+func TestRequirementRoundTrip(t *testing.T) {
+
+	// empty lists are decoded as nil
+	normalize := func(r *Requirement) {
+		if len(r.Labels) == 0 {
+			r.Labels = nil
+		}
+		if len(r.Notes) == 0 {
+			r.Notes = nil
+		}
+	}
+
+	tests := []struct {
+		name string
+		enc  func(r *Requirement) (string, error)
+		dec  func(text string, r *Requirement) error
+	}{
+		{"XML", (*Requirement).XML, func(s string, r *Requirement) error { return xml.Unmarshal([]byte(s), r) }},
+		{"JSON", (*Requirement).JSON, func(s string, r *Requirement) error { return json.Unmarshal([]byte(s), r) }},
+	}
+	for _, tt := range tests {
+		for _, r := range []*Requirement{newTestRequirement(), NewRequirement()} {
+			text, err := tt.enc(r)
+			if err != nil {
+				t.Fatalf("%s: encoding failed: %s", tt.name, err)
+			}
+			got := new(Requirement)
+			if err := tt.dec(text, got); err != nil {
+				t.Fatalf("%s: decoding failed: %s", tt.name, err)
+			}
+			normalize(r)
+			normalize(got)
+			if !reflect.DeepEqual(got, r) {
+				t.Errorf("%s round-trip: expected %+v, got %+v", tt.name, r, got)
+			}
+		}
+	}
+
+	// status and priority are attributes
+	text, _ := newTestRequirement().XML()
+	if !strings.Contains(text, `status="PENDING"`) || !strings.Contains(text, `priority="HIGH"`) {
+		t.Errorf("status and priority are not XML attributes:\n%s", text)
+	}
+}
+
+func TestRequirementSetStatus(t *testing.T) {
+
+	tests := []struct {
+		from, to ReqStatus
+		ok       bool
+	}{
+		{"NEW", "ACKNOWLEDGED", true},
+		{"ACKNOWLEDGED", "PENDING", true},
+		{"PENDING", "APPROVED", true},
+		{"PENDING", "REJECTED", true},
+		{"NEW", "REJECTED", true},
+		{"new", "acknowledged", true},
+		{"UNKNOWN", "APPROVED", true},
+		{"NEW", "NEW", true},
+		{"NEW", "APPROVED", false},
+		{"ACKNOWLEDGED", "NEW", false},
+		{"REJECTED", "APPROVED", false},
+		{"APPROVED", "PENDING", false},
+		{"NEW", "DONE", false},
+	}
+	for _, tt := range tests {
+		r := NewRequirement()
+		r.Status = tt.from
+		err := r.SetStatus(tt.to)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s -> %s: unexpected result %v", tt.from, tt.to, err)
+			continue
+		}
+		if !tt.ok {
+			if !errors.Is(err, ErrorInvalidValue) || r.Status != tt.from || len(r.Notes) != 0 {
+				t.Errorf("%s -> %s: failed transition changed the requirement: %v, %+v", tt.from, tt.to, err, r.Notes)
+			}
+			continue
+		}
+		if r.Status.String() != tt.to.String() {
+			t.Errorf("%s -> %s: status is %s", tt.from, tt.to, r.Status)
+		}
+		// no changelog entry when nothing changes
+		if tt.from == tt.to {
+			if len(r.Notes) != 0 {
+				t.Errorf("%s -> %s: unexpected changelog entry %+v", tt.from, tt.to, r.Notes)
+			}
+		} else if want := "Status changed from " + tt.from.String() + " to " + tt.to.String(); len(r.Notes) != 1 ||
+			r.Notes[0].Text != want {
+			t.Errorf("%s -> %s: expected changelog entry %q, got %+v", tt.from, tt.to, want, r.Notes)
+		}
+	}
+}
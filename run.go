@@ -0,0 +1,65 @@
+package atf
+
+/*
+ * run.go - a convenience entry point for library callers
+ *
+ * The Execute() methods display the progress using the callback and update
+ * the test set in place; RunTestSet() wraps them and returns the results in
+ * a form of the TestReport.
+ */
+
+import (
+	"errors"
+	"fmt"
+	"github.com/mraitmaier/atf/utils"
+	"time"
+)
+
+// RunOptions defines how the test set is executed by RunTestSet().
+// Note that there is no parallelism option: the test cases are always executed one by one, in dependency order.
+type RunOptions struct {
+
+	// Display is a callback displaying the execution progress; when not defined, nothing is displayed
+	Display ExecDisplayFnCback
+
+	// FailFast defines whether the remaining test cases are skipped (marked as not tested) after the first failed case
+	FailFast bool
+
+	// Timeout limits the duration of the whole execution (see TestSet.ExecuteWithDeadline()); no limit when zero
+	Timeout time.Duration
+
+	// ExecOptions are the options used to execute the actions
+	ExecOptions
+}
+
+// RunTestSet validates and executes the given test set according to the given options and returns the TestReport with the
+// execution start and finish timestamps (see utils.Now()). The test set is updated in place and is referenced by the report. If test set is
+// not valid, it is not executed and the validation errors are returned.
+func RunTestSet(ts *TestSet, opts RunOptions) (*TestReport, error) {
+
+	if ts == nil {
+		return nil, fmt.Errorf("%w: test set is not defined", ErrorInvalidValue)
+	}
+	if errs := ts.Validate(); len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	display := opts.Display
+	if display == nil {
+		display = func(...string) {}
+	}
+
+	ts.Initialize()
+	ts.failFast, ts.opts = opts.FailFast, opts.ExecOptions
+	defer func() { ts.failFast, ts.opts = false, ExecOptions{} }()
+
+	tr := CreateTestReport(ts)
+	tr.Started = utils.Now()
+	if opts.Timeout > 0 {
+		ts.ExecuteWithDeadline(&display, opts.Timeout)
+	} else {
+		ts.Execute(&display)
+	}
+	tr.Finished = utils.Now()
+	return tr, nil
+}
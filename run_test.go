@@ -0,0 +1,125 @@
+package atf
+
+import (
+	"errors"
+	"github.com/mraitmaier/atf/utils"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunTestSet(t *testing.T) {
+
+	rec, recorded := newRecorder(t)
+	slow := func(ts *TestSet) {
+		tc := CreateTestCase("slow", "", nil, nil, "Pass", "NotTested")
+		tc.Append(CreateTestStep("sleep", "", "Pass", "NotTested", CreateAction("/bin/sleep", "5")))
+		ts.Append(tc)
+	}
+	tests := []struct {
+		name     string
+		failing  []string
+		modify   func(ts *TestSet)
+		opts     RunOptions
+		want     string
+		statuses []TestResult
+		timedOut bool
+	}{
+		{"all pass", nil, nil, RunOptions{}, "a b c", []TestResult{"Pass", "Pass", "Pass"}, false},
+		{"one fails", []string{"b"}, nil, RunOptions{}, "a b c", []TestResult{"Pass", "Fail", "Pass"}, false},
+		{"fail fast", []string{"a"}, nil, RunOptions{FailFast: true}, "a",
+			[]TestResult{"Fail", "NotTested", "NotTested"}, false},
+		{"timeout", nil, slow, RunOptions{Timeout: 200 * time.Millisecond}, "a b c",
+			[]TestResult{"Pass", "Pass", "Pass", "Fail"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := len(recorded())
+			ts := newRecordingSet(rec, []string{"a", "b", "c"}, tt.failing...)
+			if tt.modify != nil {
+				tt.modify(ts)
+			}
+			tr, err := RunTestSet(ts, tt.opts)
+			if err != nil {
+				t.Fatalf("RunTestSet() failed: %s", err)
+			}
+			if got := strings.Join(recorded()[before:], " "); got != tt.want {
+				t.Errorf("expected executed cases %q, got %q", tt.want, got)
+			}
+			if tr.TestSet != ts || ts.TimedOut != tt.timedOut {
+				t.Errorf("unexpected report test set (timed out: %v)", ts.TimedOut)
+			}
+			for ix, tc := range tr.TestSet.Cases {
+				if tc.Status != tt.statuses[ix] {
+					t.Errorf("case %q: expected status %q, got %q", tc.Name, tt.statuses[ix], tc.Status)
+				}
+			}
+			started, err := time.ParseInLocation(utils.TimestampLayout, tr.Started, time.Local)
+			if err != nil {
+				t.Fatalf("invalid start timestamp %q: %s", tr.Started, err)
+			}
+			finished, err := time.ParseInLocation(utils.TimestampLayout, tr.Finished, time.Local)
+			if err != nil {
+				t.Fatalf("invalid finish timestamp %q: %s", tr.Finished, err)
+			}
+			if finished.Before(started) {
+				t.Errorf("execution finished (%s) before it started (%s)", tr.Finished, tr.Started)
+			}
+			if ts.failFast || !reflect.DeepEqual(ts.opts, ExecOptions{}) {
+				t.Errorf("run options are left in the test set")
+			}
+		})
+	}
+}
+
+func TestRunTestSetOptions(t *testing.T) {
+
+	var messages []string
+	ts := newReportSet(CreateTestStep("Step", "", "Pass", "NotTested", CreateAction("/bin/echo", "hello")))
+	tr, err := RunTestSet(ts, RunOptions{
+		Display:     func(args ...string) { messages = append(messages, strings.Join(args, " ")) },
+		ExecOptions: ExecOptions{PlainOutput: true},
+	})
+	if err != nil {
+		t.Fatalf("RunTestSet() failed: %s", err)
+	}
+	out := strings.Join(messages, "")
+	if !strings.Contains(out, "hello") || strings.Contains(out, "OUTPUT") {
+		t.Errorf("expected plain output to be displayed, got:\n%s", out)
+	}
+	if tr.Stats().Passed != 1 {
+		t.Errorf("expected a passed case in the report, got %+v", tr.Stats())
+	}
+}
+
+func TestRunTestSetErrors(t *testing.T) {
+
+	invalid := newReportSet(CreateTestStep("Step", "", "Maybe", "NotTested", CreateAction("/bin/true", "")))
+	invalid.Cases[0].Name = ""
+	tests := []struct {
+		name string
+		ts   *TestSet
+		err  error
+		errs int
+	}{
+		{"nil", nil, ErrorInvalidValue, 1},
+		{"invalid", invalid, nil, 2},
+	}
+	for _, tt := range tests {
+		tr, err := RunTestSet(tt.ts, RunOptions{})
+		if tr != nil || err == nil {
+			t.Errorf("%s: expected an error, got report %v", tt.name, tr)
+			continue
+		}
+		if tt.err != nil && !errors.Is(err, tt.err) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.err, err)
+		}
+		if n := len(strings.Split(err.Error(), "\n")); n != tt.errs {
+			t.Errorf("%s: expected %d errors, got: %s", tt.name, tt.errs, err)
+		}
+	}
+	if s := invalid.Cases[0].Steps[0].Status; s != "NotTested" {
+		t.Errorf("invalid test set has been executed: step status %q", s)
+	}
+}
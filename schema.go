@@ -0,0 +1,165 @@
+package atf
+
+/*
+ * schema.go - JSON Schema of the JSON config format
+ *
+ * The schema describes the test set as read by the JSON collector, so the
+ * editors can validate the configs and offer autocompletion while authoring.
+ */
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// schema is a single (sub)schema object.
+type schema map[string]interface{}
+
+// Private functions that return the simple schemas.
+func stringSchema() schema               { return schema{"type": "string"} }
+func boolSchema() schema                 { return schema{"type": "boolean"} }
+func integerSchema() schema              { return schema{"type": "integer"} }
+func refSchema(def string) schema        { return schema{"$ref": "#/definitions/" + def} }
+func arraySchema(items schema) schema    { return schema{"type": "array", "items": items} }
+func enumSchema(values ...string) schema { return schema{"type": "string", "enum": values} }
+
+// Private function that returns the schema of an object with given properties and required property names.
+func objectSchema(props schema, required ...string) schema {
+
+	s := schema{"type": "object", "properties": props}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
+
+// GenerateJSONSchema returns a JSON Schema (draft-07) describing the JSON config format: the TestSet with its test cases,
+// test steps and actions, including the required fields and valid values of test results, assertion operators and SUT
+// types.
+func GenerateJSONSchema() string {
+
+	results := enumSchema(ValidTestResults...)
+	ops := enumSchema(string(AssertEquals), string(AssertContains), string(AssertMatches), string(AssertFileExists))
+	aliases := make([]string, 0, len(sutTypeAliases))
+	for alias := range sutTypeAliases {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+	sutTypes := append(append([]string{}, sutTypeNames...), aliases...)
+
+	defs := schema{
+		"Assertion": objectSchema(schema{
+			"Op":       ops,
+			"Actual":   stringSchema(),
+			"Expected": stringSchema(),
+		}, "Op"),
+		"Action": objectSchema(schema{
+			"Script":      stringSchema(),
+			"Args":        stringSchema(),
+			"Result":      results,
+			"Output":      stringSchema(),
+			"Description": stringSchema(),
+			"Executable":  boolSchema(),
+			"Manual":      boolSchema(),
+			"Duration":    schema{"type": "string", "description": "duration string, e.g. \"1m30s\""},
+			"ExitCode":    integerSchema(),
+			"Stdin":       stringSchema(),
+			"Assert":      refSchema("Assertion"),
+			"Classpath":   stringSchema(),
+			"MainClass":   stringSchema(),
+			"Remote":      refSchema("SSHConfig"),
+		}),
+		"SSHConfig": objectSchema(schema{
+			"Host":                  stringSchema(),
+			"User":                  stringSchema(),
+			"PasswordEnv":           stringSchema(),
+			"KeyFile":               stringSchema(),
+			"KnownHosts":            stringSchema(),
+			"InsecureIgnoreHostKey": boolSchema(),
+			"ConnectTimeout":        schema{"type": "string", "description": "duration string, e.g. \"10s\""},
+		}, "Host"),
+		"TestStep": objectSchema(schema{
+			"Name":      stringSchema(),
+			"Expected":  results,
+			"Status":    results,
+			"Action":    refSchema("Action"),
+			"Artifacts": arraySchema(stringSchema()),
+			"Collected": arraySchema(stringSchema()),
+			"Timeout":   schema{"type": "string", "description": "duration string, e.g. \"1m30s\""},
+			"Device":    stringSchema(),
+			"Output":    stringSchema(),
+			"Duration":  schema{"type": "string", "description": "duration string, e.g. \"1m30s\""},
+		}, "Name", "Action"),
+		"TestCase": objectSchema(schema{
+			"Name":        stringSchema(),
+			"Setup":       refSchema("Action"),
+			"Cleanup":     refSchema("Action"),
+			"Expected":    results,
+			"Status":      results,
+			"Steps":       arraySchema(refSchema("TestStep")),
+			"Description": stringSchema(),
+			"BeforeEach":  refSchema("Action"),
+			"AfterEach":   refSchema("Action"),
+			"DependsOn":   arraySchema(stringSchema()),
+		}, "Name"),
+		"SysUnderTest": objectSchema(schema{
+			"Name":        stringSchema(),
+			"Systype":     enumSchema(sutTypes...),
+			"Version":     stringSchema(),
+			"Description": stringSchema(),
+			"IPaddr":      stringSchema(),
+			"Addresses":   arraySchema(stringSchema()),
+			"PingPort":    integerSchema(),
+		}, "Name"),
+		"Device": objectSchema(schema{
+			"Name":        stringSchema(),
+			"Dtype":       integerSchema(),
+			"Description": stringSchema(),
+			"Family":      stringSchema(),
+			"Model":       stringSchema(),
+			"Management":  arraySchema(stringSchema()),
+			"Location":    stringSchema(),
+			"IsDUT":       boolSchema(),
+			"Ports": arraySchema(objectSchema(schema{
+				"Name":        stringSchema(),
+				"Description": stringSchema(),
+				"PortType":    integerSchema(),
+			})),
+			"URI": stringSchema(),
+		}, "Name"),
+		"Topology": objectSchema(schema{
+			"Suts":    arraySchema(refSchema("SysUnderTest")),
+			"Devices": arraySchema(refSchema("Device")),
+			"Links": arraySchema(objectSchema(schema{
+				"A":     stringSchema(),
+				"PortA": stringSchema(),
+				"B":     stringSchema(),
+				"PortB": stringSchema(),
+			}, "A", "B")),
+		}),
+	}
+
+	root := objectSchema(schema{
+		"ID":                  stringSchema(),
+		"Name":                stringSchema(),
+		"Description":         stringSchema(),
+		"Sut":                 refSchema("SysUnderTest"),
+		"Topology":            refSchema("Topology"),
+		"Setup":               refSchema("Action"),
+		"Cleanup":             refSchema("Action"),
+		"BeforeAll":           arraySchema(refSchema("Action")),
+		"AfterAll":            arraySchema(refSchema("Action")),
+		"Cases":               arraySchema(refSchema("TestCase")),
+		"PingSut":             boolSchema(),
+		"Rerun":               boolSchema(),
+		"ContinueOnSetupFail": boolSchema(),
+		"TimedOut":            boolSchema(),
+	}, "Name")
+	root["$schema"] = "http://json-schema.org/draft-07/schema#"
+	root["title"] = "TestSet"
+	root["definitions"] = defs
+
+	// maps of strings and slices are always encoded successfully
+	b, _ := json.MarshalIndent(root, "", "  ")
+	return string(b)
+}
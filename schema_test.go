@@ -0,0 +1,113 @@
+package atf
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// Return the sorted names of the JSON-encoded fields of the given struct type.
+func jsonFields(typ reflect.Type) []string {
+
+	names := make([]string, 0)
+	for ix := 0; ix < typ.NumField(); ix++ {
+		f := typ.Field(ix)
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if f.PkgPath != "" || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Return the sorted property names of the given (sub)schema.
+func schemaProperties(s map[string]interface{}) []string {
+
+	names := make([]string, 0)
+	props, _ := s["properties"].(map[string]interface{})
+	for name := range props {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestGenerateJSONSchema(t *testing.T) {
+
+	var root map[string]interface{}
+	if err := json.Unmarshal([]byte(GenerateJSONSchema()), &root); err != nil {
+		t.Fatalf("schema is not valid JSON: %s", err)
+	}
+	if root["$schema"] != "http://json-schema.org/draft-07/schema#" || root["title"] != "TestSet" {
+		t.Errorf("unexpected schema header: %v %v", root["$schema"], root["title"])
+	}
+	defs, _ := root["definitions"].(map[string]interface{})
+
+	tests := []struct {
+		def      string
+		typ      reflect.Type
+		required []interface{}
+	}{
+		{"", reflect.TypeOf(TestSet{}), []interface{}{"Name"}},
+		{"TestCase", reflect.TypeOf(TestCase{}), []interface{}{"Name"}},
+		{"TestStep", reflect.TypeOf(TestStep{}), []interface{}{"Name", "Action"}},
+		{"Action", reflect.TypeOf(Action{}), nil},
+		{"Assertion", reflect.TypeOf(Assertion{}), []interface{}{"Op"}},
+		{"SSHConfig", reflect.TypeOf(SSHConfig{}), []interface{}{"Host"}},
+		{"SysUnderTest", reflect.TypeOf(SysUnderTest{}), []interface{}{"Name"}},
+		{"Topology", reflect.TypeOf(Topology{}), nil},
+	}
+	for _, tt := range tests {
+		s := root
+		if tt.def != "" {
+			s, _ = defs[tt.def].(map[string]interface{})
+		}
+		if s == nil {
+			t.Errorf("%s: definition is missing", tt.def)
+			continue
+		}
+		if got, want := schemaProperties(s), jsonFields(tt.typ); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: expected properties %v, got %v", tt.typ.Name(), want, got)
+		}
+		if got, _ := s["required"].([]interface{}); !reflect.DeepEqual(got, tt.required) {
+			t.Errorf("%s: expected required %v, got %v", tt.typ.Name(), tt.required, got)
+		}
+	}
+}
+
+func TestGenerateJSONSchemaEnums(t *testing.T) {
+
+	var root struct {
+		Definitions map[string]struct {
+			Properties map[string]struct {
+				Enum []string
+			}
+		}
+	}
+	if err := json.Unmarshal([]byte(GenerateJSONSchema()), &root); err != nil {
+		t.Fatalf("schema is not valid JSON: %s", err)
+	}
+	tests := []struct {
+		def, prop string
+		want      []string
+	}{
+		{"TestStep", "Expected", ValidTestResults},
+		{"TestStep", "Status", ValidTestResults},
+		{"TestCase", "Status", ValidTestResults},
+		{"Action", "Result", ValidTestResults},
+		{"Assertion", "Op", []string{"equals", "contains", "matches", "file-exists"}},
+		{"SysUnderTest", "Systype", []string{"Unknown", "Hardware", "Software", "System", "HW", "HW+SW", "SW"}},
+	}
+	for _, tt := range tests {
+		if got := root.Definitions[tt.def].Properties[tt.prop].Enum; !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s.%s: expected enum %v, got %v", tt.def, tt.prop, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package atf
+
+/*
+ * serializable.go - common interfaces of all serializable and renderable types
+ */
+
+import (
+	"encoding/xml"
+	"fmt"
+)
+
+// Default indentation of the XML output, used by the XML() methods of all the types. Every XML representation is
+// therefore formatted the same way, which keeps the generated files easy to diff.
+const (
+	DefaultXMLPrefix = ""
+	DefaultXMLIndent = "  "
+)
+
+// Serializable is an interface implemented by all the types that can be represented as XML and JSON.
+type Serializable interface {
+	XML() (string, error)
+	XMLIndent(prefix, indent string) (string, error)
+	JSON() (string, error)
+}
+
+// FromXML decodes the given XML text, as produced by the XML() method, back into the given entity. Syntax errors are
+// reported as ErrorConfigSyntax.
+func FromXML(text string, v Serializable) error {
+
+	if err := xml.Unmarshal([]byte(text), v); err != nil {
+		return fmt.Errorf("%w: %s", ErrorConfigSyntax, err)
+	}
+	return nil
+}
+
+// Renderable is an interface implemented by all the entities that can be rendered into report.
+type Renderable interface {
+	Serializable
+	HTML() (string, error)
+}
+
+// make sure all the types implement the interfaces
+var (
+	_ Serializable = (*Action)(nil)
+	_ Serializable = (*TestStep)(nil)
+	_ Serializable = (*TestCase)(nil)
+	_ Serializable = (*TestSet)(nil)
+	_ Serializable = (*TestPlan)(nil)
+	_ Serializable = (*TestReport)(nil)
+	_ Serializable = (*TestResult)(nil)
+	_ Serializable = (*SysUnderTest)(nil)
+	_ Serializable = (*Topology)(nil)
+	_ Serializable = (*GenericDevice)(nil)
+	_ Serializable = (*EthernetDevice)(nil)
+	_ Serializable = (*Server)(nil)
+	_ Serializable = (*Project)(nil)
+	_ Serializable = (*ProjectList)(nil)
+	_ Serializable = (*Requirement)(nil)
+	_ Serializable = (*Note)(nil)
+
+	_ Renderable = (*TestStep)(nil)
+	_ Renderable = (*TestCase)(nil)
+	_ Renderable = (*TestSet)(nil)
+	_ Renderable = (*TestReport)(nil)
+)
@@ -0,0 +1,127 @@
+package atf
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestSerializable(t *testing.T) {
+
+	result := TestResult("Pass")
+	tests := []struct {
+		name string
+		v    Serializable
+	}{
+		{"Action", CreateAction("/bin/true", "-v")},
+		{"TestStep", CreateTestStep("Step", "", "Pass", "NotTested", CreateAction("/bin/true", ""))},
+		{"TestCase", CreateTestCase("Case", "", nil, nil, "Pass", "NotTested")},
+		{"TestSet", newReportSet()},
+		{"TestPlan", CreateTestPlan("Plan", "", nil, nil)},
+		{"TestReport", CreateTestReport(newReportSet())},
+		{"TestResult", &result},
+		{"SysUnderTest", CreateSUT("SUT", "Hardware", "1.0", "", "10.0.0.1")},
+		{"Topology", newStarTopology()},
+		{"GenericDevice", NewGenericDevice("router", DevRouter)},
+		{"EthernetDevice", NewEthernetDevice("switch")},
+		{"Server", NewServer("server")},
+		{"Project", CreateProject("Project", "P", "")},
+		{"ProjectList", NewProjectList()},
+		{"Requirement", NewRequirement()},
+		{"Note", NewNote("note")},
+	}
+	for _, tt := range tests {
+		x, err := tt.v.XML()
+		if err != nil {
+			t.Errorf("%s: XML() failed: %s", tt.name, err)
+			continue
+		}
+		if err := xml.Unmarshal([]byte(x), new(struct{})); err != nil {
+			t.Errorf("%s: XML() returned invalid XML: %s", tt.name, err)
+		}
+		if xi, _ := tt.v.XMLIndent(DefaultXMLPrefix, DefaultXMLIndent); xi != x {
+			t.Errorf("%s: XML() is not indented by default:\n%s\n%s", tt.name, x, xi)
+		}
+		j, err := tt.v.JSON()
+		if err != nil || !json.Valid([]byte(j)) {
+			t.Errorf("%s: JSON() returned invalid JSON %q: %v", tt.name, j, err)
+		}
+	}
+}
+
+func TestRenderable(t *testing.T) {
+
+	tests := []struct {
+		name string
+		v    Renderable
+	}{
+		{"TestStep", CreateTestStep("Step", "", "Pass", "NotTested", CreateAction("/bin/true", ""))},
+		{"TestCase", CreateTestCase("Case", "", nil, nil, "Pass", "NotTested")},
+		{"TestSet", newReportSet()},
+		{"TestReport", CreateTestReport(newReportSet())},
+	}
+	for _, tt := range tests {
+		if html, err := tt.v.HTML(); err != nil || html == "" {
+			t.Errorf("%s: HTML() returned %q, %v", tt.name, html, err)
+		}
+	}
+}
+
+func TestFromXMLSyntaxError(t *testing.T) {
+
+	for _, text := range []string{"", "<Action>", "<Action><Script></Action>"} {
+		if err := FromXML(text, new(Action)); !errors.Is(err, ErrorConfigSyntax) {
+			t.Errorf("FromXML(%q) returned %v", text, err)
+		}
+	}
+}
+
+func TestXMLIndent(t *testing.T) {
+
+	step := CreateTestStep("Step", "", "Pass", "NotTested", CreateAction("/bin/true", ""))
+	tc := CreateTestCase("Case", "", nil, nil, "Pass", "NotTested")
+	tc.Append(step)
+	items := []Serializable{step, tc, newReportSet(step), CreateTestPlan("Plan", "", CreateAction("/bin/true", ""), nil),
+		CreateSUT("SUT", "Hardware", "1.0", "", "10.0.0.1"), newStarTopology(), NewEthernetDevice("switch"),
+		NewProjectList(), NewRequirement(), NewNote("note")}
+
+	tests := []struct {
+		prefix, indent string
+		line           *regexp.Regexp
+	}{
+		{DefaultXMLPrefix, DefaultXMLIndent, regexp.MustCompile(`^(  )*<`)},
+		{"", "\t", regexp.MustCompile(`^\t*<`)},
+		{"# ", "    ", regexp.MustCompile(`^# ( {4})*<`)},
+	}
+	for _, tt := range tests {
+		for _, item := range items {
+			x, err := item.XMLIndent(tt.prefix, tt.indent)
+			if err != nil {
+				t.Fatalf("%T: XMLIndent() failed: %s", item, err)
+			}
+			depth := 0
+			for _, line := range strings.Split(x, "\n") {
+				if !tt.line.MatchString(line) {
+					t.Errorf("%T, %q, %q: line %q is not indented properly", item, tt.prefix, tt.indent, line)
+					break
+				}
+				// every element is indented one level deeper than its parent, at most
+				d := strings.Count(strings.TrimPrefix(line, tt.prefix), tt.indent)
+				if d > depth+1 {
+					t.Errorf("%T, %q, %q: line %q is indented too deep", item, tt.prefix, tt.indent, line)
+					break
+				}
+				depth = d
+			}
+		}
+	}
+
+	// the step is rendered the same way, whether standalone or nested in a case (TestCase > Steps > TestStep)
+	sx, _ := step.XMLIndent(strings.Repeat(DefaultXMLIndent, 2), DefaultXMLIndent)
+	if cx, _ := tc.XML(); !strings.Contains(cx, sx) {
+		t.Errorf("nested step is indented differently:\n%s\n%s", cx, sx)
+	}
+}
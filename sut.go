@@ -12,33 +12,169 @@ import (
 	"encoding/json"
 	"encoding/xml"
 	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// DefaultPingPort is the TCP port used to check whether the SUT is reachable, when no port is configured (SSH).
+const DefaultPingPort = 22
+
+// DefaultPingTimeout defines how long to wait for the SUT to respond when its reachability is checked, when no timeout is
+// defined by the execution options.
+const DefaultPingTimeout = 5 * time.Second
+
+// SutType defines the type of the system under test.
+type SutType int
+
+const (
+	// SutUnknown represents the SUT of unknown type
+	SutUnknown SutType = iota
+
+	// SutHardware represents a hardware SUT
+	SutHardware
+
+	// SutSoftware represents a software SUT
+	SutSoftware
+
+	// SutSystem represents a system built from both HW and SW
+	SutSystem
+)
+
+// SUT type names, indexed by SutType value
+var sutTypeNames = []string{"Unknown", "Hardware", "Software", "System"}
+
+// short SUT type names used by the older configs
+var sutTypeAliases = map[string]SutType{"HW": SutHardware, "SW": SutSoftware, "HW+SW": SutSystem}
+
+// String returns a human-readable representation of the SutType value.
+func (t SutType) String() string {
+	if t < 0 || int(t) >= len(sutTypeNames) {
+		return sutTypeNames[SutUnknown]
+	}
+	return sutTypeNames[t]
+}
+
+// SutTypeFromString converts SUT type given as string into proper SutType value (case-insensitive); the short names ("HW",
+// "SW" and "HW+SW") are accepted, too. If invalid string is given, function returns 'SutUnknown' value.
+func SutTypeFromString(s string) SutType {
+	for ix, name := range sutTypeNames {
+		if strings.EqualFold(name, s) {
+			return SutType(ix)
+		}
+	}
+	if t, ok := sutTypeAliases[strings.ToUpper(s)]; ok {
+		return t
+	}
+	return SutUnknown
+}
+
+// MarshalText implements the encoding.TextMarshaler interface: SUT type is encoded by name in XML, JSON and YAML.
+func (t SutType) MarshalText() ([]byte, error) { return []byte(t.String()), nil }
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface: SUT type is decoded from its name (see
+// SutTypeFromString()), so the configs using free-form type strings can still be read.
+func (t *SutType) UnmarshalText(text []byte) error {
+	*t = SutTypeFromString(string(text))
+	return nil
+}
+
 // SysUnderTest represents a system under test: this either piece of SW or HW or a system built from both HW and SW.
 type SysUnderTest struct {
 
 	// Name of the SUT
-	Name string `xml:"name,attr"`
+	Name string `xml:"name,attr" yaml:"name"`
 
 	// SysType is a SUT System type: basically distinction between HW and SW...
-	Systype string `xml:"Type"`
+	Systype SutType `xml:"Type" yaml:"type"`
 
 	// Version is a SUT version string (basically SUT HW or SW version)
-	Version string `xml:"Version"`
+	Version string `xml:"Version" yaml:"version"`
 
 	// Description is a SUT description text
-	Description string `xml:"Description"`
+	Description string `xml:"Description" yaml:"description"`
 
 	// IPaddr is a SUT IP address (if needed)
-	IPaddr string `xml:"IPAddress"`
+	IPaddr string `xml:"IPAddress" yaml:"ipaddress"`
+
+	// Is SUT up and running? Visible?
+	IsUp bool `xml:"-" json:"-" yaml:"-"`
 
-    // Is SUT up and running? Visible?
-    IsUp bool `xml:"-"`
+	// Addresses is a list of all SUT management addresses; IPaddr is the primary one
+	Addresses []string `xml:"Addresses>Address" yaml:"addresses"`
+
+	// PingPort is a TCP port used to check whether the SUT is reachable (DefaultPingPort, when not defined)
+	PingPort int `xml:"PingPort,omitempty" yaml:"pingport"`
 }
 
-// CreateSUT creates a new SUT instance.
+// CreateSUT creates a new SUT instance; the SUT type is given as string (see SutTypeFromString()).
 func CreateSUT(name, systype, version, descr, ip string) *SysUnderTest {
-	return &SysUnderTest{name, systype, version, descr, ip, false}
+	return &SysUnderTest{Name: name, Systype: SutTypeFromString(systype), Version: version, Description: descr,
+		IPaddr: ip}
+}
+
+// CreateSUTMulti creates a new SUT instance with multiple management addresses; the first one is the primary address.
+func CreateSUTMulti(name, systype, version, descr string, addrs ...string) *SysUnderTest {
+	primary := ""
+	if len(addrs) > 0 {
+		primary = addrs[0]
+	}
+	return &SysUnderTest{Name: name, Systype: SutTypeFromString(systype), Version: version, Description: descr,
+		IPaddr: primary, Addresses: addrs}
+}
+
+// AllAddresses returns a list of all SUT addresses: the primary address first, followed by all the others.
+func (s *SysUnderTest) AllAddresses() []string {
+
+	addrs := make([]string, 0, len(s.Addresses)+1)
+	if s.IPaddr != "" {
+		addrs = append(addrs, s.IPaddr)
+	}
+	for _, a := range s.Addresses {
+		if a != s.IPaddr {
+			addrs = append(addrs, a)
+		}
+	}
+	return addrs
+}
+
+// Clone returns a deep copy of the SUT; nil is returned for nil SUT.
+func (s *SysUnderTest) Clone() *SysUnderTest {
+
+	if s == nil {
+		return nil
+	}
+	c := *s
+	if s.Addresses != nil {
+		c.Addresses = append([]string{}, s.Addresses...)
+	}
+	return &c
+}
+
+// Ping checks whether the SUT is reachable: it attempts a TCP connection to the SUT's addresses (and configured port)
+// within given timeout, one address after another, until the first one succeeds. The IsUp flag is set accordingly.
+// ErrorInvalidValue is returned when the SUT has no address.
+func (s *SysUnderTest) Ping(timeout time.Duration) error {
+
+	s.IsUp = false
+	addrs := s.AllAddresses()
+	if len(addrs) == 0 {
+		return fmt.Errorf("%w: SUT %q has no address", ErrorInvalidValue, s.Name)
+	}
+	port := s.PingPort
+	if port == 0 {
+		port = DefaultPingPort
+	}
+	var err error
+	for _, addr := range addrs {
+		var conn net.Conn
+		if conn, err = net.DialTimeout("tcp", net.JoinHostPort(addr, strconv.Itoa(port)), timeout); err == nil {
+			s.IsUp = true
+			return conn.Close()
+		}
+	}
+	return err
 }
 
 // String returns a human-readable representation of the SUT instance.
@@ -48,16 +184,20 @@ func (s *SysUnderTest) String() string {
 	txt += fmt.Sprintf("          Name: %s\n", s.Name)
 	txt += fmt.Sprintf("          Type: %s\n", s.Systype)
 	txt += fmt.Sprintf("       Version: %s\n", s.Version)
-	txt += fmt.Sprintf("    IP address: %s\n", s.IPaddr)
+	txt += fmt.Sprintf("    IP address: %s\n", strings.Join(s.AllAddresses(), ", "))
 	txt += fmt.Sprintf("   Description: \n%s\n", s.Description)
-	txt += fmt.Sprintf("         is Up? %s\n", s.IsUp)
+	txt += fmt.Sprintf("         is Up? %t\n", s.IsUp)
 	return txt
 }
 
 // XML returns a XML-encoded representation of the SUT instance.
-func (s *SysUnderTest) XML() (string, error) {
+func (s *SysUnderTest) XML() (string, error) { return s.XMLIndent(DefaultXMLPrefix, DefaultXMLIndent) }
+
+// XMLIndent returns the same representation as XML(), but every line begins with the given prefix and is indented
+// with one or more copies of the given indent.
+func (s *SysUnderTest) XMLIndent(prefix, indent string) (string, error) {
 
-	output, err := xml.MarshalIndent(s, "  ", "    ")
+	output, err := xml.MarshalIndent(s, prefix, indent)
 	if err != nil {
 		return "", err
 	}
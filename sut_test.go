@@ -0,0 +1,203 @@
+package atf
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Return a SUT on the local host with the ping port of a listener that is up (or closed, if 'up' is not set).
+func newLocalSut(t *testing.T, up bool) *SysUnderTest {
+
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if up {
+		t.Cleanup(func() { ln.Close() })
+	} else {
+		ln.Close()
+	}
+	sut := CreateSUT("Local", "Software", "1.0", "", "127.0.0.1")
+	sut.PingPort = ln.Addr().(*net.TCPAddr).Port
+	return sut
+}
+
+func TestSutPing(t *testing.T) {
+
+	tests := []struct {
+		sut *SysUnderTest
+		up  bool
+	}{
+		{newLocalSut(t, true), true},
+		{newLocalSut(t, false), false},
+		{CreateSUT("Invalid", "Software", "1.0", "", "not an address"), false},
+	}
+	for _, tt := range tests {
+		tt.sut.IsUp = !tt.up
+		err := tt.sut.Ping(time.Second)
+		if (err == nil) != tt.up || tt.sut.IsUp != tt.up {
+			t.Errorf("%s:%d: expected up %t, got %t (%v)", tt.sut.IPaddr, tt.sut.PingPort, tt.up, tt.sut.IsUp, err)
+		}
+	}
+
+	// SUT without address cannot be checked
+	sut := CreateSUT("None", "Software", "1.0", "", "")
+	sut.IsUp = true
+	if err := sut.Ping(time.Second); !errors.Is(err, ErrorInvalidValue) || sut.IsUp {
+		t.Errorf("expected invalid value error for SUT without address, got %v", err)
+	}
+
+	// the secondary addresses are tried, when the primary one is not reachable
+	sut = newLocalSut(t, true)
+	sut.IPaddr, sut.Addresses = "not an address", []string{"127.0.0.1"}
+	if err := sut.Ping(time.Second); err != nil || !sut.IsUp {
+		t.Errorf("expected SUT to be up on secondary address, got %v", err)
+	}
+}
+
+func TestTestSetPingSut(t *testing.T) {
+
+	tests := []struct {
+		up     bool
+		status TestResult
+	}{
+		{true, "Pass"},
+		{false, "NotTested"},
+	}
+	for _, tt := range tests {
+		ts := newReportSet(CreateTestStep("s", "", "Pass", "NotTested", CreateAction("/bin/true", "")))
+		ts.Sut, ts.PingSut = newLocalSut(t, tt.up), true
+		ts.ExecuteWithOptions(quietDisplay(), ExecOptions{SutPingTimeout: time.Second})
+		if st := ts.Cases[0].Steps[0].Status; st != tt.status || ts.Sut.IsUp != tt.up {
+			t.Errorf("SUT up %t: expected step status %s, got %s", tt.up, tt.status, st)
+		}
+	}
+}
+
+func TestSutAddresses(t *testing.T) {
+
+	tests := []struct {
+		sut  *SysUnderTest
+		addr []string
+	}{
+		{CreateSUTMulti("Multi", "System", "2.0", "Multi-homed", "10.0.0.1", "192.168.0.1", "fd00::1"),
+			[]string{"10.0.0.1", "192.168.0.1", "fd00::1"}},
+		{CreateSUTMulti("None", "System", "2.0", ""), []string{}},
+		{CreateSUT("Single", "Hardware", "1.0", "", "10.0.0.2"), []string{"10.0.0.2"}},
+	}
+	for _, tt := range tests {
+		if got := tt.sut.AllAddresses(); !reflect.DeepEqual(got, tt.addr) {
+			t.Errorf("%s: expected addresses %v, got %v", tt.sut.Name, tt.addr, got)
+		}
+		if txt := tt.sut.String(); !strings.Contains(txt, strings.Join(tt.addr, ", ")) {
+			t.Errorf("%s: addresses are not listed:\n%s", tt.sut.Name, txt)
+		}
+
+		text, err := tt.sut.XML()
+		if err != nil {
+			t.Fatalf("XML() failed: %s", err)
+		}
+		x := new(SysUnderTest)
+		if err := xml.Unmarshal([]byte(text), x); err != nil || !reflect.DeepEqual(x.AllAddresses(), tt.addr) ||
+			x.Systype != tt.sut.Systype {
+			t.Errorf("%s: XML round-trip returned %+v (%v)", tt.sut.Name, x, err)
+		}
+		if text, err = tt.sut.JSON(); err != nil {
+			t.Fatalf("JSON() failed: %s", err)
+		}
+		j := new(SysUnderTest)
+		if err := json.Unmarshal([]byte(text), j); err != nil || !reflect.DeepEqual(j, tt.sut) {
+			t.Errorf("%s: JSON round-trip: expected %+v, got %+v (%v)", tt.sut.Name, tt.sut, j, err)
+		}
+	}
+
+	html := CreateTestReport(CreateTestSet("Set", "", tests[0].sut, nil, nil)).addSut2Html(tests[0].sut)
+	if !strings.Contains(html, "10.0.0.1<br />192.168.0.1<br />fd00::1") {
+		t.Errorf("addresses are not listed in the HTML report:\n%s", html)
+	}
+}
+
+func TestSutTypeFromString(t *testing.T) {
+
+	tests := []struct {
+		in   string
+		want SutType
+		name string
+	}{
+		{"Hardware", SutHardware, "Hardware"},
+		{"software", SutSoftware, "Software"},
+		{"SYSTEM", SutSystem, "System"},
+		{"HW", SutHardware, "Hardware"},
+		{"sw", SutSoftware, "Software"},
+		{"hw+sw", SutSystem, "System"},
+		{"Unknown", SutUnknown, "Unknown"},
+		{"", SutUnknown, "Unknown"},
+		{"firmware", SutUnknown, "Unknown"},
+	}
+	for _, tt := range tests {
+		got := SutTypeFromString(tt.in)
+		if got != tt.want || got.String() != tt.name {
+			t.Errorf("SutTypeFromString(%q): expected %s, got %s", tt.in, tt.name, got)
+		}
+		var u SutType
+		if err := u.UnmarshalText([]byte(tt.in)); err != nil || u != tt.want {
+			t.Errorf("UnmarshalText(%q): expected %s, got %s (%v)", tt.in, tt.want, u, err)
+		}
+	}
+	if s := SutType(42).String(); s != "Unknown" {
+		t.Errorf("out of range SutType: expected 'Unknown', got %q", s)
+	}
+}
+
+func TestSutTypeEncoding(t *testing.T) {
+
+	tests := []struct {
+		text   string
+		decode func(string, interface{}) error
+		want   SutType
+	}{
+		{`<SysUnderTest name="S"><Type>HW</Type></SysUnderTest>`,
+			func(s string, v interface{}) error { return xml.Unmarshal([]byte(s), v) }, SutHardware},
+		{`<SysUnderTest name="S"><Type>Software</Type></SysUnderTest>`,
+			func(s string, v interface{}) error { return xml.Unmarshal([]byte(s), v) }, SutSoftware},
+		{`{"Name": "S", "Systype": "HW+SW"}`,
+			func(s string, v interface{}) error { return json.Unmarshal([]byte(s), v) }, SutSystem},
+		{`{"Name": "S", "Systype": "whatever"}`,
+			func(s string, v interface{}) error { return json.Unmarshal([]byte(s), v) }, SutUnknown},
+	}
+	for _, tt := range tests {
+		sut := new(SysUnderTest)
+		if err := tt.decode(tt.text, sut); err != nil {
+			t.Fatalf("decoding %q failed: %s", tt.text, err)
+		}
+		if sut.Systype != tt.want {
+			t.Errorf("decoding %q: expected %s, got %s", tt.text, tt.want, sut.Systype)
+		}
+
+		x, err := sut.XML()
+		if err != nil {
+			t.Fatalf("XML() failed: %s", err)
+		}
+		if !strings.Contains(x, "<Type>"+tt.want.String()+"</Type>") {
+			t.Errorf("SUT type is not encoded by name in XML:\n%s", x)
+		}
+		j, err := sut.JSON()
+		if err != nil {
+			t.Fatalf("JSON() failed: %s", err)
+		}
+		if !strings.Contains(j, `"Systype":"`+tt.want.String()+`"`) {
+			t.Errorf("SUT type is not encoded by name in JSON:\n%s", j)
+		}
+		html := CreateTestReport(CreateTestSet("Set", "", sut, nil, nil)).addSut2Html(sut)
+		if !strings.Contains(html, "<tr><td>Type</td><td>"+tt.want.String()+"</td></tr>") {
+			t.Errorf("SUT type is not rendered in the HTML report:\n%s", html)
+		}
+	}
+}
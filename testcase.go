@@ -18,34 +18,64 @@ package atf
  */
 
 import (
+	"context"
 	"encoding/json"
 	"encoding/xml"
 	"fmt"
+	"time"
 )
 
 // TestCase represents a single test case.
 type TestCase struct {
 
 	// Name of the test case; in XML, this is an attribute
-	Name string `xml:"name,attr"`
+	Name string `xml:"name,attr" yaml:"name"`
 
 	// Setup is a test case setup action
-	Setup *Action `xml:"Setup"`
+	Setup *Action `xml:"Setup" yaml:"setup"`
 
 	// Cleanup is a test case cleanup action
-	Cleanup *Action `xml:"Cleanup"`
+	Cleanup *Action `xml:"Cleanup" yaml:"cleanup"`
 
 	// Expected is expected result for this test case: either pass or expected fail; in XML, this is an attribute
-	Expected TestResult `xml:"expected,attr"`
+	Expected TestResult `xml:"expected,attr" yaml:"expected"`
 
 	// Status is actual result for this test case after execution; in XML, this is an attribute
-	Status TestResult `xml:"status,attr"`
+	Status TestResult `xml:"status,attr" yaml:"status"`
 
 	// Steps is a list of test steps; in XML, this is a sequence of <TestStep> tags
-	Steps []*TestStep `xml:"Steps>TestStep"`
+	Steps []*TestStep `xml:"Steps>TestStep" yaml:"steps"`
 
 	// Description is a detailed description of the test case
-	Description string
+	Description string `yaml:"description"`
+
+	// BeforeEach is an action executed before every test step
+	BeforeEach *Action `xml:"BeforeEach" yaml:"beforeeach"`
+
+	// AfterEach is an action executed after every test step
+	AfterEach *Action `xml:"AfterEach" yaml:"aftereach"`
+
+	// DependsOn is a list of test case names that must succeed before this case is executed
+	DependsOn []string `xml:"DependsOn>Case" yaml:"dependson"`
+
+	// has any of the before/after-each hooks failed during execution?
+	hookFailed bool
+
+	// hooksDuration is the total time spent in all runs of the before/after-each hooks during execution
+	hooksDuration time.Duration
+
+	// events is an optional sink receiving the execution events, set is the name of the parent test set
+	events EventSink
+	set    string
+
+	// stepDone is an optional callback invoked after every executed step
+	stepDone func()
+
+	// ctx is an optional context of the parent execution; when it's done, the remaining steps are not executed
+	ctx context.Context
+
+	// opts are the execution options given by the parent execution
+	opts ExecOptions
 }
 
 // String returns a human-readable representation of the TestSet instance.
@@ -92,10 +122,15 @@ func (tc *TestCase) Initialize() {
 	}
 }
 
-// XML returns an XML-encoded representation of the TestSet instance.
-func (tc *TestCase) XML() (string, error) {
+// XML returns an XML-encoded representation of the TestCase instance. No prefix is used, so the output can be embedded
+// into other XML documents as is.
+func (tc *TestCase) XML() (string, error) { return tc.XMLIndent(DefaultXMLPrefix, DefaultXMLIndent) }
 
-	output, err := xml.MarshalIndent(tc, "  ", "    ")
+// XMLIndent returns the same representation as XML(), but every line begins with the given prefix and is indented
+// with one or more copies of the given indent.
+func (tc *TestCase) XMLIndent(prefix, indent string) (string, error) {
+
+	output, err := xml.MarshalIndent(tc, prefix, indent)
 	if err != nil {
 		return "", err
 	}
@@ -111,10 +146,37 @@ func (tc *TestCase) JSON() (string, error) {
 	return string(b[:]), err
 }
 
-// HTML returns an HTML-encoded representation of the TestSet instance.
+// HTML returns an HTML-encoded representation of the TestCase instance: an <article> with the table of all the actions.
 func (tc *TestCase) HTML() (string, error) {
-	// TODO
-	return "", nil
+
+	html := "<article>\n"
+	html += fmt.Sprintf("<h3>Test Case: %s (%s)</h3>", escapeHTML(tc.Name), fmtDuration(tc.Duration()))
+	html += "<table>\n"
+	html += fmt.Sprintf("<tr><th class=%q>Name</th><th>Action</th>", "name")
+	html += fmt.Sprintf("<th class=%q>Expected Status</th>", "status")
+	html += fmt.Sprintf("<th class=%q>Status</th></tr>\n", "status")
+	if tc.Setup != nil {
+		html += fmt.Sprintf("<tr><td>Setup</td><td>%s</td><td>Pass</td>",
+			escapeHTML(tc.Setup.String()))
+		html += fmt.Sprintf("<td class=%q>%s</td></tr>\n",
+			resolveHTMLClass(tc.Setup), tc.Setup.Result)
+	}
+	for _, step := range tc.Steps {
+		h, err := step.HTML()
+		if err != nil {
+			return "", err
+		}
+		html += h
+	}
+	if tc.Cleanup != nil {
+		html += fmt.Sprintf("<tr><td>Cleanup</td><td>%s</td><td>Pass</td>",
+			escapeHTML(tc.Cleanup.String()))
+		html += fmt.Sprintf("<td class=%q>%s</td></tr>\n",
+			resolveHTMLClass(tc.Cleanup), tc.Cleanup.Result)
+	}
+	html += fmt.Sprintln("</table><p />")
+	html += "</article>\n"
+	return html, nil
 }
 
 // Append appends one or more test steps to a list of steps.
@@ -135,48 +197,123 @@ func (tc *TestCase) cleanupAfterCaseSetupFail() string {
 	return output
 }
 
+// Execute the given before/after-each hook (if not empty) and remember when it fails.
+func (tc *TestCase) executeHook(kind string, hook *Action, disp ExecDisplayFnCback) {
+
+	if !hook.IsExecutable() {
+		return
+	}
+	disp("notice", fmt.Sprintf("Executing %s hook: %q\n", kind, hook.String()))
+	disp("info", tc.opts.formatOutput(hook.ExecuteWithOptions(orBackground(tc.ctx), tc.opts)))
+	tc.hooksDuration += time.Duration(hook.Duration)
+	if hook.Result.Failed() {
+		emit(tc.events, Event{Type: HookFailed, Set: tc.set, Case: tc.Name, Message: kind + " hook"})
+		disp("error", fmt.Sprintf("The %s hook has FAILED\n", kind))
+		tc.hookFailed = true
+	}
+}
+
+// Duration returns the duration of the test case: the sum of all its executed actions' durations, including setup, cleanup
+// and every run of the before/after-each hooks. Steps that were not executed are not counted.
+func (tc *TestCase) Duration() time.Duration {
+
+	d := actionsDuration(tc.Setup, tc.Cleanup) + tc.hooksDuration
+	for _, step := range tc.Steps {
+		if step.Status != "NotTested" {
+			d += actionsDuration(step.Action)
+		}
+	}
+	return d
+}
+
+// StepsByExpected returns the test steps with the given expected status.
+func (tc *TestCase) StepsByExpected(r TestResult) []*TestStep {
+
+	steps := make([]*TestStep, 0)
+	for _, step := range tc.Steps {
+		if step.Expected == r {
+			steps = append(steps, step)
+		}
+	}
+	return steps
+}
+
 // Execute executes the entire TestCase.
-func (tc *TestCase) Execute(display *ExecDisplayFnCback) {
+func (tc *TestCase) Execute(display *ExecDisplayFnCback) { tc.execute(display, "") }
+
+// ExecuteFiltered executes the TestCase, but only the steps with the given expected status are executed; the rest of the
+// steps are marked as not tested (and are therefore neutral when case is evaluated).
+func (tc *TestCase) ExecuteFiltered(display *ExecDisplayFnCback, only TestResult) { tc.execute(display, only) }
+
+// Execute the TestCase; when 'only' is defined, only the steps with this expected status are executed.
+func (tc *TestCase) execute(display *ExecDisplayFnCback, only TestResult) {
 
 	// we turn function ptr back to function
 	disp := *display
 
 	// and start with execution...
 	disp("notice", fmt.Sprintf(">>> Entering TestCase %q\n", tc.Name))
+	start := time.Now()
+	emit(tc.events, Event{Type: CaseStarted, Set: tc.set, Case: tc.Name})
 
 	// let's execute setup action (if not empty)
-	if tc.Setup != nil && tc.Setup.Executable {
+	if tc.Setup.IsExecutable() {
 		disp("notice", fmt.Sprintf("Executing case setup action: %q\n",
 			tc.Setup.String()))
-		disp("info", FmtOutput(tc.Setup.Execute()))
+		disp("info", tc.opts.formatOutput(tc.Setup.ExecuteWithOptions(orBackground(tc.ctx), tc.opts)))
 		// if setup action has failed, skip the rest of the case
-		if tc.Setup.Result == "Fail" {
+		if tc.Setup.Result.Failed() {
+			emit(tc.events, Event{Type: SetupFailed, Set: tc.set, Case: tc.Name})
 			disp("error", tc.cleanupAfterCaseSetupFail())
 		}
 	} else {
 		disp("notice", fmt.Sprintln("Setup action is not defined."))
 	}
 
-	// now we execute the steps...
+	// now we execute the steps, each one wrapped with before/after-each hooks...
+	tc.hookFailed, tc.hooksDuration = false, 0
 	if tc.Steps != nil {
 		for _, step := range tc.Steps {
+			if tc.ctx != nil && tc.ctx.Err() != nil {
+				disp("warning", fmt.Sprintf("Skipping test step %q: %s\n", step.Name, tc.ctx.Err()))
+				step.Status = "NotTested"
+				if tc.stepDone != nil {
+					tc.stepDone()
+				}
+				continue
+			}
+			if only != "" && step.Expected != only {
+				disp("info", fmt.Sprintf("Skipping test step %q: expected status is not %q\n", step.Name, only))
+				step.Status = "NotTested"
+				if tc.stepDone != nil {
+					tc.stepDone()
+				}
+				continue
+			}
+			tc.executeHook("before-each", tc.BeforeEach, disp)
+			step.events, step.set, step.tcase, step.ctx, step.opts = tc.events, tc.set, tc.Name, tc.ctx, tc.opts
 			step.Execute(display)
+			tc.executeHook("after-each", tc.AfterEach, disp)
+			if tc.stepDone != nil {
+				tc.stepDone()
+			}
 		}
 	}
 
 	// let's execute cleanup action (if not empty)
-	if tc.Cleanup != nil && tc.Cleanup.Executable {
+	if tc.Cleanup.IsExecutable() {
 		disp("notice", fmt.Sprintf("Executing case cleanup action: %q\n",
 			tc.Cleanup.String()))
-		if tc.Setup != nil {
-			disp("info", FmtOutput(tc.Setup.Execute()))
-		}
+		// cleanup is executed regardless of the deadline, otherwise the case's resources would leak
+		disp("info", tc.opts.formatOutput(tc.Cleanup.ExecuteWithOptions(context.Background(), tc.opts)))
 	} else {
 		disp("notice", fmt.Sprintln("Cleanup action is not defined."))
 	}
 	// now we evaluate the complete test case
 	tc.evaluate()
 	disp("notice", fmt.Sprintf("Test case evaluated to %q\n", tc.Status))
+	emit(tc.events, Event{Type: CaseFinished, Set: tc.set, Case: tc.Name, Status: tc.Status,
+		Duration: time.Since(start)})
 	disp("notice", fmt.Sprintf("<<< Leaving TestCase %q\n", tc.Name))
 }
 
@@ -193,10 +330,33 @@ func (tc *TestCase) Execute(display *ExecDisplayFnCback) {
 // - if expected status is XFail and any of the steps passes, the whole test
 //   case is evaluated to Fail. Test case passes only if all actions fail.
 // - The NotTested status is treated neutral.
+// - The Error status (step could not be executed) always fails the whole
+//   test case, regardless of the expected status.
+// - The before/after-each hooks are ignored, unless any of them fails: in
+//   that case the whole test case fails.
+// - A test case without steps tests nothing: it is evaluated to NotTested,
+//   regardless of the expected status and of cleanup result, unless its
+//   setup action has failed (or could not be executed): then it fails.
 func (tc *TestCase) evaluate() {
 
 	tc.Status = "Pass" // initial values is NotTested
 
+	// a failed hook fails the case, regardless of expected status
+	if tc.hookFailed {
+		tc.Status = "Fail"
+		return
+	}
+
+	// there's nothing to evaluate without steps, but the failed setup still fails the case
+	if len(tc.Steps) == 0 {
+		if tc.Setup != nil && tc.Setup.Result.Failed() {
+			tc.Status = "Fail"
+		} else {
+			tc.Status = "NotTested"
+		}
+		return
+	}
+
 	// otherwise compare steps' expected and final results
 	switch tc.Expected {
 	case "Pass":
@@ -212,70 +372,81 @@ func (tc *TestCase) evaluate() {
 // Evaluate the test case status when expected status is XFail.
 func (tc *TestCase) evaluateExpectedFail() {
 
-	// evaluate setup and cleanup actions; if setup or cleanup have passed, the complete test case fails
-	if tc.Setup != nil && tc.Setup.Result == "Pass" {
+	// evaluate setup and cleanup actions; if setup or cleanup have passed (or could not be executed), the complete test
+	// case fails
+	if tc.Setup != nil && (tc.Setup.Result == "Pass" || tc.Setup.Result == "Error") {
 		tc.Status = "Fail"
 		return
 	}
-	if tc.Cleanup != nil && tc.Cleanup.Result == "Pass" {
+	if tc.Cleanup != nil && (tc.Cleanup.Result == "Pass" || tc.Cleanup.Result == "Error") {
 		tc.Status = "Fail"
 		return
 	}
 
-	// If any of the steps passes, the whole test case fails.
-	nottested := 0 // we count the NotTested occurences
-	for _, step := range tc.Steps {
-		switch step.Status {
-
-		case "Pass":
-			tc.Status = "Fail"
-			return
-
-		case "NotTested":
-			nottested++
-		}
-	}
-
-	// If all steps' statuses are NotTested, the whole case is obviously evaluated to NotTested.
-	if nottested == len(tc.Steps) {
-		tc.Status = "NotTested"
-	}
+	// the steps are evaluated as defined by CombineResults()
+	tc.Status = CombineResults("XFail", tc.stepStatuses())
 }
 
 // Evaluate the test case status when expected status is Pass.
 func (tc *TestCase) evaluateExpectedPass() {
 
 	// evaluate setup and cleanup actions
-	if tc.Setup != nil && tc.Setup.Result == "Fail" {
+	if tc.Setup != nil && tc.Setup.Result.Failed() {
 		tc.Status = "Fail"
 		return
 	}
-	if tc.Cleanup != nil && tc.Cleanup.Result == "Fail" {
+	if tc.Cleanup != nil && tc.Cleanup.Result.Failed() {
 		tc.Status = "Fail"
 		return
 	}
 
-	// If any of the steps fails, the whole test case fails.
-	nottested := 0 // we count NotTested occurences
-	for _, step := range tc.Steps {
-		switch step.Status {
-		case "Fail":
-			tc.Status = "Fail"
-			return
-		case "NotTested":
-			nottested++
-		}
+	// the steps are evaluated as defined by CombineResults()
+	tc.Status = CombineResults("Pass", tc.stepStatuses())
+}
+
+// Return the list of statuses of all the steps.
+func (tc *TestCase) stepStatuses() []TestResult {
+
+	statuses := make([]TestResult, len(tc.Steps))
+	for ix, step := range tc.Steps {
+		statuses[ix] = step.Status
 	}
+	return statuses
+}
 
-	// If all steps' statuses are NotTested, the whole case is obviously
-	// evaluated to NotTested.
-	if nottested == len(tc.Steps) {
-		tc.Status = "NotTested"
+// Clone returns a deep copy of the test case; nil is returned for nil case.
+func (tc *TestCase) Clone() *TestCase {
+
+	if tc == nil {
+		return nil
+	}
+	c := &TestCase{
+		Name:        tc.Name,
+		Setup:       tc.Setup.Clone(),
+		Cleanup:     tc.Cleanup.Clone(),
+		Expected:    tc.Expected,
+		Status:      tc.Status,
+		Description: tc.Description,
+		BeforeEach:  tc.BeforeEach.Clone(),
+		AfterEach:   tc.AfterEach.Clone(),
+
+		hooksDuration: tc.hooksDuration,
+	}
+	if tc.Steps != nil {
+		c.Steps = make([]*TestStep, len(tc.Steps))
+		for ix, step := range tc.Steps {
+			c.Steps[ix] = step.Clone()
+		}
+	}
+	if tc.DependsOn != nil {
+		c.DependsOn = append([]string{}, tc.DependsOn...)
 	}
+	return c
 }
 
 // CreateTestCase creates a new instance of TestCase.
 func CreateTestCase(name, descr string, setup, cleanup *Action, expected, status TestResult) *TestCase {
 	var steps []*TestStep
-	return &TestCase{name, setup, cleanup, expected, status, steps, descr}
+	return &TestCase{Name: name, Setup: setup, Cleanup: cleanup, Expected: expected, Status: status, Steps: steps,
+		Description: descr}
 }
@@ -0,0 +1,264 @@
+package atf
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTestCaseStepHooks(t *testing.T) {
+
+	rec, recorded := newRecorder(t)
+	tests := []struct {
+		expected TestResult
+		steps    []string
+		after    string
+		order    string
+		status   TestResult
+	}{
+		{"Pass", []string{"s1", "s2", "s3"}, "ae", "be s1 ae be s2 ae be s3 ae", "Pass"},
+		{"XFail", []string{"s1 1", "s2 1"}, "ae", "be s1 ae be s2 ae", "Pass"},
+		{"Pass", []string{"s1", "s2"}, "ae 1", "be s1 ae be s2 ae", "Fail"},
+		{"Pass", nil, "ae", "", "NotTested"},
+	}
+	for ix, tt := range tests {
+		tc := CreateTestCase("Case", "", nil, nil, tt.expected, "NotTested")
+		for _, args := range tt.steps {
+			tc.Append(CreateTestStep(args, "", "Pass", "NotTested", CreateAction(rec, args)))
+		}
+		tc.BeforeEach, tc.AfterEach = CreateAction(rec, "be"), CreateAction(rec, tt.after)
+		start := len(recorded())
+		tc.Execute(quietDisplay())
+
+		if got := strings.Join(recorded()[start:], " "); got != tt.order {
+			t.Errorf("#%d: expected execution order %q, got %q", ix, tt.order, got)
+		}
+		if tc.Status != tt.status {
+			t.Errorf("#%d: expected case status %s, got %s", ix, tt.status, tc.Status)
+		}
+	}
+}
+
+func TestTestCaseCleanup(t *testing.T) {
+
+	rec, recorded := newRecorder(t)
+	tc := CreateTestCase("Case", "", CreateAction(rec, "setup"), CreateAction(rec, "cleanup"), "Pass", "NotTested")
+	tc.Append(CreateTestStep("Step", "", "Pass", "NotTested", CreateAction(rec, "step")))
+	tc.Execute(quietDisplay())
+
+	if got := strings.Join(recorded(), " "); got != "setup step cleanup" {
+		t.Errorf("expected execution order %q, got %q", "setup step cleanup", got)
+	}
+	if tc.Cleanup.Result != "Pass" {
+		t.Errorf("expected cleanup result Pass, got %s", tc.Cleanup.Result)
+	}
+}
+
+// Create a case with two steps expected to pass (the second one fails) and a step expected to fail.
+func newFilteredCase(rec string) *TestCase {
+
+	tc := CreateTestCase("Case", "", nil, nil, "Pass", "NotTested")
+	tc.Append(
+		CreateTestStep("p1", "", "Pass", "NotTested", CreateAction(rec, "p1")),
+		CreateTestStep("p2", "", "Pass", "NotTested", CreateAction(rec, "p2 1")),
+		CreateTestStep("x1", "", "XFail", "NotTested", CreateAction(rec, "x1 1")),
+	)
+	return tc
+}
+
+func TestTestCaseStepsByExpected(t *testing.T) {
+
+	tc := newFilteredCase("/bin/true")
+	tests := []struct {
+		expected TestResult
+		want     []string
+	}{
+		{"Pass", []string{"p1", "p2"}},
+		{"XFail", []string{"x1"}},
+		{"Fail", []string{}},
+	}
+	for _, tt := range tests {
+		names := make([]string, 0)
+		for _, step := range tc.StepsByExpected(tt.expected) {
+			names = append(names, step.Name)
+		}
+		if strings.Join(names, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("%s: expected steps %v, got %v", tt.expected, tt.want, names)
+		}
+	}
+}
+
+func TestTestCaseExecuteFiltered(t *testing.T) {
+
+	rec, recorded := newRecorder(t)
+	tests := []struct {
+		only     TestResult
+		order    string
+		statuses string
+		status   TestResult
+	}{
+		{"", "p1 p2 x1", "Pass Fail Pass", "Fail"},
+		{"Pass", "p1 p2", "Pass Fail NotTested", "Fail"},
+		{"XFail", "x1", "NotTested NotTested Pass", "Pass"},
+		{"Fail", "", "NotTested NotTested NotTested", "NotTested"},
+	}
+	for _, tt := range tests {
+		tc := newFilteredCase(rec)
+		start := len(recorded())
+		tc.ExecuteFiltered(quietDisplay(), tt.only)
+
+		if got := strings.Join(recorded()[start:], " "); got != tt.order {
+			t.Errorf("%q: expected executed steps %q, got %q", tt.only, tt.order, got)
+		}
+		statuses := make([]string, 0, len(tc.Steps))
+		for _, step := range tc.Steps {
+			statuses = append(statuses, string(step.Status))
+		}
+		if got := strings.Join(statuses, " "); got != tt.statuses {
+			t.Errorf("%q: expected step statuses %q, got %q", tt.only, tt.statuses, got)
+		}
+		if tc.Status != tt.status {
+			t.Errorf("%q: expected case status %s, got %s", tt.only, tt.status, tc.Status)
+		}
+	}
+}
+
+func TestTestCaseXMLRoundTrip(t *testing.T) {
+
+	// a fully defined test case, as after execution
+	full := CreateTestCase("Case <&> \"quoted\"", "Multi-line\ndescription", CreateAction("setup.sh", "--clean"),
+		CreateAction("cleanup.sh", ""), "XFail", "Pass")
+	full.BeforeEach, full.AfterEach = CreateAction("before.sh", ""), CreateManualAction("Check the LEDs")
+	full.DependsOn = []string{"First", "Second"}
+	step := CreateTestStep("Step", "", "Pass", "Fail", CreateAction("check.py", "-v 10.0.0.1"))
+	step.Action.Result, step.Action.Output, step.Action.ExitCode = "Fail", "error: <timeout>\n", 2
+	step.Action.Duration, step.Duration = Duration(1500*time.Millisecond), Duration(1600*time.Millisecond)
+	step.Action.Stdin = "payload"
+	step.Artifacts, step.Timeout, step.Device, step.Output = []string{"capture.pcap"}, Duration(time.Minute), "switch", "error"
+	full.Append(step, CreateTestStep("Manual step", "", "Pass", "NotTested", CreateManualAction("Press the button")),
+		CreateTestStep("Assertion", "", "Pass", "Pass", CreateAssertAction(AssertContains, "link is up", "up")))
+
+	tests := []struct {
+		name string
+		tc   *TestCase
+	}{
+		{"empty", CreateTestCase("Empty", "", nil, nil, "Pass", "NotTested")},
+		{"single step", func() *TestCase {
+			tc := CreateTestCase("Case", "", nil, nil, "Pass", "NotTested")
+			tc.Append(CreateTestStep("Step", "", "Pass", "NotTested", CreateAction("/bin/true", "")))
+			return tc
+		}()},
+		{"full", full},
+	}
+	for _, tt := range tests {
+		x, err := tt.tc.XML()
+		if err != nil {
+			t.Fatalf("%s: XML() failed: %s", tt.name, err)
+		}
+		if !strings.HasPrefix(x, "<TestCase ") {
+			t.Errorf("%s: root element is indented: %q", tt.name, x[:20])
+		}
+		got := new(TestCase)
+		if err := FromXML(x, got); err != nil {
+			t.Fatalf("%s: XML cannot be decoded: %s", tt.name, err)
+		}
+		if !reflect.DeepEqual(got, tt.tc) {
+			gx, _ := got.XML()
+			t.Errorf("%s: decoded test case differs:\n%s\n%s", tt.name, x, gx)
+		}
+	}
+}
+
+func TestTestCaseDuration(t *testing.T) {
+
+	timed := func(d time.Duration) *Action {
+		a := CreateAction("/bin/true", "")
+		a.Duration = Duration(d)
+		return a
+	}
+	ms := time.Millisecond
+	skipped := newStatsCase("Skipped", "Pass", 100*ms, 200*ms)
+	skipped.Steps[1].Status = "NotTested"
+	withHooks := newStatsCase("Hooks", "Pass", 100*ms, 200*ms)
+	withHooks.Setup, withHooks.Cleanup = timed(30*ms), timed(20*ms)
+
+	tests := []struct {
+		name string
+		tc   *TestCase
+		want time.Duration
+		html string
+	}{
+		{"no steps", newStatsCase("Empty", "NotTested"), 0, "0s"},
+		{"two timed steps", newStatsCase("Two", "Pass", 1200*ms, 300*ms), 1500 * ms, "1.5s"},
+		{"setup and cleanup", withHooks, 350 * ms, "350ms"},
+		{"not tested step", skipped, 100 * ms, "100ms"},
+	}
+	ts := CreateTestSet("Set", "", nil, timed(time.Second), nil)
+	total := time.Second
+	for _, tt := range tests {
+		if got := tt.tc.Duration(); got != tt.want {
+			t.Errorf("%s: expected duration %s, got %s", tt.name, tt.want, got)
+		}
+		html, _ := tt.tc.HTML()
+		if h := "<h3>Test Case: " + tt.tc.Name + " (" + tt.html + ")</h3>"; !strings.Contains(html, h) {
+			t.Errorf("%s: expected header %q in HTML:\n%s", tt.name, h, html)
+		}
+		ts.Append(tt.tc)
+		total += tt.want
+	}
+	if got := ts.Duration(); got != total {
+		t.Errorf("expected test set duration %s, got %s", total, got)
+	}
+	html, err := CreateTestReport(ts).HTML()
+	if err != nil {
+		t.Fatalf("HTML() failed: %s", err)
+	}
+	if !strings.Contains(html, "<td><b>Total Duration</b></td>\n<td>"+fmtDuration(total)+"</td>") {
+		t.Errorf("total duration %s is missing from the HTML report:\n%s", total, html)
+	}
+}
+
+func TestTestCaseExecutedDuration(t *testing.T) {
+
+	ts := newReportSet(
+		CreateTestStep("first", "", "Pass", "NotTested", CreateAction("/bin/sleep", "0.1")),
+		CreateTestStep("second", "", "Pass", "NotTested", CreateAction("/bin/sleep", "0.2")))
+	ts.Execute(quietDisplay())
+
+	tc := ts.Cases[0]
+	sum := time.Duration(tc.Steps[0].Action.Duration + tc.Steps[1].Action.Duration)
+	if tc.Duration() != sum || sum < 300*time.Millisecond {
+		t.Errorf("expected case duration to be the sum of step durations (%s), got %s", sum, tc.Duration())
+	}
+	if ts.Duration() != tc.Duration() {
+		t.Errorf("expected test set duration %s, got %s", tc.Duration(), ts.Duration())
+	}
+}
+
+func TestTestCaseWithoutSteps(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		expected TestResult
+		setup    *Action
+		cleanup  *Action
+		want     TestResult
+	}{
+		{"expected pass", "Pass", nil, nil, "NotTested"},
+		{"expected failure", "XFail", nil, nil, "NotTested"},
+		{"passing setup", "Pass", CreateAction("/bin/true", ""), nil, "NotTested"},
+		{"passing setup, expected failure", "XFail", CreateAction("/bin/true", ""), nil, "NotTested"},
+		{"failing cleanup", "Pass", nil, CreateAction("/bin/false", ""), "NotTested"},
+		{"failing setup", "Pass", CreateAction("/bin/false", ""), nil, "Fail"},
+		{"failing setup, expected failure", "XFail", CreateAction("/bin/false", ""), nil, "Fail"},
+		{"missing setup script", "Pass", CreateAction("/nonexistent/setup", ""), nil, "Fail"},
+	}
+	for _, tt := range tests {
+		tc := CreateTestCase("Empty", "", tt.setup, tt.cleanup, tt.expected, "NotTested")
+		tc.Execute(quietDisplay())
+		if tc.Status != tt.want {
+			t.Errorf("%s: expected status %q, got %q", tt.name, tt.want, tc.Status)
+		}
+	}
+}
@@ -34,9 +34,13 @@ type TestPlan struct {
 func (tp *TestPlan) String() string { return fmt.Sprintf("TestPlan: %q\n", tp.Name) }
 
 // XML returns a XML-encoded representation of the TestPlan instance.
-func (tp *TestPlan) XML() (string, error) {
+func (tp *TestPlan) XML() (string, error) { return tp.XMLIndent(DefaultXMLPrefix, DefaultXMLIndent) }
 
-	output, err := xml.MarshalIndent(tp, "  ", "    ")
+// XMLIndent returns the same representation as XML(), but every line begins with the given prefix and is indented
+// with one or more copies of the given indent.
+func (tp *TestPlan) XMLIndent(prefix, indent string) (string, error) {
+
+	output, err := xml.MarshalIndent(tp, prefix, indent)
 	if err != nil {
 		return "", err
 	}
@@ -64,12 +68,11 @@ func (tp *TestPlan) ToTestSet() *TestSet {
 	ts.Name = utils.CopyS(tp.Name) // TestSet name can (and should) be changed
 	ts.Description = utils.CopyS(tp.Description)
 	//ts.TestPlan = utils.CopyS(tp.Name)
-	*ts.Setup = *tp.Setup
-	*ts.Cleanup = *tp.Cleanup
+	ts.Setup = tp.Setup.Clone()
+	ts.Cleanup = tp.Cleanup.Clone()
 	ts.Sut = new(SysUnderTest) // return empty instance
-	//copy(ts.Cases, tp.Cases)
 	for _, tcase := range tp.Cases {
-		ts.Cases = append(ts.Cases, tcase)
+		ts.Cases = append(ts.Cases, tcase.Clone())
 	}
 
 	return ts
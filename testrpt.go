@@ -15,9 +15,14 @@ package atf
  */
 
 import (
+	"bytes"
+	"encoding/csv"
 	"encoding/json"
 	"encoding/xml"
 	"fmt"
+	"html"
+	"strings"
+	"time"
 )
 
 // TestReport represents the test report (test set that has been executed).
@@ -31,6 +36,53 @@ type TestReport struct {
 
 	// Finished is an execution finish timestamp (as a string)
 	Finished string
+
+	// ID is a unique ID of the TestReport, used for DB access
+	ID string `xml:"id,attr,omitempty" json:",omitempty" bson:"_id,omitempty"`
+
+	// Changes is a list of status changes since the previous run (see Diff()); displayed in HTML report, when defined
+	Changes []StatusChange `xml:"Changes>Change,omitempty" json:",omitempty" bson:",omitempty"`
+}
+
+// ChangeKind defines the kind of status change between two reports.
+type ChangeKind string
+
+const (
+	// Regression is a change from passed to failed status
+	Regression ChangeKind = "regression"
+
+	// Fixed is a change from failed to passed status
+	Fixed ChangeKind = "fixed"
+
+	// Changed is any other status change
+	Changed ChangeKind = "changed"
+
+	// Added marks the test case (or step) that did not exist in the previous report
+	Added ChangeKind = "added"
+
+	// Removed marks the test case (or step) that does not exist anymore
+	Removed ChangeKind = "removed"
+)
+
+// StatusChange represents a single test case (or step) status change between two reports; Step is empty for test cases.
+type StatusChange struct {
+	Case string     `xml:"case,attr"`
+	Step string     `xml:"step,attr,omitempty" json:",omitempty"`
+	From TestResult `xml:"from,attr,omitempty" json:",omitempty"`
+	To   TestResult `xml:"to,attr,omitempty" json:",omitempty"`
+	Kind ChangeKind `xml:"kind,attr"`
+}
+
+// Private function that determines the kind of change between the two statuses.
+func changeKind(from, to TestResult) ChangeKind {
+
+	switch {
+	case from == "Pass" && to.Failed():
+		return Regression
+	case from.Failed() && to == "Pass":
+		return Fixed
+	}
+	return Changed
 }
 
 // String returns a human-readable representation of the TestReport
@@ -42,9 +94,13 @@ func (tr *TestReport) String() string {
 func (tr *TestReport) Name() string { return tr.TestSet.Name }
 
 // XML creates an XML-encoded representation of the TestReport.
-func (tr *TestReport) XML() (x string, err error) {
+func (tr *TestReport) XML() (string, error) { return tr.XMLIndent(DefaultXMLPrefix, DefaultXMLIndent) }
 
-	b, err := xml.MarshalIndent(tr, "", "  ")
+// XMLIndent returns the same representation as XML(), but every line begins with the given prefix and is indented
+// with one or more copies of the given indent.
+func (tr *TestReport) XMLIndent(prefix, indent string) (x string, err error) {
+
+	b, err := xml.MarshalIndent(tr, prefix, indent)
 	if err != nil {
 		return "", err
 	}
@@ -64,15 +120,232 @@ func (tr *TestReport) JSON() (string, error) {
 	return "", nil
 }
 
+// CSV creates a CSV representation of the TestReport: one row per test step, meant mainly for spreadsheet import.
+func (tr *TestReport) CSV() (string, error) {
+
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+
+	// the header row first
+	hdr := []string{"Set", "Case", "Step", "Expected", "Status", "Duration", "Exit Code", "Output"}
+	if err := w.Write(hdr); err != nil {
+		return "", err
+	}
+
+	if tr.TestSet != nil {
+		for _, tc := range tr.TestSet.Cases {
+			for _, step := range tc.Steps {
+				if err := w.Write(tr.step2CSV(tc, step)); err != nil {
+					return "", err
+				}
+			}
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// Create a single CSV record for the given test step. Only the first line of the step output is used.
+func (tr *TestReport) step2CSV(tc *TestCase, step *TestStep) []string {
+
+	exitcode := ""
+	if step.Action != nil {
+		exitcode = fmt.Sprintf("%d", step.Action.ExitCode)
+	}
+	return []string{tr.TestSet.Name, tc.Name, step.Name, string(step.Expected), string(step.Status),
+		step.Duration.String(), exitcode, strings.SplitN(step.Output, "\n", 2)[0]}
+}
+
+// Diff compares the report with the previous one and returns the list of test cases and steps whose status has changed;
+// also, newly added and removed cases and steps are listed. Cases and steps are matched by name.
+func (tr *TestReport) Diff(prev *TestReport) []StatusChange {
+
+	changes := make([]StatusChange, 0)
+	cases := func(r *TestReport) []*TestCase {
+		if r == nil || r.TestSet == nil {
+			return nil
+		}
+		return r.TestSet.Cases
+	}
+
+	old := make(map[string]*TestCase)
+	for _, tc := range cases(prev) {
+		old[tc.Name] = tc
+	}
+	seen := make(map[string]bool)
+	for _, tc := range cases(tr) {
+		seen[tc.Name] = true
+		ptc, ok := old[tc.Name]
+		if !ok {
+			changes = append(changes, StatusChange{Case: tc.Name, To: tc.Status, Kind: Added})
+			continue
+		}
+		if ptc.Status != tc.Status {
+			changes = append(changes, StatusChange{Case: tc.Name, From: ptc.Status, To: tc.Status,
+				Kind: changeKind(ptc.Status, tc.Status)})
+		}
+		changes = append(changes, diffSteps(tc.Name, tc.Steps, ptc.Steps)...)
+	}
+	for _, ptc := range cases(prev) {
+		if !seen[ptc.Name] {
+			changes = append(changes, StatusChange{Case: ptc.Name, From: ptc.Status, Kind: Removed})
+		}
+	}
+	return changes
+}
+
+// Private function that compares the steps of the same test case from two reports.
+func diffSteps(tcname string, steps, prev []*TestStep) []StatusChange {
+
+	changes := make([]StatusChange, 0)
+	old := make(map[string]*TestStep)
+	for _, step := range prev {
+		old[step.Name] = step
+	}
+	seen := make(map[string]bool)
+	for _, step := range steps {
+		seen[step.Name] = true
+		pstep, ok := old[step.Name]
+		if !ok {
+			changes = append(changes, StatusChange{Case: tcname, Step: step.Name, To: step.Status, Kind: Added})
+		} else if pstep.Status != step.Status {
+			changes = append(changes,
+				StatusChange{Case: tcname, Step: step.Name, From: pstep.Status, To: step.Status,
+					Kind: changeKind(pstep.Status, step.Status)})
+		}
+	}
+	for _, pstep := range prev {
+		if !seen[pstep.Name] {
+			changes = append(changes, StatusChange{Case: tcname, Step: pstep.Name, From: pstep.Status, Kind: Removed})
+		}
+	}
+	return changes
+}
+
+// ReportStats holds the aggregate statistics of the executed test set.
+type ReportStats struct {
+
+	// Cases and Steps are total numbers of test cases and steps
+	Cases, Steps int
+
+	// Passed, Failed and Skipped are numbers of passed, failed and not tested test cases
+	Passed, Failed, Skipped int
+
+	// PassRate is a ratio of passed test cases (0 to 1); not tested cases are not counted
+	PassRate float64
+
+	// Duration is the total duration of all executed actions
+	Duration time.Duration
+
+	// Longest is the name of the longest-running test case, LongestDuration is its duration
+	Longest         string
+	LongestDuration time.Duration
+}
+
+// Private function that returns the total duration of the given actions; nil actions are ignored.
+func actionsDuration(actions ...*Action) time.Duration {
+
+	var d time.Duration
+	for _, a := range actions {
+		if a != nil {
+			d += time.Duration(a.Duration)
+		}
+	}
+	return d
+}
+
+// Private function that formats the duration for humans: rounded to milliseconds.
+func fmtDuration(d time.Duration) string { return d.Round(time.Millisecond).String() }
+
+// Stats computes the aggregate statistics of the TestReport.
+func (tr *TestReport) Stats() ReportStats {
+
+	var st ReportStats
+	if tr.TestSet == nil {
+		return st
+	}
+	ts := tr.TestSet
+	st.Duration = ts.Duration()
+	for _, tc := range ts.Cases {
+		st.Cases++
+		st.Steps += len(tc.Steps)
+		switch tc.Status {
+		case "Pass":
+			st.Passed++
+		case "Fail", "Error":
+			st.Failed++
+		default:
+			st.Skipped++
+		}
+		d := tc.Duration()
+		if st.Longest == "" || d > st.LongestDuration {
+			st.Longest, st.LongestDuration = tc.Name, d
+		}
+	}
+	if executed := st.Passed + st.Failed; executed > 0 {
+		st.PassRate = float64(st.Passed) / float64(executed)
+	}
+	return st
+}
+
+// Passed returns true when none of the test cases has failed.
+func (tr *TestReport) Passed() bool { return tr.Stats().Failed == 0 }
+
+// Process exit codes returned by TestReport.ExitCode().
+const (
+	// ExitPassed means that no test case has failed
+	ExitPassed = 0
+
+	// ExitFailed means that at least one test case has failed
+	ExitFailed = 1
+
+	// ExitNotTested means that nothing was tested
+	ExitNotTested = 2
+)
+
+// ExitCode returns the process exit code reflecting the results: ExitFailed when any case has failed, ExitNotTested when no
+// case has passed (nothing was tested, the test set is empty or not defined) and ExitPassed otherwise (expected failures
+// are evaluated as passed, not tested cases are neutral). ExitPassed is returned exactly when TestSet.AllPassed() is true.
+func (tr *TestReport) ExitCode() int {
+
+	if tr.TestSet == nil {
+		return ExitNotTested
+	}
+	return tr.TestSet.exitCode()
+}
+
 // HTML creates a HTML representation of the TestReport. Uses HTML5 standard.
 func (tr *TestReport) HTML() (string, error) {
 
 	var html = ""
 	if tr.TestSet != nil {
 		html += tr.addHeader2Html()
-		for _, tc := range tr.TestSet.Cases {
-			html += tr.addTestCase2Html(tc)
+		if len(tr.Changes) > 0 {
+			html += tr.addChanges2Html()
+		}
+		cases, err := RenderHTML(tr.TestSet.renderables()...)
+		if err != nil {
+			return "", err
+		}
+		html += cases
+	}
+	return html, nil
+}
+
+// RenderHTML renders the given entities into HTML, one after another. This way, any subset of the report (a single test
+// case, for instance) is rendered the same way as the complete report.
+func RenderHTML(items ...Renderable) (string, error) {
+
+	html := ""
+	for _, item := range items {
+		h, err := item.HTML()
+		if err != nil {
+			return "", err
 		}
+		html += h
 	}
 	return html, nil
 }
@@ -81,27 +354,45 @@ func (tr *TestReport) HTML() (string, error) {
 func (tr *TestReport) addHeader2Html() string {
 
 	html := fmt.Sprintln("<header>")
-	html += fmt.Sprintf("<h1>Test Report: %s</h1>\n", tr.TestSet.Name)
+	html += fmt.Sprintf("<h1>Test Report: %s</h1>\n", escapeHTML(tr.TestSet.Name))
 	html += fmt.Sprintln("<table>")
 	html += fmt.Sprintln("<tr><td><b>Execution Started</b></td>")
 	html += fmt.Sprintf("<td>%s</td></tr>\n", tr.Started)
 	html += fmt.Sprintln("<tr><td><b>Execution Finished</b></td>")
 	html += fmt.Sprintf("<td>%s</td></tr>\n", tr.Finished)
+	html += fmt.Sprintln("<tr><td><b>Total Duration</b></td>")
+	html += fmt.Sprintf("<td>%s</td></tr>\n", fmtDuration(tr.TestSet.Duration()))
+	if tr.TestSet.Setup != nil && tr.TestSet.Setup.Result.Failed() {
+		html += fmt.Sprintln("<tr><td><b>Setup Failed</b></td>")
+		if tr.TestSet.ContinueOnSetupFail {
+			html += fmt.Sprintln("<td>Test cases were executed regardless</td></tr>")
+		} else {
+			html += fmt.Sprintln("<td>Test cases were not executed</td></tr>")
+		}
+	}
+	if tr.TestSet.TimedOut {
+		html += fmt.Sprintln("<tr><td><b>Execution Aborted</b></td><td>Deadline exceeded</td></tr>")
+	}
 	html += fmt.Sprintln("</table>")
 	html += fmt.Sprintln("<p />")
 	if tr.TestSet.Sut != nil {
 		html += fmt.Sprintln(tr.addSut2Html(tr.TestSet.Sut))
 	}
+	if tr.TestSet.Topology != nil && len(tr.TestSet.Topology.Devices) > 0 {
+		html += fmt.Sprintln(addDevices2Html(tr.TestSet.Topology))
+	}
 	html += fmt.Sprintln("<table>")
 	if tr.TestSet.Setup != nil {
 		html += fmt.Sprintf("<tr><td>Setup</td><td>%s</td>",
-			tr.TestSet.Setup.String())
+			escapeHTML(tr.TestSet.Setup.String()))
 		html += fmt.Sprintf("<td class=%q>%s</td></tr>\n",
 			resolveHTMLClass(tr.TestSet.Setup), tr.TestSet.Setup.Result)
 	}
+	html += addHooks2Html("Before All", tr.TestSet.BeforeAll)
+	html += addHooks2Html("After All", tr.TestSet.AfterAll)
 	if tr.TestSet.Cleanup != nil {
 		html += fmt.Sprintf("<tr><td>Cleanup</td><td>%s</td>",
-			tr.TestSet.Cleanup.String())
+			escapeHTML(tr.TestSet.Cleanup.String()))
 		html += fmt.Sprintf("<td class=%q>%s</td></tr>\n",
 			resolveHTMLClass(tr.TestSet.Cleanup), tr.TestSet.Cleanup.Result)
 	}
@@ -110,63 +401,80 @@ func (tr *TestReport) addHeader2Html() string {
 	return html
 }
 
+// Add a list of hooks to HTML report: one table row per hook.
+func addHooks2Html(kind string, hooks []*Action) string {
+
+	html := ""
+	for ix, hook := range hooks {
+		if hook == nil {
+			continue
+		}
+		html += fmt.Sprintf("<tr><td>%s #%d</td><td>%s</td>", kind, ix+1, escapeHTML(hook.String()))
+		html += fmt.Sprintf("<td class=%q>%s</td></tr>\n", resolveHTMLClass(hook), hook.Result)
+	}
+	return html
+}
+
+// Add a list of status changes since the previous run to HTML report.
+func (tr *TestReport) addChanges2Html() string {
+
+	html := "<section>\n"
+	html += fmt.Sprintln("<h2>Changes since last run</h2>")
+	html += "<table>\n"
+	html += "<tr><th>Case</th><th>Step</th><th>Previous Status</th><th>Status</th><th>Change</th></tr>\n"
+	for _, c := range tr.Changes {
+		html += fmt.Sprintf("<tr><td>%s</td><td>%s</td><td>%s</td>", escapeHTML(c.Case), escapeHTML(c.Step), c.From)
+		html += fmt.Sprintf("<td class=%q>%s</td><td>%s</td></tr>\n", c.To.CSSClass(), c.To, c.Kind)
+	}
+	html += fmt.Sprintln("</table><p />")
+	html += "</section>\n"
+	return html
+}
+
 // Add a system under test data to HTML report.
 func (tr *TestReport) addSut2Html(sut *SysUnderTest) string {
 
+	addrs := make([]string, 0)
+	for _, addr := range sut.AllAddresses() {
+		addrs = append(addrs, escapeHTML(addr))
+	}
 	html := fmt.Sprintln("<table>")
 	html += fmt.Sprintf("<tr><th>System Under Test</th><th>%s</th></tr>\n",
-		sut.Name)
+		escapeHTML(sut.Name))
 	html += fmt.Sprintf("<tr><td>Type</td><td>%s</td></tr>", sut.Systype)
-	html += fmt.Sprintf("<tr><td>Version</td><td>%s</td></tr>", sut.Version)
-	html += fmt.Sprintf("<tr><td>IP Address</td><td>%s</td></tr>", sut.IPaddr)
+	html += fmt.Sprintf("<tr><td>Version</td><td>%s</td></tr>", escapeHTML(sut.Version))
+	html += fmt.Sprintf("<tr><td>IP Address</td><td>%s</td></tr>", strings.Join(addrs, "<br />"))
 	html += fmt.Sprintf("<tr><td>Description</td><td>%s</td></tr>",
-		sut.Description)
+		escapeHTML(sut.Description))
 	html += fmt.Sprintln("</table>")
 	html += fmt.Sprintln("<p />")
 	return html
 }
 
-// Add a test case data to HTML report.
-func (tr *TestReport) addTestCase2Html(tc *TestCase) string {
+// Add a table of topology devices to HTML report: one row per device, together with its links.
+func addDevices2Html(t *Topology) string {
 
-	html := "<article>\n"
-	html += fmt.Sprintf("<h3>Test Case: %s</h3>", tc.Name)
-	html += "<table>\n"
-	html += fmt.Sprintf("<tr><th class=%q>Name</th><th>Action</th>", "name")
-	html += fmt.Sprintf("<th class=%q>Expected Status</th>", "status")
-	html += fmt.Sprintf("<th class=%q>Status</th></tr>\n", "status")
-	if tc.Setup != nil {
-		html += fmt.Sprintf("<tr><td>Setup</td><td>%s</td><td>Pass</td>",
-			tc.Setup.String())
-		html += fmt.Sprintf("<td class=%q>%s</td></tr>\n",
-			resolveHTMLClass(tc.Setup), tc.Setup.Result)
-	}
-	for _, step := range tc.Steps {
-		html += tr.addStep2Html(step)
-	}
-	if tc.Cleanup != nil {
-		html += fmt.Sprintf("<tr><td>Cleanup</td><td>%s</td><td>Pass</td>",
-			tc.Cleanup.String())
-		html += fmt.Sprintf("<td class=%q>%s</td></tr>\n",
-			resolveHTMLClass(tc.Cleanup), tc.Cleanup.Result)
+	html := fmt.Sprintln("<table>")
+	html += fmt.Sprintln("<tr><th>Device</th><th>Type</th><th>Management</th><th>Links</th></tr>")
+	for _, d := range t.Devices {
+		mgmt := make([]string, 0)
+		for _, addr := range newDeviceData(d).Management {
+			mgmt = append(mgmt, escapeHTML(addr))
+		}
+		links := make([]string, 0)
+		for _, n := range t.Neighbors(d) {
+			links = append(links, escapeHTML(n.DeviceName()))
+		}
+		html += fmt.Sprintf("<tr><td>%s</td><td>%s</td><td>%s</td><td>%s</td></tr>\n", escapeHTML(d.DeviceName()), d.Type(),
+			strings.Join(mgmt, "<br />"), strings.Join(links, "<br />"))
 	}
-	html += fmt.Sprintln("</table><p />")
-	html += "</article>\n"
+	html += fmt.Sprintln("</table>")
+	html += fmt.Sprintln("<p />")
 	return html
 }
 
-// Add a test step data to HTML report.
-func (tr *TestReport) addStep2Html(step *TestStep) string {
-
-	// let's see if step has passed and set the HTML class accordingly
-	//fmt.Printf("DEBUG step: %s\n", step.String()) // DEBUG
-	class := resolveHTMLClass(step)
-	html := fmt.Sprintf("<tr><td>%s</td>", step.Name)
-	html += fmt.Sprintf("<td>%s</td><td>%s</td>",
-		step.Action.String(), step.Expected)
-	html += fmt.Sprintf("<td class=%q>%s</td></tr>\n", class, step.Status)
-	return html
-}
+// Escape the text for HTML report: the reporting functions shadow the html package with their output variable.
+func escapeHTML(s string) string { return html.EscapeString(s) }
 
 // Takes a structure and determines which CSS class should be used in HTML
 // report. Only 'Action' (for setup and cleanup actions) and 'TestStep' types
@@ -178,27 +486,13 @@ func resolveHTMLClass(structure interface{}) (cls string) {
 	switch t := structure.(type) {
 
 	case *Action:
-		switch t.Result {
-		case "Pass":
-			cls = "passed"
-		case "Fail":
-			cls = "failed"
-		case "NotTested":
-			cls = "nottested"
-		}
+		cls = t.Result.CSSClass()
 
 	case *TestStep:
-		switch t.Status {
-		case "Pass":
-			cls = "passed"
-		case "Fail":
-			cls = "failed"
-		case "NotTested":
-			cls = "nottested"
-		}
+		cls = t.Status.CSSClass()
 	}
 	return cls
 }
 
 // CreateTestReport creates a new TestReport instance with given TestSet.
-func CreateTestReport(ts *TestSet) *TestReport { return &TestReport{ts, "", ""} }
+func CreateTestReport(ts *TestSet) *TestReport { return &TestReport{TestSet: ts} }
@@ -0,0 +1,316 @@
+package atf
+
+import (
+	"encoding/csv"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Create a test set with a single case holding the given steps.
+func newReportSet(steps ...*TestStep) *TestSet {
+
+	tc := CreateTestCase("Case, the first", "", nil, nil, "Pass", "NotTested")
+	tc.Append(steps...)
+	ts := CreateTestSet("Set", "", nil, nil, nil)
+	ts.Append(tc)
+	return ts
+}
+
+func TestReportCSVRoundTrip(t *testing.T) {
+
+	step := CreateTestStep("Step with \"quotes\"\nand a newline", "", "Pass", "Pass", CreateAction("check.sh", ""))
+	step.Output = "value: 1, 2, \"three\"\nsecond line is dropped"
+	tr := CreateTestReport(newReportSet(step))
+
+	text, err := tr.CSV()
+	if err != nil {
+		t.Fatalf("CSV() failed: %s", err)
+	}
+	rows, err := csv.NewReader(strings.NewReader(text)).ReadAll()
+	if err != nil {
+		t.Fatalf("CSV output cannot be parsed: %s", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("expected header and 1 row, got %d rows", len(rows))
+	}
+
+	want := []struct {
+		col  int
+		name string
+		val  string
+	}{
+		{0, "set", "Set"},
+		{1, "case", "Case, the first"},
+		{2, "step", "Step with \"quotes\"\nand a newline"},
+		{3, "expected", "Pass"},
+		{4, "status", "Pass"},
+		{6, "exit code", "0"},
+		{7, "output", "value: 1, 2, \"three\""},
+	}
+	for _, w := range want {
+		if got := rows[1][w.col]; got != w.val {
+			t.Errorf("%s: expected %q, got %q", w.name, w.val, got)
+		}
+	}
+}
+
+func TestReportCSVEmpty(t *testing.T) {
+
+	text, err := CreateTestReport(nil).CSV()
+	if err != nil {
+		t.Fatalf("CSV() failed: %s", err)
+	}
+	if got := strings.Count(text, "\n"); got != 1 {
+		t.Errorf("expected only the header row, got %d rows", got)
+	}
+}
+
+// Create a report from the given "case:status" and "case/step:status" specifications.
+func newDiffReport(specs ...string) *TestReport {
+
+	ts := CreateTestSet("Set", "", nil, nil, nil)
+	for _, spec := range specs {
+		name, status, _ := strings.Cut(spec, ":")
+		cname, sname, isStep := strings.Cut(name, "/")
+		if !isStep {
+			ts.Append(CreateTestCase(cname, "", nil, nil, "Pass", TestResult(status)))
+			continue
+		}
+		for _, tc := range ts.Cases {
+			if tc.Name == cname {
+				tc.Append(CreateTestStep(sname, "", "Pass", TestResult(status), nil))
+			}
+		}
+	}
+	return CreateTestReport(ts)
+}
+
+func TestReportDiff(t *testing.T) {
+
+	tests := []struct {
+		name string
+		prev *TestReport
+		curr *TestReport
+		want []StatusChange
+	}{
+		{"no changes", newDiffReport("A:Pass", "A/s:Pass"), newDiffReport("A:Pass", "A/s:Pass"), []StatusChange{}},
+		{"no previous report", nil, newDiffReport("A:Pass"), []StatusChange{{Case: "A", To: "Pass", Kind: Added}}},
+		{"regression", newDiffReport("A:Pass", "A/s:Pass"), newDiffReport("A:Fail", "A/s:Fail"),
+			[]StatusChange{{"A", "", "Pass", "Fail", Regression}, {"A", "s", "Pass", "Fail", Regression}}},
+		{"fixed", newDiffReport("A:Fail", "A/s:Fail"), newDiffReport("A:Pass", "A/s:Pass"),
+			[]StatusChange{{"A", "", "Fail", "Pass", Fixed}, {"A", "s", "Fail", "Pass", Fixed}}},
+		{"other change", newDiffReport("A:Pass"), newDiffReport("A:NotTested"),
+			[]StatusChange{{"A", "", "Pass", "NotTested", Changed}}},
+		{"added case and step", newDiffReport("A:Pass", "A/s:Pass"), newDiffReport("A:Pass", "A/s:Pass", "A/t:Pass", "B:Fail"),
+			[]StatusChange{{Case: "A", Step: "t", To: "Pass", Kind: Added}, {Case: "B", To: "Fail", Kind: Added}}},
+		{"removed case and step", newDiffReport("A:Pass", "A/s:Pass", "A/t:Pass", "B:Fail"), newDiffReport("A:Pass", "A/s:Pass"),
+			[]StatusChange{{Case: "A", Step: "t", From: "Pass", Kind: Removed}, {Case: "B", From: "Fail", Kind: Removed}}},
+		{"cases matched by name", newDiffReport("A:Pass", "B:Fail"), newDiffReport("B:Pass", "A:Pass"),
+			[]StatusChange{{"B", "", "Fail", "Pass", Fixed}}},
+	}
+	for _, tt := range tests {
+		if got := tt.curr.Diff(tt.prev); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestReportChangesHTML(t *testing.T) {
+
+	tr := newDiffReport("A:Fail")
+	html, err := tr.HTML()
+	if err != nil {
+		t.Fatalf("HTML() failed: %s", err)
+	}
+	if strings.Contains(html, "Changes since last run") {
+		t.Errorf("changes section is present without changes")
+	}
+
+	tr.Changes = tr.Diff(newDiffReport("A:Pass"))
+	if html, err = tr.HTML(); err != nil {
+		t.Fatalf("HTML() failed: %s", err)
+	}
+	for _, want := range []string{"<h2>Changes since last run</h2>", "<td>A</td>", "<td>Pass</td>", ">Fail</td><td>regression</td>"} {
+		if !strings.Contains(html, want) {
+			t.Errorf("HTML report does not contain %q", want)
+		}
+	}
+}
+
+func TestReportHTMLEscaping(t *testing.T) {
+
+	step := CreateTestStep("<b>step</b>", "", "Pass", "Pass", CreateAction("/bin/echo", "a<b && c>d"))
+	ts := newReportSet(step)
+	ts.Name, ts.Cases[0].Name = "<set>", "<u>case</u>"
+	ts.Setup, ts.Cleanup = CreateAction("/bin/true", "<set-setup>"), CreateAction("/bin/true", "<set-cleanup>")
+	ts.Cases[0].Setup = CreateAction("/bin/true", "<case-setup>")
+	ts.Cases[0].Cleanup = CreateAction("/bin/true", "<case-cleanup>")
+	ts.Sut = CreateSUT("<sut>", "Software", "<1.0>", "<description>", "10.0.0.1")
+	ts.Sut.Addresses = []string{"10.0.0.1", "<addr>"}
+	ts.BeforeAll = []*Action{CreateAction("/bin/true", "<hook>")}
+	tr := CreateTestReport(ts)
+	tr.Changes = []StatusChange{{Case: "<case>", Step: "<i>step</i>", From: "Pass", To: "Fail", Kind: Regression}}
+
+	html, err := tr.HTML()
+	if err != nil {
+		t.Fatalf("HTML() failed: %s", err)
+	}
+	for _, raw := range []string{"<b>step</b>", "a<b && c>d", "<hook>", "<case>", "<i>step</i>", "<set>",
+		"<u>case</u>", "<set-setup>", "<set-cleanup>", "<case-setup>", "<case-cleanup>", "<sut>", "<1.0>",
+		"<description>", "<addr>"} {
+		if strings.Contains(html, raw) {
+			t.Errorf("HTML report contains unescaped %q", raw)
+		}
+	}
+	for _, want := range []string{"<td>&lt;b&gt;step&lt;/b&gt;</td>", "a&lt;b &amp;&amp; c&gt;d", "&lt;hook&gt;",
+		"<td>&lt;case&gt;</td><td>&lt;i&gt;step&lt;/i&gt;</td>", "<h1>Test Report: &lt;set&gt;</h1>",
+		"<h3>Test Case: &lt;u&gt;case&lt;/u&gt;", "&lt;case-cleanup&gt;", "<th>&lt;sut&gt;</th>",
+		"<td>10.0.0.1<br />&lt;addr&gt;</td>"} {
+		if !strings.Contains(html, want) {
+			t.Errorf("HTML report does not contain %q", want)
+		}
+	}
+	if html, err := ts.HTML(); err != nil || !strings.HasPrefix(html, "<h2>Test Set: &lt;set&gt;</h2>") {
+		t.Errorf("test set name is not escaped: %v, %q", err, html)
+	}
+}
+
+// Create a test case with the given status and one executed step per given duration.
+func newStatsCase(name string, status TestResult, durations ...time.Duration) *TestCase {
+
+	tc := CreateTestCase(name, "", nil, nil, "Pass", status)
+	for _, d := range durations {
+		a := CreateAction("/bin/true", "")
+		a.Duration = Duration(d)
+		tc.Append(CreateTestStep("step", "", "Pass", status, a))
+	}
+	return tc
+}
+
+func TestReportStats(t *testing.T) {
+
+	mixed := CreateTestSet("Mixed", "", nil, CreateAction("/bin/true", ""), nil)
+	mixed.Setup.Duration = Duration(500 * time.Millisecond)
+	mixed.Append(
+		newStatsCase("passed", "Pass", time.Second, 2*time.Second),
+		newStatsCase("failed", "Fail", 5*time.Second),
+		newStatsCase("error", "Error", time.Second),
+		newStatsCase("skipped", "NotTested", time.Hour),
+	)
+	passed := CreateTestSet("Passed", "", nil, nil, nil)
+	passed.Append(newStatsCase("first", "Pass", time.Second), newStatsCase("second", "Pass"))
+	skipped := CreateTestSet("Skipped", "", nil, nil, nil)
+	skipped.Append(newStatsCase("only", "NotTested"))
+
+	tests := []struct {
+		name   string
+		set    *TestSet
+		want   ReportStats
+		passed bool
+	}{
+		{"mixed", mixed, ReportStats{Cases: 4, Steps: 5, Passed: 1, Failed: 2, Skipped: 1, PassRate: 1.0 / 3,
+			Duration: 9500 * time.Millisecond, Longest: "failed", LongestDuration: 5 * time.Second}, false},
+		{"all passed", passed, ReportStats{Cases: 2, Steps: 1, Passed: 2, PassRate: 1, Duration: time.Second,
+			Longest: "first", LongestDuration: time.Second}, true},
+		{"nothing tested", skipped, ReportStats{Cases: 1, Skipped: 1, Longest: "only"}, true},
+		{"empty set", CreateTestSet("Empty", "", nil, nil, nil), ReportStats{}, true},
+		{"no set", nil, ReportStats{}, true},
+	}
+	for _, tt := range tests {
+		tr := CreateTestReport(tt.set)
+		if got := tr.Stats(); got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+		if got := tr.Passed(); got != tt.passed {
+			t.Errorf("%s: Passed() = %t, want %t", tt.name, got, tt.passed)
+		}
+	}
+}
+
+func TestReportExitCode(t *testing.T) {
+
+	rec, _ := newRecorder(t)
+	// the first case is expected to fail
+	xfail := func(ts *TestSet) *TestSet {
+		ts.Cases[0].Expected = "XFail"
+		return ts
+	}
+	// set setup fails, so nothing is tested
+	skipped := func(ts *TestSet) *TestSet {
+		ts.Setup = CreateAction("/bin/false", "")
+		return ts
+	}
+
+	tests := []struct {
+		name      string
+		set       *TestSet
+		code      int
+		allPassed bool
+	}{
+		{"all passed", newRecordingSet(rec, []string{"a", "b"}), ExitPassed, true},
+		{"one failed", newRecordingSet(rec, []string{"a", "b", "c"}, "b"), ExitFailed, false},
+		{"all failed", newRecordingSet(rec, []string{"a", "b"}, "a", "b"), ExitFailed, false},
+		{"expected failure", xfail(newRecordingSet(rec, []string{"a", "b"}, "a")), ExitPassed, true},
+		{"all skipped", skipped(newRecordingSet(rec, []string{"a", "b"})), ExitNotTested, false},
+		{"empty set", CreateTestSet("Empty", "", nil, nil, nil), ExitNotTested, false},
+	}
+	for _, tt := range tests {
+		tt.set.Execute(quietDisplay())
+		if got := CreateTestReport(tt.set).ExitCode(); got != tt.code {
+			t.Errorf("%s: ExitCode() = %d, want %d", tt.name, got, tt.code)
+		}
+		if got := tt.set.AllPassed(); got != tt.allPassed {
+			t.Errorf("%s: AllPassed() = %t, want %t", tt.name, got, tt.allPassed)
+		}
+	}
+	if got := CreateTestReport(nil).ExitCode(); got != ExitNotTested {
+		t.Errorf("report without test set: ExitCode() = %d, want %d", got, ExitNotTested)
+	}
+}
+
+func TestRenderHTML(t *testing.T) {
+
+	ts := newReportSet(CreateTestStep("Step", "", "Pass", "Pass", CreateAction("/bin/true", "")))
+	second := CreateTestCase("Case, the second", "", nil, nil, "Pass", "Fail")
+	second.Append(CreateTestStep("Other step", "", "Pass", "Fail", CreateAction("/bin/false", "")))
+	ts.Append(second)
+	first := ts.Cases[0]
+
+	tests := []struct {
+		name  string
+		items []Renderable
+		want  []string
+	}{
+		{"nothing", nil, nil},
+		{"single step", []Renderable{first.Steps[0]}, []string{"Step"}},
+		{"single case", []Renderable{second}, []string{"Case, the second", "Other step"}},
+		{"cases", []Renderable{first, second}, []string{"Case, the first", "Step", "Case, the second", "Other step"}},
+	}
+	for _, tt := range tests {
+		html, err := RenderHTML(tt.items...)
+		if err != nil {
+			t.Fatalf("%s: RenderHTML() failed: %s", tt.name, err)
+		}
+		want := ""
+		for _, item := range tt.items {
+			h, _ := item.HTML()
+			want += h
+		}
+		if html != want {
+			t.Errorf("%s: rendered HTML differs from the items' HTML", tt.name)
+		}
+		for _, s := range tt.want {
+			if !strings.Contains(html, s) {
+				t.Errorf("%s: rendered HTML does not contain %q", tt.name, s)
+			}
+		}
+	}
+
+	// the report renders its cases through the same pipeline
+	cases, _ := RenderHTML(first, second)
+	if html, err := CreateTestReport(ts).HTML(); err != nil || !strings.Contains(html, cases) {
+		t.Errorf("report does not contain the rendered cases: %v", err)
+	}
+}
@@ -8,11 +8,14 @@ package atf
  */
 
 import (
+	"encoding/json"
 	"encoding/xml"
+	"fmt"
+	"strings"
 )
 
 // ValidTestResults is a slice of valid test result (string) values
-var ValidTestResults = []string{"UnknownResult", "Pass", "Fail", "XFail", "NotTested"}
+var ValidTestResults = []string{"UnknownResult", "Pass", "Fail", "XFail", "NotTested", "Error"}
 
 // IsValidTestResult checks for the validity of the given test result value.
 func IsValidTestResult(val string) bool {
@@ -28,15 +31,143 @@ func IsValidTestResult(val string) bool {
 }
 
 // TestResult is a custom type for handling test results.
+// Note that Error is not a result of the test itself: it means that the test could not be executed properly (e.g. the
+// interpreter is missing or execution has timed out). Such test is considered failed, but it is reported distinctly.
 type TestResult string
 
+// Failed returns true for the failing test results: Fail and Error.
+func (tr TestResult) Failed() bool { return tr == "Fail" || tr == "Error" }
+
+// CombineResults combines the statuses of the test steps into the status of the test case with the given expected status:
+//   - any Error status makes the result Fail, regardless of expected status,
+//   - if expected status is Pass, any failed status makes the result Fail,
+//   - if expected status is XFail, any passed status makes the result Fail,
+//   - otherwise the result is Pass; NotTested statuses are neutral, but if all the statuses are NotTested, the result is
+//     NotTested, too.
+//
+// Only Pass and XFail are valid expected statuses; for any other, the result is NotTested.
+func CombineResults(expected TestResult, statuses []TestResult) TestResult {
+
+	var failing TestResult
+	switch expected {
+	case "Pass":
+		failing = "Fail"
+	case "XFail":
+		failing = "Pass"
+	default:
+		return "NotTested"
+	}
+
+	nottested := 0 // we count the NotTested occurences
+	for _, s := range statuses {
+		switch s {
+		case failing, "Error":
+			return "Fail"
+		case "NotTested":
+			nottested++
+		}
+	}
+	if nottested == len(statuses) {
+		return "NotTested"
+	}
+	return "Pass"
+}
+
+// ParseTestResult converts a string into a valid TestResult value. The comparison is case-insensitive, the returned value
+// is always the canonical one (e.g. "xfail" is converted into "XFail"). If the string is not a valid test result,
+// ErrorInvalidTestResult is returned.
+func ParseTestResult(s string) (TestResult, error) {
+	for _, v := range ValidTestResults {
+		if strings.EqualFold(v, s) {
+			return TestResult(v), nil
+		}
+	}
+	return "", fmt.Errorf("%w: %q", ErrorInvalidTestResult, s)
+}
+
+// CSSClass returns the name of the CSS class used to render the TestResult in HTML reports. Invalid values return an
+// empty string.
+func (tr TestResult) CSSClass() string {
+	switch tr {
+	case "Pass":
+		return "passed"
+	case "Fail":
+		return "failed"
+	case "XFail":
+		return "xfailed"
+	case "NotTested":
+		return "nottested"
+	case "Error":
+		return "errored"
+	case "UnknownResult":
+		return "unknown"
+	}
+	return ""
+}
+
+// Color returns the name of the color used to render the TestResult in terminal or markdown output. Invalid values
+// return an empty string.
+func (tr TestResult) Color() string {
+	switch tr {
+	case "Pass":
+		return "green"
+	case "Fail":
+		return "red"
+	case "XFail":
+		return "yellow"
+	case "NotTested":
+		return "gray"
+	case "Error":
+		return "orange"
+	case "UnknownResult":
+		return "white"
+	}
+	return ""
+}
+
 // XML returns an XML-encoded representation of the TestResult
-func (tr *TestResult) XML() (x string, err error) {
+func (tr *TestResult) XML() (string, error) { return tr.XMLIndent(DefaultXMLPrefix, DefaultXMLIndent) }
+
+// XMLIndent returns the same representation as XML(), but every line begins with the given prefix and is indented
+// with one or more copies of the given indent.
+func (tr *TestResult) XMLIndent(prefix, indent string) (x string, err error) {
 
 	x = ""
-	b, err := xml.MarshalIndent(tr, "", "  ")
+	b, err := xml.MarshalIndent(tr, prefix, indent)
+	if err != nil {
+		return "", err
+	}
+	return string(b[:]), nil
+}
+
+// JSON returns a JSON-encoded representation of the TestResult
+func (tr *TestResult) JSON() (string, error) {
+
+	b, err := json.Marshal(tr)
 	if err != nil {
 		return "", err
 	}
 	return string(b[:]), nil
 }
+
+// MarshalJSON implements the json.Marshaler interface.
+func (tr TestResult) MarshalJSON() ([]byte, error) { return json.Marshal(string(tr)) }
+
+// UnmarshalJSON implements the json.Unmarshaler interface: only valid test results (or empty value) are accepted.
+func (tr *TestResult) UnmarshalJSON(b []byte) error {
+
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	if s == "" {
+		*tr = ""
+		return nil
+	}
+	r, err := ParseTestResult(s)
+	if err != nil {
+		return err
+	}
+	*tr = r
+	return nil
+}
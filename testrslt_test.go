@@ -0,0 +1,209 @@
+package atf
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestParseTestResult(t *testing.T) {
+
+	tests := []struct {
+		in   string
+		want TestResult
+		ok   bool
+	}{
+		{"Pass", "Pass", true},
+		{"XFail", "XFail", true},
+		{"NotTested", "NotTested", true},
+		{"Error", "Error", true},
+		{"UnknownResult", "UnknownResult", true},
+		{"pass", "Pass", true},
+		{"XFAIL", "XFail", true},
+		{"nottested", "NotTested", true},
+		{"Passed", "", false},
+		{"", "", false},
+		{" Pass", "", false},
+		{"garbage", "", false},
+	}
+	for _, tt := range tests {
+		got, err := ParseTestResult(tt.in)
+		if got != tt.want || (err == nil) != tt.ok {
+			t.Errorf("%q: expected %q (ok %t), got %q (%v)", tt.in, tt.want, tt.ok, got, err)
+		}
+		if !tt.ok && !errors.Is(err, ErrorInvalidTestResult) {
+			t.Errorf("%q: expected ErrorInvalidTestResult, got %v", tt.in, err)
+		}
+	}
+}
+
+func TestCollectInvalidResult(t *testing.T) {
+
+	dir := t.TempDir()
+	tests := []struct {
+		name string
+		text string
+		ok   bool
+	}{
+		{"case.yaml", "name: S\ncases:\n  - name: C\n    expected: Passed\n", false},
+		{"step.yaml", "name: S\ncases:\n  - name: C\n    steps:\n      - name: s\n        status: done\n", false},
+		{"case.xml", `<TestSet name="S"><Cases><TestCase name="C" expected="pass"></TestCase></Cases></TestSet>`, true},
+	}
+	for _, tt := range tests {
+		ts, err := Collect(writeConfig(t, dir, tt.name, tt.text))
+		if tt.ok {
+			if err != nil || ts.Cases[0].Expected != "Pass" {
+				t.Errorf("%s: expected normalized result, got %v", tt.name, err)
+			}
+		} else if !errors.Is(err, ErrorInvalidTestResult) {
+			t.Errorf("%s: expected ErrorInvalidTestResult, got %v", tt.name, err)
+		}
+	}
+}
+
+func TestTestResultJSON(t *testing.T) {
+
+	for _, v := range append(ValidTestResults, "") {
+		tr := TestResult(v)
+		text, err := tr.JSON()
+		if err != nil {
+			t.Fatalf("%q: JSON() failed: %s", v, err)
+		}
+		var got TestResult
+		if err := json.Unmarshal([]byte(text), &got); err != nil || got != tr {
+			t.Errorf("%q: round-trip returned %q (%v)", v, got, err)
+		}
+	}
+
+	tests := []struct {
+		text string
+		want TestResult
+		err  error
+	}{
+		{`{"Name": "s", "Status": "xfail"}`, "XFail", nil},
+		{`{"Name": "s", "Status": "Passed"}`, "", ErrorInvalidTestResult},
+		{`{"Name": "s", "Status": 1}`, "", nil},
+	}
+	for _, tt := range tests {
+		step := new(TestStep)
+		err := json.Unmarshal([]byte(tt.text), step)
+		switch {
+		case tt.want != "":
+			if err != nil || step.Status != tt.want {
+				t.Errorf("%s: expected status %q, got %q (%v)", tt.text, tt.want, step.Status, err)
+			}
+		case tt.err != nil:
+			if !errors.Is(err, tt.err) {
+				t.Errorf("%s: expected %v, got %v", tt.text, tt.err, err)
+			}
+		case err == nil:
+			t.Errorf("%s: expected error", tt.text)
+		}
+	}
+}
+
+func TestTestResultClasses(t *testing.T) {
+
+	tests := []struct {
+		tr    TestResult
+		class string
+		color string
+	}{
+		{"Pass", "passed", "green"},
+		{"Fail", "failed", "red"},
+		{"XFail", "xfailed", "yellow"},
+		{"NotTested", "nottested", "gray"},
+		{"Error", "errored", "orange"},
+		{"UnknownResult", "unknown", "white"},
+		{"pass", "", ""},
+		{"Passed", "", ""},
+		{"", "", ""},
+	}
+	for _, tt := range tests {
+		if got := tt.tr.CSSClass(); got != tt.class {
+			t.Errorf("%q: expected CSS class %q, got %q", tt.tr, tt.class, got)
+		}
+		if got := tt.tr.Color(); got != tt.color {
+			t.Errorf("%q: expected color %q, got %q", tt.tr, tt.color, got)
+		}
+	}
+}
+
+func TestCombineResults(t *testing.T) {
+
+	tests := []struct {
+		expected TestResult
+		statuses []TestResult
+		want     TestResult
+	}{
+		// expected Pass
+		{"Pass", nil, "NotTested"},
+		{"Pass", []TestResult{"NotTested", "NotTested"}, "NotTested"},
+		{"Pass", []TestResult{"Pass"}, "Pass"},
+		{"Pass", []TestResult{"Pass", "NotTested"}, "Pass"},
+		{"Pass", []TestResult{"Pass", "Fail"}, "Fail"},
+		{"Pass", []TestResult{"NotTested", "Fail"}, "Fail"},
+		{"Pass", []TestResult{"Pass", "Error"}, "Fail"},
+		{"Pass", []TestResult{"XFail"}, "Pass"},
+		{"Pass", []TestResult{"UnknownResult"}, "Pass"},
+		// expected XFail
+		{"XFail", nil, "NotTested"},
+		{"XFail", []TestResult{"NotTested"}, "NotTested"},
+		{"XFail", []TestResult{"Fail"}, "Pass"},
+		{"XFail", []TestResult{"Fail", "NotTested"}, "Pass"},
+		{"XFail", []TestResult{"Fail", "Pass"}, "Fail"},
+		{"XFail", []TestResult{"Fail", "Error"}, "Fail"},
+		{"XFail", []TestResult{"XFail"}, "Pass"},
+		// invalid expected status
+		{"Fail", []TestResult{"Pass"}, "NotTested"},
+		{"NotTested", []TestResult{"Fail"}, "NotTested"},
+		{"Error", []TestResult{"Pass"}, "NotTested"},
+		{"", []TestResult{"Pass"}, "NotTested"},
+	}
+	for _, tt := range tests {
+		if got := CombineResults(tt.expected, tt.statuses); got != tt.want {
+			t.Errorf("CombineResults(%q, %v): expected %q, got %q", tt.expected, tt.statuses, tt.want, got)
+		}
+	}
+
+	// the result does not depend on the order of the statuses
+	for _, expected := range ValidTestResults {
+		for _, a := range ValidTestResults {
+			for _, b := range ValidTestResults {
+				ab := CombineResults(TestResult(expected), []TestResult{TestResult(a), TestResult(b)})
+				ba := CombineResults(TestResult(expected), []TestResult{TestResult(b), TestResult(a)})
+				if ab != ba {
+					t.Errorf("CombineResults(%q) depends on order: [%s %s] is %q, [%s %s] is %q",
+						expected, a, b, ab, b, a, ba)
+				}
+			}
+		}
+	}
+}
+
+func TestCombineResultsTestCase(t *testing.T) {
+
+	tests := []struct {
+		expected TestResult
+		steps    []string
+	}{
+		{"Pass", []string{"/bin/true", "/bin/true"}},
+		{"Pass", []string{"/bin/true", "/bin/false"}},
+		{"XFail", []string{"/bin/false", "/bin/false"}},
+		{"XFail", []string{"/bin/false", "/bin/true"}},
+	}
+	for _, tt := range tests {
+		tc := CreateTestCase("Case", "", nil, nil, tt.expected, "NotTested")
+		for _, script := range tt.steps {
+			tc.Append(CreateTestStep("step", "", "Pass", "NotTested", CreateAction(script, "")))
+		}
+		tc.Execute(quietDisplay())
+		statuses := make([]TestResult, 0, len(tc.Steps))
+		for _, step := range tc.Steps {
+			statuses = append(statuses, step.Status)
+		}
+		if want := CombineResults(tt.expected, statuses); tc.Status != want {
+			t.Errorf("%s %v: expected case status %q, got %q", tt.expected, tt.steps, want, tc.Status)
+		}
+	}
+}
@@ -19,9 +19,13 @@ package atf
 
 import (
 	//"github.com/mraitmaier/atf/utils"
+	"context"
 	"encoding/json"
 	"encoding/xml"
 	"fmt"
+	"math/rand"
+	"strings"
+	"time"
 )
 
 // TestSet represents an executable set of test cases.
@@ -30,47 +34,164 @@ import (
 // TestPlan property which is the name of the TestPlan it is associated with.
 type TestSet struct {
 
-	//  ID is a unique ID of the TestSet, used for DB access
-	//ID string `bson:"_id, omitempty"`
+	// ID is a unique ID of the TestSet, used for DB access
+	ID string `xml:"id,attr,omitempty" json:",omitempty" yaml:"id,omitempty" bson:"_id,omitempty"`
 
 	// Name is a test set name, of course; in XML, this is an attribute
-	Name string `xml:"name,attr"`
+	Name string `xml:"name,attr" yaml:"name"`
 
 	// Description is a arbitrary long text description of the test set
-	Description string
+	Description string `yaml:"description"`
 
 	// TestPlan: test set is a subset of test plan; we remember its name
 	//TestPlan string
 
 	// Sut is a system under test description
-	Sut *SysUnderTest `xml:"SystemUnderTest"`
+	Sut *SysUnderTest `xml:"SystemUnderTest" yaml:"sut"`
+
+	// Topology is an optional description of the devices (and their links) used by multi-device tests; the test steps
+	// reference the devices by name
+	Topology *Topology `xml:",omitempty" json:",omitempty" yaml:"topology,omitempty"`
 
 	// Setup is a setup action
-	Setup *Action `xml:"Setup"`
+	Setup *Action `xml:"Setup" yaml:"setup"`
 
 	// Cleanup is a cleanup action
-	Cleanup *Action `xml:"Cleanup"`
+	Cleanup *Action `xml:"Cleanup" yaml:"cleanup"`
+
+	// BeforeAll is an ordered list of hooks executed before the first test case
+	BeforeAll []*Action `xml:"BeforeAll>Action" yaml:"beforeall"`
+
+	// AfterAll is an ordered list of hooks executed after the last test case (even if cases fail)
+	AfterAll []*Action `xml:"AfterAll>Action" yaml:"afterall"`
 
 	// Cases is a list of test cases; in XML, this is a list of <TestCase> tags
-	Cases []*TestCase `xml:"Cases>TestCase"`
+	Cases []*TestCase `xml:"Cases>TestCase" yaml:"cases"`
+
+	// PingSut defines whether the SUT reachability is checked before execution; in XML, this is an attribute
+	PingSut bool `xml:"pingSut,attr,omitempty" yaml:"pingsut"`
+
+	// Rerun defines whether the results of the previous execution are kept; otherwise, they are reset before execution
+	Rerun bool `xml:"rerun,attr,omitempty" yaml:"rerun"`
+
+	// ContinueOnSetupFail defines whether the test cases are executed even when the setup action fails; otherwise, the
+	// failed setup stops the execution. In XML, this is an attribute
+	ContinueOnSetupFail bool `xml:"continueOnSetupFail,attr,omitempty" yaml:"continueonsetupfail"`
+
+	// TimedOut is set when the execution was aborted because the deadline was exceeded; in XML, this is an attribute
+	TimedOut bool `xml:"timedOut,attr,omitempty" json:",omitempty" yaml:"timedout,omitempty"`
+
+	// Events is an optional sink receiving the execution events
+	Events EventSink `xml:"-" json:"-" yaml:"-" bson:"-"`
+
+	// OnProgress is an optional callback invoked after every executed test step and test case
+	OnProgress ProgressFn `xml:"-" json:"-" yaml:"-" bson:"-"`
+
+	// ctx is an optional context of the execution; when it's done, the remaining test cases are not executed
+	ctx context.Context
+
+	// opts are the execution options given to the execution (see ExecuteWithOptions())
+	opts ExecOptions
+
+	// failFast defines whether the remaining test cases are skipped after the first failed test case
+	failFast bool
+}
+
+// Progress represents the progress of the test set execution.
+type Progress struct {
+	TotalCases, DoneCases, TotalSteps, DoneSteps int
+}
+
+// ProgressFn is a callback receiving the execution progress.
+type ProgressFn func(Progress)
+
+// CountSteps returns the total number of test steps in the test set.
+func (ts *TestSet) CountSteps() int {
+
+	n := 0
+	for _, tc := range ts.Cases {
+		n += len(tc.Steps)
+	}
+	return n
+}
+
+// Duration returns the duration of the test set: the sum of all test cases' durations, together with the durations of the
+// setup and cleanup actions and before/after-all hooks.
+func (ts *TestSet) Duration() time.Duration {
+
+	d := actionsDuration(ts.Setup, ts.Cleanup)
+	d += actionsDuration(ts.BeforeAll...) + actionsDuration(ts.AfterAll...)
+	for _, tc := range ts.Cases {
+		d += tc.Duration()
+	}
+	return d
 }
 
-/*
 // ToTestPlan converts a TestSet instance into TestPlan instance.
-// Note that we force deep copy of the data. Also, SUT instance is not contained by TestPlan, so it must be omitted.
+// Note that we force deep copy of the data. Also, SUT instance is not contained by TestPlan, so it must be omitted. All the
+// execution results are reset to "not tested", so the plan can be reused.
 func (ts *TestSet) ToTestPlan() *TestPlan {
 
-	tp := new(TestPlan)
-	tp.Name = utils.CopyS(ts.TestPlan)
-	tp.Description = utils.CopyS(ts.Description)
-	*tp.Setup = *ts.Setup
-	*tp.Cleanup = *ts.Cleanup
-	for _, tcase := range ts.Cases {
-		tp.Cases = append(tp.Cases, tcase)
-	}
+	c := ts.Clone()
+	c.Reset()
+	tp := CreateTestPlan(c.Name, c.Description, c.Setup, c.Cleanup)
+	tp.Append(c.Cases...)
 	return tp
 }
-*/
+
+// Reset clears all the results of the previous execution: statuses of all cases and steps and results of all actions are
+// set to "not tested" and the captured output is cleared.
+func (ts *TestSet) Reset() {
+
+	ts.Setup.reset()
+	ts.Cleanup.reset()
+	for _, hooks := range [][]*Action{ts.BeforeAll, ts.AfterAll} {
+		for _, hook := range hooks {
+			hook.reset()
+		}
+	}
+	for _, tc := range ts.Cases {
+		tc.Status, tc.hooksDuration = "NotTested", 0
+		for _, a := range []*Action{tc.Setup, tc.Cleanup, tc.BeforeEach, tc.AfterEach} {
+			a.reset()
+		}
+		for _, step := range tc.Steps {
+			step.Status, step.Output, step.Duration, step.Collected = "NotTested", "", 0, nil
+			step.Action.reset()
+		}
+	}
+}
+
+// Clone returns a deep copy of the test set: cases, steps, actions and SUT are all copied, so the clone can be modified and
+// executed independently. The topology (not modified by execution), event sink and progress callback are shared with the
+// original.
+func (ts *TestSet) Clone() *TestSet {
+
+	c := &TestSet{
+		ID:                  ts.ID,
+		Name:                ts.Name,
+		Description:         ts.Description,
+		Sut:                 ts.Sut.Clone(),
+		Topology:            ts.Topology,
+		Setup:               ts.Setup.Clone(),
+		Cleanup:             ts.Cleanup.Clone(),
+		BeforeAll:           cloneActions(ts.BeforeAll),
+		AfterAll:            cloneActions(ts.AfterAll),
+		PingSut:             ts.PingSut,
+		Rerun:               ts.Rerun,
+		ContinueOnSetupFail: ts.ContinueOnSetupFail,
+		TimedOut:            ts.TimedOut,
+		Events:              ts.Events,
+		OnProgress:          ts.OnProgress,
+	}
+	if ts.Cases != nil {
+		c.Cases = make([]*TestCase, len(ts.Cases))
+		for ix, tc := range ts.Cases {
+			c.Cases[ix] = tc.Clone()
+		}
+	}
+	return c
+}
 
 // Initialize initializes a new TestSet.
 func (ts *TestSet) Initialize() {
@@ -88,6 +209,97 @@ func (ts *TestSet) Initialize() {
 	}
 }
 
+// Execute the given list of hooks in order and return true when none of them has failed.
+func (ts *TestSet) executeHooks(ctx context.Context, kind string, hooks []*Action, disp ExecDisplayFnCback) bool {
+
+	ok := true
+	for ix, hook := range hooks {
+		if !hook.IsExecutable() {
+			continue
+		}
+		disp("notice", fmt.Sprintf("Executing %s hook #%d: %q\n", kind, ix+1, hook.String()))
+		disp("info", ts.opts.formatOutput(hook.ExecuteWithOptions(ctx, ts.opts)))
+		if hook.Result.Failed() {
+			emit(ts.Events, Event{Type: HookFailed, Set: ts.Name, Message: fmt.Sprintf("%s hook #%d", kind, ix+1)})
+			disp("error", fmt.Sprintf("The %s hook #%d has FAILED\n", kind, ix+1))
+			ok = false
+		}
+	}
+	return ok
+}
+
+// FindDevice looks up a device in the topology by its name; nothing is found when the topology is not defined.
+func (ts *TestSet) FindDevice(name string) (Device, bool) {
+
+	if ts.Topology == nil {
+		return nil, false
+	}
+	return ts.Topology.FindDevice(name)
+}
+
+// Validate checks the TestSet for configuration problems and returns a list of them; the list is empty when the test set
+// is valid. The following is checked: every case must have a name, every step must have an action, expected results must
+// be valid, executable actions must define a script and devices referenced by steps must exist in the topology.
+func (ts *TestSet) Validate() []error {
+
+	errs := make([]error, 0)
+	invalid := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%w: "+format, append([]interface{}{ErrorInvalidValue}, args...)...))
+	}
+	checkAction := func(a *Action, where string) {
+		if a.IsExecutable() && a.Script == "" && a.Assert == nil && a.MainClass == "" {
+			invalid("%s: executable action has no script", where)
+		}
+		if a != nil && a.Remote != nil && a.Remote.Host == "" {
+			invalid("%s: remote action has no host", where)
+		}
+	}
+
+	if ts.PingSut && (ts.Sut == nil || ts.Sut.IPaddr == "") {
+		invalid("SUT reachability is checked, but SUT has no IP address")
+	}
+	checkAction(ts.Setup, "test set setup")
+	checkAction(ts.Cleanup, "test set cleanup")
+	for ix, hook := range ts.BeforeAll {
+		checkAction(hook, fmt.Sprintf("test set before-all hook #%d", ix+1))
+	}
+	for ix, hook := range ts.AfterAll {
+		checkAction(hook, fmt.Sprintf("test set after-all hook #%d", ix+1))
+	}
+	for ix, tc := range ts.Cases {
+		cname := tc.Name
+		if cname == "" {
+			cname = fmt.Sprintf("#%d", ix+1)
+			invalid("test case %s has no name", cname)
+		}
+		if tc.Expected != "" && !IsValidTestResult(string(tc.Expected)) {
+			invalid("test case %s: invalid expected result %q", cname, tc.Expected)
+		}
+		checkAction(tc.Setup, fmt.Sprintf("test case %s setup", cname))
+		checkAction(tc.Cleanup, fmt.Sprintf("test case %s cleanup", cname))
+		checkAction(tc.BeforeEach, fmt.Sprintf("test case %s before-each hook", cname))
+		checkAction(tc.AfterEach, fmt.Sprintf("test case %s after-each hook", cname))
+		for _, step := range tc.Steps {
+			if step.Action == nil {
+				invalid("test case %s: step %q has no action", cname, step.Name)
+			}
+			if step.Expected != "" && !IsValidTestResult(string(step.Expected)) {
+				invalid("test case %s: step %q has invalid expected result %q", cname, step.Name, step.Expected)
+			}
+			checkAction(step.Action, fmt.Sprintf("test case %s: step %q", cname, step.Name))
+			if step.Device != "" {
+				if _, ok := ts.FindDevice(step.Device); !ok {
+					invalid("test case %s: step %q references unknown device %q", cname, step.Name, step.Device)
+				}
+			}
+		}
+	}
+	if _, err := orderCases(ts.Cases); err != nil {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
 // String returns a human-readable representation of the TestSet instance.
 func (ts *TestSet) String() string {
 
@@ -114,9 +326,13 @@ func (ts *TestSet) String() string {
 }
 
 // XML returns an XML-encoded representation of the TestSet instance.
-func (ts *TestSet) XML() (string, error) {
+func (ts *TestSet) XML() (string, error) { return ts.XMLIndent(DefaultXMLPrefix, DefaultXMLIndent) }
+
+// XMLIndent returns the same representation as XML(), but every line begins with the given prefix and is indented
+// with one or more copies of the given indent.
+func (ts *TestSet) XMLIndent(prefix, indent string) (string, error) {
 
-	output, err := xml.MarshalIndent(ts, "", "  ")
+	output, err := xml.MarshalIndent(ts, prefix, indent)
 	if err != nil {
 		return "", err
 	}
@@ -133,10 +349,47 @@ func (ts *TestSet) JSON() (string, error) {
 	return string(b[:]), err
 }
 
-// HTML returns a HTML-encoded representation of the TestSet instance.
+// HTML returns a HTML-encoded representation of the TestSet instance: a heading followed by all the test cases.
 func (ts *TestSet) HTML() (string, error) {
-	// TODO
-	return "", nil
+
+	cases, err := RenderHTML(ts.renderables()...)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("<h2>Test Set: %s</h2>\n", escapeHTML(ts.Name)) + cases, nil
+}
+
+// Return the test cases as a list of Renderable entities.
+func (ts *TestSet) renderables() []Renderable {
+
+	items := make([]Renderable, len(ts.Cases))
+	for ix, tc := range ts.Cases {
+		items[ix] = tc
+	}
+	return items
+}
+
+// AllPassed returns true when the test set has passed: none of the test cases has failed (expected failures are evaluated
+// as passed) and at least one of them has passed; the not tested cases are neutral. The same rule is used by
+// TestReport.ExitCode().
+func (ts *TestSet) AllPassed() bool { return ts.exitCode() == ExitPassed }
+
+// Return the process exit code reflecting the results of the test set (see TestReport.ExitCode()).
+func (ts *TestSet) exitCode() int {
+
+	passed := 0
+	for _, tc := range ts.Cases {
+		if tc.Status.Failed() {
+			return ExitFailed
+		}
+		if tc.Status == "Pass" {
+			passed++
+		}
+	}
+	if passed == 0 {
+		return ExitNotTested
+	}
+	return ExitPassed
 }
 
 // Append one or more test cases to the list of cases.
@@ -144,6 +397,201 @@ func (ts *TestSet) Append(set ...*TestCase) {
 	ts.Cases = append(ts.Cases, set...)
 }
 
+// Merge appends the copies of the other test set's cases to this test set. If case name is already used, the merged case is
+// renamed to "<name> (2)" (or next free number) when 'rename' is set, otherwise an error is returned and nothing is merged.
+// The dependencies of merged cases follow the renames. The SUT, topology, setup and cleanup actions of this test set take
+// precedence: the other set's ones are used only when they are not defined here. The other set's hooks are appended.
+func (ts *TestSet) Merge(other *TestSet, rename bool) error {
+
+	if other == nil {
+		return nil
+	}
+
+	used := make(map[string]bool)
+	for _, tc := range ts.Cases {
+		used[tc.Name] = true
+	}
+
+	// resolve the names of merged cases first, so nothing is merged on error
+	cases := make([]*TestCase, len(other.Cases))
+	renamed := make(map[string]string)
+	for ix, tc := range other.Cases {
+		c := tc.Clone()
+		if used[c.Name] {
+			if !rename {
+				return fmt.Errorf("%w: duplicate test case name %q", ErrorInvalidValue, c.Name)
+			}
+			name := c.Name
+			for n := 2; used[c.Name]; n++ {
+				c.Name = fmt.Sprintf("%s (%d)", name, n)
+			}
+			renamed[name] = c.Name
+		}
+		used[c.Name] = true
+		cases[ix] = c
+	}
+	for _, c := range cases {
+		for ix, dep := range c.DependsOn {
+			if name, ok := renamed[dep]; ok {
+				c.DependsOn[ix] = name
+			}
+		}
+	}
+
+	if ts.Sut == nil {
+		ts.Sut = other.Sut.Clone()
+	}
+	if ts.Topology == nil {
+		ts.Topology = other.Topology
+	}
+	if ts.Setup.IsEmpty() && !other.Setup.IsEmpty() {
+		ts.Setup = other.Setup.Clone()
+	}
+	if ts.Cleanup.IsEmpty() && !other.Cleanup.IsEmpty() {
+		ts.Cleanup = other.Cleanup.Clone()
+	}
+	ts.BeforeAll = append(ts.BeforeAll, cloneActions(other.BeforeAll)...)
+	ts.AfterAll = append(ts.AfterAll, cloneActions(other.AfterAll)...)
+	ts.Append(cases...)
+	return nil
+}
+
+// Mark all the test cases and steps as not tested and return the message explaining why.
+func (ts *TestSet) skipAll(reason string) string {
+
+	for _, tc := range ts.Cases {
+		tc.Status = "NotTested"
+		for _, step := range tc.Steps {
+			step.Status = "NotTested"
+		}
+	}
+	return fmt.Sprintf("%s: stopping the complete test set execution.\n", reason)
+}
+
+// Private function that orders the given test cases so that every case follows all the cases it depends on; otherwise,
+// the original order is preserved. An error is returned when a dependency is unknown or dependencies form a cycle.
+func orderCases(cases []*TestCase) ([]*TestCase, error) {
+
+	names := make(map[string]bool)
+	for _, tc := range cases {
+		names[tc.Name] = true
+	}
+	for _, tc := range cases {
+		for _, dep := range tc.DependsOn {
+			if !names[dep] {
+				return nil, fmt.Errorf("%w: test case %q depends on unknown case %q", ErrorInvalidValue, tc.Name, dep)
+			}
+		}
+	}
+
+	ordered := make([]*TestCase, 0, len(cases))
+	done := make(map[string]bool)
+	placed := make([]bool, len(cases))
+	for len(ordered) < len(cases) {
+		progress := false
+		for ix, tc := range cases {
+			if placed[ix] {
+				continue
+			}
+			ready := true
+			for _, dep := range tc.DependsOn {
+				if !done[dep] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				ordered = append(ordered, tc)
+				done[tc.Name] = true
+				placed[ix] = true
+				progress = true
+				break
+			}
+		}
+		if !progress {
+			cycle := make([]string, 0)
+			for ix, tc := range cases {
+				if !placed[ix] {
+					cycle = append(cycle, tc.Name)
+				}
+			}
+			return nil, fmt.Errorf("%w: dependency cycle among test cases: %s", ErrorInvalidValue,
+				strings.Join(cycle, ", "))
+		}
+	}
+	return ordered, nil
+}
+
+// Execute the given test cases in dependency order; a case whose dependency has not passed is not executed, but marked as
+// not tested.
+func (ts *TestSet) executeCases(cases []*TestCase, display *ExecDisplayFnCback) {
+
+	disp := *display
+	ordered, err := orderCases(cases)
+	if err != nil {
+		disp("error", fmt.Sprintf("%s\n", err))
+		return
+	}
+
+	progress := Progress{TotalCases: len(ordered), TotalSteps: ts.CountSteps()}
+	report := func() {
+		if ts.OnProgress != nil {
+			ts.OnProgress(progress)
+		}
+	}
+
+	status := make(map[string]TestResult)
+	anyFailed := false
+	for _, tc := range ordered {
+		reason := ""
+		if ts.ctx != nil && ts.ctx.Err() != nil {
+			reason = ts.ctx.Err().Error()
+		} else if ts.failFast && anyFailed {
+			reason = "previous test case has failed"
+		}
+		if reason != "" {
+			disp("warning", fmt.Sprintf("Skipping test case %q: %s\n", tc.Name, reason))
+			emit(ts.Events, Event{Type: CaseSkipped, Set: ts.Name, Case: tc.Name, Message: reason})
+			tc.Status = "NotTested"
+			for _, step := range tc.Steps {
+				step.Status = "NotTested"
+			}
+			progress.DoneSteps += len(tc.Steps)
+			progress.DoneCases++
+			report()
+			continue
+		}
+		failed := ""
+		for _, dep := range tc.DependsOn {
+			if status[dep] != "Pass" {
+				failed = dep
+				break
+			}
+		}
+		if failed != "" {
+			disp("warning", fmt.Sprintf("Skipping test case %q: dependency %q has not passed\n", tc.Name, failed))
+			emit(ts.Events, Event{Type: CaseSkipped, Set: ts.Name, Case: tc.Name,
+				Message: fmt.Sprintf("dependency %q has not passed", failed)})
+			tc.Status = "NotTested"
+			for _, step := range tc.Steps {
+				step.Status = "NotTested"
+			}
+			progress.DoneSteps += len(tc.Steps)
+		} else {
+			tc.events, tc.set, tc.ctx, tc.opts = ts.Events, ts.Name, ts.ctx, ts.opts
+			tc.stepDone = func() {
+				progress.DoneSteps++
+				report()
+			}
+			tc.Execute(display)
+		}
+		progress.DoneCases++
+		report()
+		status[tc.Name] = tc.Status
+		anyFailed = anyFailed || tc.Status.Failed()
+	}
+}
+
 // CleanupAfterTsetSetupFail performs a clenaup of data when execution of the setup action fails.
 func (ts *TestSet) CleanupAfterTsetSetupFail() string {
 
@@ -159,41 +607,143 @@ func (ts *TestSet) CleanupAfterTsetSetupFail() string {
 	return o
 }
 
+// ExecuteWithOptions executes the entire TestSet the same way as Execute() does, using the given execution options for all
+// the executed actions.
+func (ts *TestSet) ExecuteWithOptions(display *ExecDisplayFnCback, opts ExecOptions) {
+
+	ts.opts = opts
+	defer func() { ts.opts = ExecOptions{} }()
+	ts.Execute(display)
+}
+
 // Execute executes the entire TestSet.
-func (ts *TestSet) Execute(display *ExecDisplayFnCback) {
+func (ts *TestSet) Execute(display *ExecDisplayFnCback) { ts.execute(display, ts.Cases) }
+
+// ExecuteShuffled executes the entire TestSet with test cases in random order. The order is determined by the given seed
+// (which is displayed), so a failing order can be reproduced by executing the set again with the same seed. Setup and
+// cleanup actions are executed as usual; case dependencies are still honored.
+func (ts *TestSet) ExecuteShuffled(display *ExecDisplayFnCback, seed int64) {
+
+	disp := *display
+	disp("notice", fmt.Sprintf("Shuffling test cases using seed %d\n", seed))
+	ts.execute(display, shuffleCases(ts.Cases, seed))
+}
+
+// Private function that returns a copy of the given test cases in random order determined by the given seed.
+func shuffleCases(cases []*TestCase, seed int64) []*TestCase {
+
+	shuffled := make([]*TestCase, len(cases))
+	copy(shuffled, cases)
+	r := rand.New(rand.NewSource(seed))
+	r.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+	return shuffled
+}
+
+// ExecuteWithDeadline executes the entire TestSet, but aborts the execution when it takes longer than the given duration:
+// the currently executed action is cancelled and the remaining test cases are marked as not tested. The after-all hooks and
+// the cleanup action are executed regardless. When deadline is exceeded, the TimedOut flag is set.
+func (ts *TestSet) ExecuteWithDeadline(display *ExecDisplayFnCback, d time.Duration) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+	ts.ctx = ctx
+	defer func() { ts.ctx = nil }()
+	ts.execute(display, ts.Cases)
+}
+
+// Execute the entire TestSet, executing the given test cases in the given order.
+func (ts *TestSet) execute(display *ExecDisplayFnCback, cases []*TestCase) {
 
 	output := ""
+	ctx := orBackground(ts.ctx)
 
 	// define function from function pointer
 	disp := *display
 
-	// execute the cleanup action
 	disp("notice", fmt.Sprintf(">>> Entering Test Set %q\n", ts.Name))
-	if ts.Setup != nil && ts.Setup.Executable {
+	if !ts.Rerun {
+		ts.Reset()
+	}
+	ts.TimedOut = false
+	start := time.Now()
+	emit(ts.Events, Event{Type: SetStarted, Set: ts.Name})
+	defer func() { emit(ts.Events, Event{Type: SetFinished, Set: ts.Name, Duration: time.Since(start)}) }()
+
+	// case dependencies must be resolvable, otherwise nothing is executed
+	if _, err := orderCases(cases); err != nil {
+		disp("error", fmt.Sprintf("%s\n", err))
+		disp("error", ts.skipAll("Invalid test case dependencies"))
+		disp("notice", fmt.Sprintf("<<< Leaving test set %q\n", ts.Name))
+		return
+	}
+
+	// check the SUT first, if needed: there's no point in executing anything when SUT is down
+	if ts.PingSut && ts.Sut != nil {
+		if err := ts.Sut.Ping(ts.opts.sutPingTimeout()); err != nil {
+			disp("error", fmt.Sprintf("SUT %q (%s) is not reachable: %s\n", ts.Sut.Name, ts.Sut.IPaddr, err))
+			disp("error", ts.skipAll("SUT is down"))
+			disp("notice", fmt.Sprintf("<<< Leaving test set %q\n", ts.Name))
+			return
+		}
+		disp("notice", fmt.Sprintf("SUT %q is up.\n", ts.Sut.Name))
+	}
+
+	// once the setup is executed, the after-all hooks and cleanup are always executed, however the execution ends
+	defer ts.finish(ctx, disp)
+
+	// execute the setup action
+	if ts.Setup.IsExecutable() {
 		disp("notice", fmt.Sprintf("Executing setup script: %q\n",
 			ts.Setup.String()))
-		output = ts.Setup.Execute()
-		disp("info", FmtOutput(output))
+		output = ts.Setup.ExecuteWithOptions(ctx, ts.opts)
+		disp("info", ts.opts.formatOutput(output))
 		// if setup script has failed, there's no need to proceed...
-		if ts.Setup.Result == "Fail" {
-			disp("error", ts.CleanupAfterTsetSetupFail())
+		// ...unless we're told to continue regardless
+		if ts.Setup.Result.Failed() {
+			emit(ts.Events, Event{Type: SetupFailed, Set: ts.Name})
+			if !ts.ContinueOnSetupFail {
+				disp("error", ts.skipAll("Setup has FAILED"))
+				return
+			}
+			disp("error", "Setup has FAILED: continuing with the test cases anyway.\n")
 		}
 	} else {
 		disp("notice", fmt.Sprintln("Setup action is not defined."))
 	}
 
-	// execute test cases
-	if ts.Cases != nil {
+	// execute the before-all hooks; if any of them fails, the test cases are not executed
+	if ts.executeHooks(ctx, "before-all", ts.BeforeAll, disp) {
+		// execute test cases
+		ts.executeCases(cases, display)
+	} else {
+		disp("error", "Before-all hook has FAILED: skipping all test cases.\n")
 		for _, tc := range ts.Cases {
-			tc.Execute(display)
+			tc.Status = "NotTested"
+			for _, step := range tc.Steps {
+				step.Status = "NotTested"
+			}
 		}
 	}
+}
+
+// Finish the test set execution: record the exceeded deadline (if any) and execute the after-all hooks and the cleanup
+// action. These are executed regardless of the test cases' results (and the deadline).
+func (ts *TestSet) finish(ctx context.Context, disp ExecDisplayFnCback) {
+
+	// the deadline may have been exceeded in the meantime (during setup, too)
+	if ctx.Err() == context.DeadlineExceeded {
+		ts.TimedOut = true
+		disp("error", "Deadline exceeded: test set execution has been aborted.\n")
+	}
+
+	// execute the after-all hooks
+	ts.executeHooks(context.Background(), "after-all", ts.AfterAll, disp)
 
 	// execute the cleanup action
-	if ts.Cleanup != nil && ts.Cleanup.Executable {
+	if ts.Cleanup.IsExecutable() {
 		disp("notice", fmt.Sprintf("Executing cleanup script: %q\n",
 			ts.Cleanup.String()))
-		disp("info", FmtOutput(ts.Cleanup.Execute()))
+		disp("info", ts.opts.formatOutput(ts.Cleanup.ExecuteWithOptions(context.Background(), ts.opts)))
 	} else {
 		disp("notice", fmt.Sprintln("Cleanup action is not defined:"))
 	}
@@ -203,5 +753,5 @@ func (ts *TestSet) Execute(display *ExecDisplayFnCback) {
 // CreateTestSet creates a new instance of the TestSet type with given data.
 func CreateTestSet(name, descr string, sut *SysUnderTest, setup, cleanup *Action) *TestSet {
 	var tcs []*TestCase
-	return &TestSet{name, descr, sut, setup, cleanup, tcs}
+	return &TestSet{Name: name, Description: descr, Sut: sut, Setup: setup, Cleanup: cleanup, Cases: tcs}
 }
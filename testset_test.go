@@ -0,0 +1,774 @@
+package atf
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTestSetValidate(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		modify func(ts *TestSet)
+		errs   int
+	}{
+		{"valid", func(ts *TestSet) {}, 0},
+		{"unnamed case", func(ts *TestSet) { ts.Cases[0].Name = "" }, 1},
+		{"invalid case expected", func(ts *TestSet) { ts.Cases[0].Expected = "Maybe" }, 1},
+		{"step without action", func(ts *TestSet) { ts.Cases[0].Steps[0].Action = nil }, 1},
+		{"invalid step expected", func(ts *TestSet) { ts.Cases[0].Steps[0].Expected = "Maybe" }, 1},
+		{"empty script", func(ts *TestSet) { ts.Cases[0].Steps[0].Action.Script = "" }, 1},
+		{"empty setup script", func(ts *TestSet) { ts.Setup = CreateAction("", "") }, 1},
+		{"manual action", func(ts *TestSet) { ts.Cases[0].Steps[0].Action = CreateManualAction("Check it") }, 0},
+		{"remote without host", func(ts *TestSet) { ts.Cases[0].Steps[0].Action.Remote = &SSHConfig{} }, 1},
+		{"unknown device", func(ts *TestSet) { ts.Cases[0].Steps[0].Device = "router" }, 1},
+		{"ping without SUT", func(ts *TestSet) { ts.PingSut = true }, 1},
+		{"ping without SUT address", func(ts *TestSet) {
+			ts.Sut, ts.PingSut = CreateSUT("SUT", "Software", "1.0", "", ""), true
+		}, 1},
+		{"ping", func(ts *TestSet) { ts.Sut, ts.PingSut = CreateSUT("SUT", "Software", "1.0", "", "10.0.0.1"), true }, 0},
+		{"several problems", func(ts *TestSet) {
+			ts.Cases[0].Name = ""
+			ts.Cases[0].Steps[0].Expected = "Maybe"
+			ts.Cases[0].Steps[0].Action.Script = ""
+		}, 3},
+	}
+	for _, tt := range tests {
+		ts := newReportSet(CreateTestStep("Step", "", "Pass", "NotTested", CreateAction("check.sh", "")))
+		tt.modify(ts)
+		errs := ts.Validate()
+		if len(errs) != tt.errs {
+			t.Errorf("%s: expected %d errors, got %v", tt.name, tt.errs, errs)
+		}
+		for _, err := range errs {
+			if !errors.Is(err, ErrorInvalidValue) {
+				t.Errorf("%s: unexpected error type: %s", tt.name, err)
+			}
+		}
+	}
+}
+
+func TestCollectValidate(t *testing.T) {
+
+	pth := writeConfig(t, t.TempDir(), "invalid.json",
+		`{"Name": "Invalid", "Cases": [{"Name": "", "Steps": [{"Name": "s", "Action": {"Executable": true}}]}]}`)
+
+	if _, err := Collect(pth); err != nil {
+		t.Errorf("Collect() without validation failed: %s", err)
+	}
+	_, err := CollectOptions{Validate: true}.Collect(pth)
+	if !errors.Is(err, ErrorInvalidValue) {
+		t.Errorf("expected validation error, got %v", err)
+	}
+	if _, err := (CollectOptions{Validate: true}).Collect(filepath.Join("testdata", "smoke.yaml")); err != nil {
+		t.Errorf("valid config failed validation: %s", err)
+	}
+}
+
+// Return a display callback that discards all the messages.
+func quietDisplay() *ExecDisplayFnCback {
+	var disp ExecDisplayFnCback = func(...string) {}
+	return &disp
+}
+
+// Create a script that records its first argument (one per line) and exits with the status given as the second argument
+// (0 by default). The function returning the recorded lines is returned, too.
+func newRecorder(t *testing.T) (string, func() []string) {
+
+	t.Helper()
+	dir := t.TempDir()
+	record := filepath.Join(dir, "record.txt")
+	script := filepath.Join(dir, "record")
+	text := fmt.Sprintf("#!/bin/sh\necho \"$1\" >> %q\nexit ${2:-0}\n", record)
+	if err := os.WriteFile(script, []byte(text), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return script, func() []string {
+		data, _ := os.ReadFile(record)
+		return strings.Fields(string(data))
+	}
+}
+
+func TestTestSetHooks(t *testing.T) {
+
+	rec, recorded := newRecorder(t)
+	tests := []struct {
+		before   []string
+		step     string
+		want     string
+		executed bool
+	}{
+		{[]string{"b1", "b2"}, "step", "b1 b2 step a1 a2", true},
+		{[]string{"b1", "b2"}, "step 1", "b1 b2 step a1 a2", true},
+		{[]string{"b1 1", "b2"}, "step", "b1 b2 a1 a2", false},
+	}
+	for ix, tt := range tests {
+		ts := newReportSet(CreateTestStep("s", "", "Pass", "NotTested", CreateAction(rec, tt.step)))
+		for _, args := range tt.before {
+			ts.BeforeAll = append(ts.BeforeAll, CreateAction(rec, args))
+		}
+		ts.AfterAll = []*Action{CreateAction(rec, "a1"), CreateAction(rec, "a2")}
+		start := len(recorded())
+		ts.Execute(quietDisplay())
+
+		if got := strings.Join(recorded()[start:], " "); got != tt.want {
+			t.Errorf("#%d: expected execution order %q, got %q", ix, tt.want, got)
+		}
+		if executed := ts.Cases[0].Status != "NotTested"; executed != tt.executed {
+			t.Errorf("#%d: unexpected case status %s", ix, ts.Cases[0].Status)
+		}
+		for _, hook := range ts.AfterAll {
+			if hook.Result != "Pass" {
+				t.Errorf("#%d: after-all hook has not been executed: %s", ix, hook.Result)
+			}
+		}
+		html, _ := CreateTestReport(ts).HTML()
+		if !strings.Contains(html, "Before All #2") || !strings.Contains(html, "After All #1") {
+			t.Errorf("#%d: hooks are not reported", ix)
+		}
+	}
+}
+
+// Create a test set with a case for every given name; every case has a single step recording the case name, the step
+// fails when the name is listed in 'failing'.
+func newRecordingSet(rec string, names []string, failing ...string) *TestSet {
+
+	ts := CreateTestSet("Set", "", nil, nil, nil)
+	for _, name := range names {
+		args := name
+		for _, f := range failing {
+			if f == name {
+				args += " 1"
+			}
+		}
+		tc := CreateTestCase(name, "", nil, nil, "Pass", "NotTested")
+		tc.Append(CreateTestStep("step", "", "Pass", "NotTested", CreateAction(rec, args)))
+		ts.Append(tc)
+	}
+	return ts
+}
+
+func TestTestSetDependencies(t *testing.T) {
+
+	rec, recorded := newRecorder(t)
+	tests := []struct {
+		name     string
+		deps     map[string][]string
+		failing  []string
+		order    string
+		statuses string
+	}{
+		{"chain", map[string][]string{"a": {"b"}, "b": {"c"}}, nil, "c b a", "Pass Pass Pass"},
+		{"independent", nil, nil, "a b c", "Pass Pass Pass"},
+		{"skipped", map[string][]string{"a": {"b"}, "b": {"c"}}, []string{"c"}, "c", "NotTested NotTested Fail"},
+		{"partial", map[string][]string{"b": {"a"}}, []string{"a"}, "a c", "Fail NotTested Pass"},
+		{"cycle", map[string][]string{"a": {"b"}, "b": {"a"}}, nil, "", "NotTested NotTested NotTested"},
+		{"unknown", map[string][]string{"a": {"x"}}, nil, "", "NotTested NotTested NotTested"},
+	}
+	for _, tt := range tests {
+		ts := newRecordingSet(rec, []string{"a", "b", "c"}, tt.failing...)
+		for _, tc := range ts.Cases {
+			tc.DependsOn = tt.deps[tc.Name]
+		}
+		start := len(recorded())
+		ts.Execute(quietDisplay())
+
+		if got := strings.Join(recorded()[start:], " "); got != tt.order {
+			t.Errorf("%s: expected execution order %q, got %q", tt.name, tt.order, got)
+		}
+		statuses := make([]string, 0, len(ts.Cases))
+		for _, tc := range ts.Cases {
+			statuses = append(statuses, string(tc.Status))
+		}
+		if got := strings.Join(statuses, " "); got != tt.statuses {
+			t.Errorf("%s: expected statuses %q, got %q", tt.name, tt.statuses, got)
+		}
+	}
+}
+
+func TestTestSetValidateDependencies(t *testing.T) {
+
+	ts := newRecordingSet("/bin/true", []string{"a", "b"})
+	ts.Cases[0].DependsOn, ts.Cases[1].DependsOn = []string{"b"}, []string{"a"}
+	errs := ts.Validate()
+	if len(errs) != 1 || !errors.Is(errs[0], ErrorInvalidValue) || !strings.Contains(errs[0].Error(), "cycle") {
+		t.Errorf("expected dependency cycle error, got %v", errs)
+	}
+}
+
+func TestTestSetExecuteShuffled(t *testing.T) {
+
+	rec, recorded := newRecorder(t)
+	names := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	run := func(seed int64) (string, []string) {
+		var msgs []string
+		var disp ExecDisplayFnCback = func(args ...string) { msgs = append(msgs, strings.Join(args, " ")) }
+		ts := newRecordingSet(rec, names)
+		ts.Setup, ts.Cleanup = CreateAction(rec, "setup"), CreateAction(rec, "cleanup")
+		start := len(recorded())
+		ts.ExecuteShuffled(&disp, seed)
+		return strings.Join(recorded()[start:], " "), msgs
+	}
+
+	orders := make(map[string]bool)
+	for seed := int64(1); seed <= 5; seed++ {
+		first, msgs := run(seed)
+		if second, _ := run(seed); first != second {
+			t.Errorf("seed %d: different orders %q and %q", seed, first, second)
+		}
+		if !strings.HasPrefix(first, "setup ") || !strings.HasSuffix(first, " cleanup") {
+			t.Errorf("seed %d: setup and cleanup do not bracket the run: %q", seed, first)
+		}
+		if !strings.Contains(strings.Join(msgs, ""), fmt.Sprintf("seed %d", seed)) {
+			t.Errorf("seed %d: seed is not displayed", seed)
+		}
+		orders[first] = true
+	}
+	if len(orders) < 2 {
+		t.Errorf("different seeds produced the same order: %v", orders)
+	}
+}
+
+func TestTestSetProgress(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		setup func(ts *TestSet)
+	}{
+		{"all executed", func(ts *TestSet) {}},
+		{"skipped dependent", func(ts *TestSet) {
+			ts.Cases[0].Steps[0].Action = CreateAction("/bin/false", "")
+			ts.Cases[1].DependsOn = []string{"a"}
+		}},
+		{"no steps", func(ts *TestSet) { ts.Cases[2].Steps = nil }},
+	}
+	for _, tt := range tests {
+		ts := newRecordingSet("/bin/true", []string{"a", "b", "c"})
+		ts.Cases[1].Append(CreateTestStep("second", "", "Pass", "NotTested", CreateAction("/bin/true", "")))
+		tt.setup(ts)
+
+		var updates []Progress
+		ts.OnProgress = func(p Progress) { updates = append(updates, p) }
+		ts.Execute(quietDisplay())
+
+		if len(updates) == 0 {
+			t.Fatalf("%s: no progress reported", tt.name)
+		}
+		last := updates[len(updates)-1]
+		if last.TotalCases != 3 || last.TotalSteps != ts.CountSteps() || last.DoneCases != last.TotalCases ||
+			last.DoneSteps != last.TotalSteps {
+			t.Errorf("%s: final progress %+v does not match the totals", tt.name, last)
+		}
+		for ix := 1; ix < len(updates); ix++ {
+			prev, cur := updates[ix-1], updates[ix]
+			if cur.DoneCases < prev.DoneCases || cur.DoneSteps < prev.DoneSteps ||
+				cur.DoneCases+cur.DoneSteps == prev.DoneCases+prev.DoneSteps {
+				t.Errorf("%s: progress is not monotonic: %+v -> %+v", tt.name, prev, cur)
+			}
+		}
+	}
+}
+
+func TestTestSetClone(t *testing.T) {
+
+	newSet := func() *TestSet {
+		ts := newRecordingSet("check.sh", []string{"a", "b"})
+		ts.Sut = CreateSUTMulti("SUT", "Hardware", "1.0", "", "10.0.0.1", "10.0.0.2")
+		ts.Setup, ts.Cleanup = CreateAction("setup.sh", "--all"), CreateAction("cleanup.sh", "")
+		ts.BeforeAll = []*Action{CreateAction("before.sh", "")}
+		ts.Cases[1].DependsOn = []string{"a"}
+		ts.Cases[0].BeforeEach = CreateAction("reset.sh", "")
+		ts.Cases[0].Steps[0].Artifacts = []string{"out.log"}
+		return ts
+	}
+
+	tests := []struct {
+		name   string
+		mutate func(c *TestSet)
+	}{
+		{"step status", func(c *TestSet) { c.Cases[0].Steps[0].Status = "Fail" }},
+		{"step action", func(c *TestSet) { c.Cases[0].Steps[0].Action.Args = "changed" }},
+		{"step artifacts", func(c *TestSet) { c.Cases[0].Steps[0].Artifacts[0] = "changed" }},
+		{"case", func(c *TestSet) { c.Cases[0].Name, c.Cases[0].Status = "changed", "Pass" }},
+		{"case hook", func(c *TestSet) { c.Cases[0].BeforeEach.Script = "changed" }},
+		{"dependencies", func(c *TestSet) { c.Cases[1].DependsOn[0] = "changed" }},
+		{"case list", func(c *TestSet) { c.Cases[1] = c.Cases[0] }},
+		{"SUT", func(c *TestSet) { c.Sut.IPaddr, c.Sut.Addresses[1] = "changed", "changed" }},
+		{"setup", func(c *TestSet) { c.Setup.Script, c.Setup.Result = "changed", "Fail" }},
+		{"cleanup", func(c *TestSet) { c.Cleanup.Output = "changed" }},
+		{"hooks", func(c *TestSet) { c.BeforeAll[0].Script = "changed" }},
+	}
+	for _, tt := range tests {
+		ts := newSet()
+		c := ts.Clone()
+		if !reflect.DeepEqual(c, ts) {
+			t.Fatalf("clone differs from the original")
+		}
+		tt.mutate(c)
+		if !reflect.DeepEqual(ts, newSet()) {
+			t.Errorf("%s: mutating the clone has changed the original", tt.name)
+		}
+	}
+
+	// conversions to and from test plan copy the cases, too
+	ts := newSet()
+	ts.ToTestPlan().Cases[0].Steps[0].Action.Args = "changed"
+	tp := ts.ToTestPlan()
+	tp.ToTestSet().Cases[0].Name = "changed"
+	if !reflect.DeepEqual(ts, newSet()) || tp.Cases[0].Name != "a" {
+		t.Error("test plan conversions share data with the original")
+	}
+}
+
+func TestTestSetToTestPlan(t *testing.T) {
+
+	ts := newRecordingSet("/bin/true", []string{"a", "b"})
+	ts.Description = "Executed set"
+	ts.Sut = CreateSUT("SUT", "Hardware", "1.0", "", "10.0.0.1")
+	ts.Setup, ts.Cleanup = CreateAction("/bin/true", "setup"), CreateAction("/bin/false", "")
+	ts.Execute(quietDisplay())
+
+	tp := ts.ToTestPlan()
+	if tp.Name != ts.Name || tp.Description != ts.Description || len(tp.Cases) != len(ts.Cases) {
+		t.Fatalf("unexpected test plan: %+v", tp)
+	}
+	if tp.Setup == ts.Setup || tp.Setup.Args != "setup" || tp.Cleanup.Script != "/bin/false" {
+		t.Errorf("unexpected setup/cleanup: %v, %v", tp.Setup, tp.Cleanup)
+	}
+	for _, a := range []*Action{tp.Setup, tp.Cleanup} {
+		if a.Result != "NotTested" || a.Output != "" {
+			t.Errorf("action result has not been reset: %s, %q", a.Result, a.Output)
+		}
+	}
+	for ix, tc := range tp.Cases {
+		if tc == ts.Cases[ix] || tc.Name != ts.Cases[ix].Name || tc.Status != "NotTested" {
+			t.Errorf("case %q: unexpected copy with status %s", tc.Name, tc.Status)
+		}
+		for _, step := range tc.Steps {
+			if step.Status != "NotTested" || step.Action.Result != "NotTested" || step.Action.Output != "" {
+				t.Errorf("step %q: statuses have not been reset", step.Name)
+			}
+		}
+	}
+	// the executed set keeps its results; the plan is converted back without SUT
+	if ts.Cases[0].Status != "Pass" || ts.Cleanup.Result != "Fail" {
+		t.Errorf("converting has changed the executed set: %s, %s", ts.Cases[0].Status, ts.Cleanup.Result)
+	}
+	if s := tp.ToTestSet().Sut; s == ts.Sut || s.Name != "" {
+		t.Errorf("converted test set references the SUT: %v", s)
+	}
+}
+
+func TestTestSetReset(t *testing.T) {
+
+	ts := newRecordingSet("/bin/true", []string{"a", "b"})
+	ts.Setup, ts.Cleanup = CreateAction("/bin/true", "setup"), CreateAction("/bin/false", "")
+	ts.BeforeAll = []*Action{CreateAction("/bin/true", "before")}
+	ts.Cases[1].Steps[0].Action = CreateAction("/bin/false", "")
+	ts.Execute(quietDisplay())
+	if ts.Cases[0].Status != "Pass" || ts.Cases[1].Status != "Fail" || ts.Cleanup.Result != "Fail" {
+		t.Fatalf("unexpected results: %s, %s, %s", ts.Cases[0].Status, ts.Cases[1].Status, ts.Cleanup.Result)
+	}
+
+	ts.Reset()
+	for _, a := range []*Action{ts.Setup, ts.Cleanup, ts.BeforeAll[0]} {
+		if a.Result != "NotTested" || a.Output != "" || a.Duration != 0 || a.ExitCode != 0 {
+			t.Errorf("action %q has not been reset: %s, %q", a.String(), a.Result, a.Output)
+		}
+	}
+	for _, tc := range ts.Cases {
+		if tc.Status != "NotTested" {
+			t.Errorf("case %q: status is %s", tc.Name, tc.Status)
+		}
+		for _, step := range tc.Steps {
+			if step.Status != "NotTested" || step.Output != "" || step.Duration != 0 ||
+				step.Action.Result != "NotTested" || step.Action.Output != "" {
+				t.Errorf("case %q, step %q has not been reset: %s", tc.Name, step.Name, step.Status)
+			}
+		}
+	}
+}
+
+func TestTestSetRerun(t *testing.T) {
+
+	tests := []struct {
+		rerun  bool
+		result TestResult
+		output string
+	}{
+		{false, "NotTested", ""},
+		{true, "Pass", "previous run"},
+	}
+	for _, tt := range tests {
+		// case setup is not executable, so only its previous result may survive the execution
+		ts := newRecordingSet("/bin/true", []string{"a"})
+		ts.Rerun = tt.rerun
+		ts.Cases[0].Setup = &Action{Result: "Pass", Output: "previous run"}
+		ts.Execute(quietDisplay())
+		if s := ts.Cases[0].Setup; s.Result != tt.result || s.Output != tt.output {
+			t.Errorf("rerun=%t: got %s, %q; want %s, %q", tt.rerun, s.Result, s.Output, tt.result, tt.output)
+		}
+		if ts.Cases[0].Status != "Pass" {
+			t.Errorf("rerun=%t: case status is %s", tt.rerun, ts.Cases[0].Status)
+		}
+	}
+}
+
+func TestTestSetExecuteWithDeadline(t *testing.T) {
+
+	rec, recorded := newRecorder(t)
+	tests := []struct {
+		name     string
+		setup    *Action
+		sleeping string
+		deadline time.Duration
+		statuses string
+		timedOut bool
+	}{
+		{"in time", nil, "", 5 * time.Second, "Pass Pass Pass", false},
+		{"case timed out", nil, "b", 300 * time.Millisecond, "Pass Fail NotTested", true},
+		{"setup timed out", CreateAction("/bin/sleep", "5"), "", 300 * time.Millisecond, "NotTested NotTested NotTested", true},
+	}
+	for _, tt := range tests {
+		ts := newRecordingSet(rec, []string{"a", "b", "c"})
+		ts.Setup, ts.Cleanup = tt.setup, CreateAction(rec, "cleanup")
+		ts.AfterAll = []*Action{CreateAction(rec, "after-all")}
+		if tt.sleeping != "" {
+			ts.Cases[1].Steps[0].Action = CreateAction("/bin/sleep", "5")
+		}
+		start, first := time.Now(), len(recorded())
+		ts.ExecuteWithDeadline(quietDisplay(), tt.deadline)
+
+		if elapsed := time.Since(start); elapsed > 3*time.Second {
+			t.Errorf("%s: execution has not been aborted in time: %s", tt.name, elapsed)
+		}
+		statuses := make([]string, 0, len(ts.Cases))
+		for _, tc := range ts.Cases {
+			statuses = append(statuses, string(tc.Status))
+		}
+		if got := strings.Join(statuses, " "); got != tt.statuses {
+			t.Errorf("%s: expected case statuses %q, got %q", tt.name, tt.statuses, got)
+		}
+		if ts.TimedOut != tt.timedOut {
+			t.Errorf("%s: expected TimedOut %t, got %t", tt.name, tt.timedOut, ts.TimedOut)
+		}
+		// after-all hooks and cleanup are executed regardless of the deadline
+		if got := recorded()[first:]; len(got) < 2 || strings.Join(got[len(got)-2:], " ") != "after-all cleanup" {
+			t.Errorf("%s: unexpected executed actions %v", tt.name, got)
+		}
+		if ts.Cleanup.Result != "Pass" {
+			t.Errorf("%s: cleanup has not passed: %s", tt.name, ts.Cleanup.Result)
+		}
+		html, err := CreateTestReport(ts).HTML()
+		if err != nil {
+			t.Fatalf("%s: HTML() failed: %s", tt.name, err)
+		}
+		if strings.Contains(html, "Deadline exceeded") != tt.timedOut {
+			t.Errorf("%s: report does not note the deadline correctly", tt.name)
+		}
+	}
+}
+
+func TestTestSetExecuteWithDeadlineCaseCleanup(t *testing.T) {
+
+	rec, recorded := newRecorder(t)
+	ts := newRecordingSet(rec, []string{"a", "b"})
+	tc := ts.Cases[0]
+	tc.Steps[0].Action = CreateAction("/bin/sleep", "5")
+	tc.Cleanup = CreateAction(rec, "case-cleanup")
+	ts.ExecuteWithDeadline(quietDisplay(), 300*time.Millisecond)
+
+	// the case cleanup is executed even though the deadline has expired during the case
+	if got := strings.Join(recorded(), " "); got != "case-cleanup" {
+		t.Errorf("expected only the case cleanup to be executed, got %q", got)
+	}
+	if tc.Cleanup.Result != "Pass" {
+		t.Errorf("expected case cleanup result %q, got %q", "Pass", tc.Cleanup.Result)
+	}
+	if !ts.TimedOut || ts.Cases[1].Status != "NotTested" {
+		t.Errorf("expected the set to time out before the second case, got %t and %q", ts.TimedOut,
+			ts.Cases[1].Status)
+	}
+}
+
+func TestTestSetXMLRoundTrip(t *testing.T) {
+
+	full := newRecordingSet("/bin/true", []string{"a", "b"})
+	full.ID, full.Description = "set-1", "Multi-line\n<description>"
+	full.Sut = CreateSUTMulti("Gateway", "Hardware", "1.0", "", "10.0.0.1", "10.0.0.2")
+	full.Sut.PingPort = 8080
+	full.Setup, full.Cleanup = CreateAction("setup.sh", "--clean"), CreateManualAction("Unplug the cable")
+	full.BeforeAll = []*Action{CreateAction("before1.sh", ""), CreateAction("before2.sh", "")}
+	full.AfterAll = []*Action{CreateAssertAction(AssertFileExists, "/etc/hosts", "")}
+	full.Cases[1].DependsOn = []string{"a"}
+	full.PingSut, full.Rerun, full.ContinueOnSetupFail, full.TimedOut = true, true, true, true
+
+	tests := []struct {
+		name string
+		set  *TestSet
+	}{
+		{"empty", CreateTestSet("Empty", "", nil, nil, nil)},
+		{"full", full},
+	}
+	for _, tt := range tests {
+		x, err := tt.set.XML()
+		if err != nil {
+			t.Fatalf("%s: XML() failed: %s", tt.name, err)
+		}
+		got := new(TestSet)
+		if err := FromXML(x, got); err != nil {
+			t.Fatalf("%s: XML cannot be decoded: %s", tt.name, err)
+		}
+		if !reflect.DeepEqual(got, tt.set) {
+			gx, _ := got.XML()
+			t.Errorf("%s: decoded test set differs:\n%s\n%s", tt.name, x, gx)
+		}
+	}
+
+	// unset flags are omitted
+	x, _ := CreateTestSet("Empty", "", nil, nil, nil).XML()
+	for _, attr := range []string{"pingSut=", "rerun=", "continueOnSetupFail="} {
+		if strings.Contains(x, attr) {
+			t.Errorf("unset attribute %s is encoded:\n%s", attr, x)
+		}
+	}
+}
+
+func TestTestSetMerge(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		these  []string
+		others []string
+		rename bool
+		want   string
+		err    bool
+	}{
+		{"clean merge", []string{"a", "b"}, []string{"c", "d"}, false, "a b c d", false},
+		{"empty set", nil, []string{"a"}, false, "a", false},
+		{"empty other", []string{"a"}, nil, false, "a", false},
+		{"duplicate", []string{"a", "b"}, []string{"c", "b"}, false, "a b", true},
+		{"renamed duplicate", []string{"a", "b"}, []string{"c", "b"}, true, "a b c b (2)", false},
+		{"next free name", []string{"a", "a (2)"}, []string{"a", "a (3)"}, true, "a a (2) a (3) a (3) (2)", false},
+		{"duplicates in other", []string{"a"}, []string{"a", "a"}, true, "a a (2) a (3)", false},
+	}
+	for _, tt := range tests {
+		ts, other := newRecordingSet("/bin/true", tt.these), newRecordingSet("/bin/true", tt.others)
+		err := ts.Merge(other, tt.rename)
+		if (err != nil) != tt.err || (err != nil && !errors.Is(err, ErrorInvalidValue)) {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		}
+		if got := strings.Join(caseNames(ts), " "); got != tt.want {
+			t.Errorf("%s: expected cases %q, got %q", tt.name, tt.want, got)
+		}
+		// the merged cases are copies, the other set is not changed
+		for ix, tc := range other.Cases {
+			if tc.Name != tt.others[ix] {
+				t.Errorf("%s: the other set has been changed: %q", tt.name, tc.Name)
+			}
+			for _, c := range ts.Cases {
+				if c == tc {
+					t.Errorf("%s: case %q has not been copied", tt.name, tc.Name)
+				}
+			}
+		}
+	}
+	if err := newRecordingSet("/bin/true", []string{"a"}).Merge(nil, false); err != nil {
+		t.Errorf("merging nil set returned %v", err)
+	}
+}
+
+func TestTestSetMergePrecedence(t *testing.T) {
+
+	ts, other := newRecordingSet("/bin/true", []string{"a"}), newRecordingSet("/bin/true", []string{"a", "b"})
+	other.Cases[1].DependsOn = []string{"a"}
+	other.Sut = CreateSUT("Other SUT", "Hardware", "1.0", "", "10.0.0.2")
+	other.Setup, other.Cleanup = CreateAction("other-setup.sh", ""), CreateAction("other-cleanup.sh", "")
+	other.BeforeAll, other.AfterAll = []*Action{CreateAction("other-before.sh", "")}, []*Action{CreateAction("other-after.sh", "")}
+	ts.Sut, ts.Cleanup = CreateSUT("SUT", "Hardware", "1.0", "", "10.0.0.1"), CreateAction("cleanup.sh", "")
+	ts.BeforeAll = []*Action{CreateAction("before.sh", "")}
+
+	if err := ts.Merge(other, true); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name, got, want string
+	}{
+		{"SUT", ts.Sut.Name, "SUT"},
+		{"setup", ts.Setup.Script, "other-setup.sh"},
+		{"cleanup", ts.Cleanup.Script, "cleanup.sh"},
+		{"before-all hooks", ts.BeforeAll[0].Script + " " + ts.BeforeAll[1].Script, "before.sh other-before.sh"},
+		{"after-all hooks", ts.AfterAll[0].Script, "other-after.sh"},
+		{"cases", strings.Join(caseNames(ts), " "), "a a (2) b"},
+		{"renamed dependency", strings.Join(ts.Cases[2].DependsOn, " "), "a (2)"},
+		{"original dependency", strings.Join(other.Cases[1].DependsOn, " "), "a"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.want, tt.got)
+		}
+	}
+	if ts.Setup == other.Setup || ts.BeforeAll[1] == other.BeforeAll[0] {
+		t.Error("actions of the other set have not been copied")
+	}
+}
+
+func TestTestSetContinueOnSetupFail(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		setup    string
+		cont     bool
+		want     string
+		statuses []TestResult
+		report   string
+	}{
+		{"setup passes", "/bin/true", false, "a b", []TestResult{"Pass", "Fail"}, ""},
+		{"setup passes, continue", "/bin/true", true, "a b", []TestResult{"Pass", "Fail"}, ""},
+		{"setup fails, stop", "/bin/false", false, "", []TestResult{"NotTested", "NotTested"},
+			"Test cases were not executed"},
+		{"setup fails, continue", "/bin/false", true, "a b", []TestResult{"Pass", "Fail"},
+			"Test cases were executed regardless"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec, recorded := newRecorder(t)
+			ts := newRecordingSet(rec, []string{"a", "b"}, "b")
+			ts.Setup, ts.ContinueOnSetupFail = CreateAction(tt.setup, ""), tt.cont
+			var buf bytes.Buffer
+			ts.Events = NewJSONLSink(&buf)
+			ts.Execute(quietDisplay())
+
+			if got := strings.Join(recorded(), " "); got != tt.want {
+				t.Errorf("expected executed cases %q, got %q", tt.want, got)
+			}
+			for ix, tc := range ts.Cases {
+				if tc.Status != tt.statuses[ix] {
+					t.Errorf("case %q: expected status %q, got %q", tc.Name, tt.statuses[ix], tc.Status)
+				}
+			}
+			failed := tt.report != ""
+			if strings.Contains(buf.String(), `"SetupFailed"`) != failed {
+				t.Errorf("unexpected events:\n%s", buf.String())
+			}
+			html, err := CreateTestReport(ts).HTML()
+			if err != nil {
+				t.Fatalf("HTML() failed: %s", err)
+			}
+			if strings.Contains(html, "Setup Failed") != failed || !strings.Contains(html, tt.report) {
+				t.Errorf("setup failure is not marked in the HTML report:\n%s", html)
+			}
+		})
+	}
+}
+
+func TestTestSetTopologyRoundTrip(t *testing.T) {
+
+	// create a test set using a two-device topology: a router connected to a server
+	newSet := func() *TestSet {
+		topo := NewTopology()
+		router, srv := NewGenericDevice("router", DevRouter), NewServer("srv")
+		srv.URI = "http://srv"
+		topo.AddLink(router, srv, nil, nil)
+		ts := newReportSet(CreateTestStep("Ping", "", "Pass", "NotTested", CreateAction("/bin/true", "")))
+		ts.Sut = CreateSUT("SUT", "Software", "1.0", "", "10.0.0.1")
+		ts.Topology = topo
+		ts.Cases[0].Steps[0].Device = "srv"
+		return ts
+	}
+	tests := []struct {
+		name string
+		enc  func(ts *TestSet) (string, error)
+		dec  func(text string, ts *TestSet) error
+	}{
+		{"XML", (*TestSet).XML, func(text string, ts *TestSet) error { return FromXML(text, ts) }},
+		{"JSON", (*TestSet).JSON, func(text string, ts *TestSet) error { return json.Unmarshal([]byte(text), ts) }},
+	}
+	for _, tt := range tests {
+		ts := newSet()
+		text, err := tt.enc(ts)
+		if err != nil {
+			t.Fatalf("%s: encoding failed: %s", tt.name, err)
+		}
+		got := new(TestSet)
+		if err := tt.dec(text, got); err != nil {
+			t.Fatalf("%s: decoding failed: %s", tt.name, err)
+		}
+		if got.Topology == nil || !reflect.DeepEqual(got.Topology.Devices, ts.Topology.Devices) {
+			t.Fatalf("%s: expected topology %v, got %v", tt.name, ts.Topology, got.Topology)
+		}
+		if len(got.Topology.Links) != 1 || got.Topology.Links[0].String() != ts.Topology.Links[0].String() {
+			t.Errorf("%s: expected links %v, got %v", tt.name, ts.Topology.Links, got.Topology.Links)
+		}
+		if got.Sut == nil || got.Sut.Name != "SUT" || got.Sut.IPaddr != "10.0.0.1" {
+			t.Errorf("%s: SUT is lost: %v", tt.name, got.Sut)
+		}
+		if d, ok := got.FindDevice(got.Cases[0].Steps[0].Device); !ok || d.DeviceName() != "srv" {
+			t.Errorf("%s: step device is not found in the topology", tt.name)
+		}
+		if errs := got.Validate(); len(errs) != 0 {
+			t.Errorf("%s: decoded test set is not valid: %v", tt.name, errs)
+		}
+	}
+
+	// without topology, the element is omitted and the single SUT still works
+	ts := newReportSet(CreateTestStep("Step", "", "Pass", "NotTested", CreateAction("/bin/true", "")))
+	ts.Sut = CreateSUT("SUT", "Software", "1.0", "", "10.0.0.1")
+	x, _ := ts.XML()
+	j, _ := ts.JSON()
+	if strings.Contains(x, "Topology") || strings.Contains(j, "Topology") {
+		t.Errorf("empty topology is encoded:\n%s\n%s", x, j)
+	}
+	if _, ok := ts.FindDevice("srv"); ok {
+		t.Error("device found without topology")
+	}
+}
+
+func TestTestSetTopologyHTML(t *testing.T) {
+
+	ts := newReportSet(CreateTestStep("Ping", "", "Pass", "NotTested", CreateAction("/bin/true", "")))
+	html, _ := CreateTestReport(ts).HTML()
+	if strings.Contains(html, "<th>Device</th>") {
+		t.Errorf("devices table rendered without topology:\n%s", html)
+	}
+
+	topo := NewTopology()
+	router, srv := NewGenericDevice("router", DevRouter), NewServer("srv")
+	topo.AddLink(router, srv, nil, nil)
+	ts.Topology = topo
+	html, _ = CreateTestReport(ts).HTML()
+	for _, want := range []string{
+		"<tr><th>Device</th><th>Type</th><th>Management</th><th>Links</th></tr>",
+		fmt.Sprintf("<tr><td>router</td><td>%s</td><td></td><td>srv</td></tr>", router.Type()),
+		fmt.Sprintf("<tr><td>srv</td><td>%s</td><td></td><td>router</td></tr>", srv.Type()),
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("expected %q in the HTML report:\n%s", want, html)
+		}
+	}
+
+	// device data is escaped
+	topo = NewTopology()
+	router, srv = NewGenericDevice("<router>", DevRouter), NewServer("srv&1")
+	router.Management = []string{"<10.0.0.1>", "mgmt&2"}
+	topo.AddLink(router, srv, nil, nil)
+	ts.Topology = topo
+	html, _ = CreateTestReport(ts).HTML()
+	for _, want := range []string{
+		fmt.Sprintf("<tr><td>&lt;router&gt;</td><td>%s</td><td>&lt;10.0.0.1&gt;<br />mgmt&amp;2</td><td>srv&amp;1</td></tr>",
+			router.Type()),
+		fmt.Sprintf("<tr><td>srv&amp;1</td><td>%s</td><td></td><td>&lt;router&gt;</td></tr>", srv.Type()),
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("expected %q in the HTML report:\n%s", want, html)
+		}
+	}
+}
@@ -13,25 +13,89 @@ package atf
  */
 
 import (
+	"context"
 	"encoding/json"
 	"encoding/xml"
+	"errors"
 	"fmt"
+	"github.com/mraitmaier/atf/utils"
+	"html"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
 )
 
+// errStepTimeout is the cause of the step's context cancellation when the step's own timeout expires.
+var errStepTimeout = errors.New("step timeout expired")
+
 // TestStep represents a single test step (action with additional data).
 type TestStep struct {
 
 	/* Name of the test step; in XML, this is an attribute */
-	Name string `xml:"name,attr"`
+	Name string `xml:"name,attr" yaml:"name"`
 
 	/* Expected is an expected status of the step; in XML, this is an attribute */
-	Expected TestResult `xml:"expected,attr"`
+	Expected TestResult `xml:"expected,attr" yaml:"expected"`
 
 	/* Status is a status of the step; in XML, this is an attribute */
-	Status TestResult `xml:"status,attr"`
+	Status TestResult `xml:"status,attr" yaml:"status"`
 
 	/* Action, every test step needs an action: either manual or executable */
-	Action *Action `xml:"Action"`
+	Action *Action `xml:"Action" yaml:"action"`
+
+	// Artifacts is a list of files (logs, screenshots, captures...) produced by the step, linked from the report
+	Artifacts []string `xml:"Artifacts>Artifact,omitempty" json:",omitempty" yaml:"artifacts,omitempty"`
+
+	// Collected is a list of the artifacts' copies in the artifact directory (see ExecOptions.ArtifactDir), made by the
+	// last execution of the step
+	Collected []string `xml:"Collected>Artifact,omitempty" json:",omitempty" yaml:"collected,omitempty"`
+
+	// Timeout limits the duration of the step action (no limit when zero): the step that times out is evaluated to Error,
+	// regardless of its expected status. In XML, this is an attribute
+	Timeout Duration `xml:"timeout,attr,omitempty" json:",omitempty" yaml:"timeout,omitempty"`
+
+	// Device is a name of the topology device the step is performed on (if any); in XML, this is an attribute
+	Device string `xml:"device,attr,omitempty" json:",omitempty" yaml:"device,omitempty"`
+
+	// Output is the output captured during the step execution: action output, manual action description and notes
+	Output string `xml:",omitempty" json:",omitempty" yaml:"output,omitempty"`
+
+	// Duration is the time spent executing the step
+	Duration Duration `xml:",omitempty" json:",omitempty" yaml:"duration,omitempty"`
+
+	// events is an optional sink receiving the execution events; set and tcase are the names of the parents
+	events EventSink
+	set    string
+	tcase  string
+
+	// ctx is an optional context of the parent execution; action is aborted when it's done
+	ctx context.Context
+
+	// opts are the execution options given by the parent execution
+	opts ExecOptions
+}
+
+// Duration is a time.Duration that is encoded as a duration string (e.g. "1m30s") in configs; see time.ParseDuration().
+type Duration time.Duration
+
+// String returns a human-readable representation of the Duration value.
+func (d Duration) String() string { return time.Duration(d).String() }
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (d Duration) MarshalText() ([]byte, error) { return []byte(d.String()), nil }
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface; invalid duration string is reported as
+// ErrorConfigSyntax.
+func (d *Duration) UnmarshalText(text []byte) error {
+
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrorConfigSyntax, err)
+	}
+	*d = Duration(v)
+	return nil
 }
 
 // String returns a human-readable representation of the TestStep instance.
@@ -53,6 +117,9 @@ func (ts *TestStep) Display() string {
 	txt := fmt.Sprintf("TestStep: %q\n", ts.Name)
 	txt += fmt.Sprintf("Expected status: %q\n", ts.Expected)
 	txt += fmt.Sprintf("Status: %q\n", ts.Status)
+	if ts.Device != "" {
+		txt += fmt.Sprintf("Device: %q\n", ts.Device)
+	}
 	if ts.Action != nil {
 		txt += fmt.Sprintf("Action: %q\n", ts.Action.String())
 	} else {
@@ -62,11 +129,15 @@ func (ts *TestStep) Display() string {
 }
 
 // XML returns an XML-encoded represenation of the TestStep instance.
-func (ts *TestStep) XML() (string, error) {
+func (ts *TestStep) XML() (string, error) { return ts.XMLIndent(DefaultXMLPrefix, DefaultXMLIndent) }
+
+// XMLIndent returns the same representation as XML(), but every line begins with the given prefix and is indented
+// with one or more copies of the given indent.
+func (ts *TestStep) XMLIndent(prefix, indent string) (string, error) {
 
-	output, err := xml.MarshalIndent(ts, "", "  ")
+	output, err := xml.MarshalIndent(ts, prefix, indent)
 	if err != nil {
-		return "", nil
+		return "", err
 	}
 
 	return string(output), nil
@@ -82,10 +153,37 @@ func (ts *TestStep) JSON() (string, error) {
 	return string(b[:]), err
 }
 
-// HTML returns a HTML-encoded represenation of the TestStep instance.
+// HTML returns a HTML-encoded represenation of the TestStep instance: a single table row.
 func (ts *TestStep) HTML() (string, error) {
-	// TODO
-	return "", nil
+
+	act := "none"
+	if ts.Action != nil {
+		act = html.EscapeString(ts.Action.String())
+	}
+	if ts.Device != "" {
+		act += fmt.Sprintf("<br />Device: %s", html.EscapeString(ts.Device))
+	}
+	// the collected copies are linked, when the artifacts have been collected
+	artifacts := ts.Artifacts
+	if len(ts.Collected) > 0 {
+		artifacts = ts.Collected
+	}
+	for _, a := range artifacts {
+		act += "<br />" + artifactLink(a)
+	}
+	name := html.EscapeString(ts.Name)
+	html := fmt.Sprintf("<tr><td>%s</td>", name)
+	html += fmt.Sprintf("<td>%s</td><td>%s</td>", act, ts.Expected)
+	// let's see if step has passed and set the HTML class accordingly
+	html += fmt.Sprintf("<td class=%q>%s</td></tr>\n", resolveHTMLClass(ts), ts.Status)
+	return html, nil
+}
+
+// Private function that returns the HTML link to the given artifact file: the path is URL-escaped and the file name is
+// HTML-escaped, so any file name is rendered safely.
+func artifactLink(pth string) string {
+	href := (&url.URL{Path: filepath.ToSlash(pth)}).String()
+	return fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(href), html.EscapeString(filepath.Base(pth)))
 }
 
 // Initialize initializes the test step.
@@ -102,7 +200,7 @@ func (ts *TestStep) Initialize() {
 	ts.Status = "NotTested"
 
 	// if expected status is empty for executable action, force "Pass"
-	if ts.Action.Executable && ts.Expected == "" {
+	if ts.Action.IsExecutable() && ts.Expected == "" {
 		ts.Expected = "Pass"
 	}
 }
@@ -115,25 +213,53 @@ func (ts *TestStep) Execute(display *ExecDisplayFnCback) {
 
 	// and start the execution
 	disp("info", fmt.Sprintf(">>> Entering test step %q\n", ts.Name))
+	start := time.Now()
+	ts.Output = ""
+	emit(ts.events, Event{Type: StepStarted, Set: ts.set, Case: ts.tcase, Step: ts.Name})
+
+	// the action is aborted when the step timeout expires; the cause tells it apart from the expired set deadline
+	ctx := orBackground(ts.ctx)
+	if ts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, time.Duration(ts.Timeout), errStepTimeout)
+		defer cancel()
+	}
 
 	// we execute the action when it's not empty
-	if ts.Action != nil && ts.Action.Executable {
+	if ts.Action.IsExecutable() {
 		disp("notice", fmt.Sprintf("Executing test step action: %q\n",
 			ts.Action.String()))
-		disp("info", FmtOutput(ts.Action.Execute()))
+		if ts.Device != "" {
+			disp("info", fmt.Sprintf("Test step is performed on device %q\n", ts.Device))
+		}
+		ts.Output = ts.Action.ExecuteWithOptions(ctx, ts.opts)
+		disp("info", ts.opts.formatOutput(ts.Output))
+	} else if ts.Action.IsManual() && ts.opts.ManualPrompt != nil {
+		// manual action is performed by the operator, who is expected to make it pass
+		disp("notice", fmt.Sprintf("Prompting for manual action: %q\n", ts.Action.String()))
+		ts.Output = ts.Action.ExecuteWithOptions(ctx, ts.opts)
+		if ts.Expected == "" {
+			ts.Expected = "Pass"
+		}
+		disp("notice", fmt.Sprintf("Manual action evaluated to %q by operator\n", ts.Action.Result))
 	} else {
+		// manual action without the operator only carries its description
+		ts.Output = ts.Action.Description
 		disp("error", fmt.Sprintln("Action is EMPTY?????"))
 	}
 
 	// let's evaluate expectations and final status of the step
-	switch ts.Expected {
-	case "Pass":
+	switch {
+	case ts.Action.Result == "Error":
+		// action that could not be executed is an error, regardless of the expected status
+		ts.Status = "Error"
+	case ts.Expected == "Pass":
 		if ts.Action.Result == "Pass" {
 			ts.Status = "Pass"
 		} else {
 			ts.Status = "Fail"
 		}
-	case "XFail":
+	case ts.Expected == "XFail":
 		if ts.Action.Result == "Pass" {
 			ts.Status = "Fail"
 		} else {
@@ -143,11 +269,93 @@ func (ts *TestStep) Execute(display *ExecDisplayFnCback) {
 		//only Pass & XFail are allowed as expected status
 		ts.Status = "NotTested"
 	}
+	// timed-out step is always an error, regardless of the expected status
+	if ts.Timeout > 0 && context.Cause(ctx) == errStepTimeout && ts.Action.IsExecutable() {
+		note := fmt.Sprintf("Step timed out after %s\n", ts.Timeout)
+		ts.Output += note
+		disp("error", note)
+		ts.Status = "Error"
+	}
+	ts.collectArtifacts(disp)
+	ts.Duration = Duration(time.Since(start))
 	disp("notice", fmt.Sprintf("Test step evaluated to %q\n", ts.Status))
+	emit(ts.events, Event{Type: StepFinished, Set: ts.set, Case: ts.tcase, Step: ts.Name, Status: ts.Status,
+		Duration: time.Duration(ts.Duration)})
 	disp("info", fmt.Sprintf("<<< Leaving test step %q\n", ts.Name))
 }
 
+// Check the artifacts produced by the step and copy them into the artifact directory (when defined by the options); the
+// copies are listed in Collected, while Artifacts are left as configured. Missing artifacts are only reported.
+func (ts *TestStep) collectArtifacts(disp ExecDisplayFnCback) {
+
+	ts.Collected = nil
+	for _, a := range ts.Artifacts {
+		if !utils.FileExists(a) {
+			disp("warning", fmt.Sprintf("Artifact %q has not been found\n", a))
+			continue
+		}
+		if ts.opts.ArtifactDir == "" {
+			continue
+		}
+		dir := filepath.Join(ts.opts.ArtifactDir, pathComponent(ts.tcase), pathComponent(ts.Name))
+		dst := filepath.Join(dir, pathComponent(filepath.Base(a)))
+		if dst == filepath.Clean(a) {
+			ts.Collected = append(ts.Collected, dst) // already in place
+			continue
+		}
+		// artifacts must never be copied outside the artifact directory
+		if rel, err := filepath.Rel(ts.opts.ArtifactDir, dst); err != nil || rel == ".." ||
+			strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			disp("warning", fmt.Sprintf("Artifact %q cannot be collected: invalid destination %q\n", a, dst))
+			continue
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			disp("warning", fmt.Sprintf("Artifact %q cannot be collected: %s\n", a, err))
+			continue
+		}
+		if _, err := utils.CopyFile(dst, a); err != nil {
+			disp("warning", fmt.Sprintf("Artifact %q cannot be collected: %s\n", a, err))
+			continue
+		}
+		ts.Collected = append(ts.Collected, dst)
+	}
+}
+
+// Convert the name into a single path component: path separators are replaced and the empty name and the dot names are
+// replaced with '_'.
+func pathComponent(name string) string {
+
+	name = strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == 0 {
+			return '_'
+		}
+		return r
+	}, name)
+	switch name {
+	case "", ".", "..":
+		return "_"
+	}
+	return name
+}
+
+// Clone returns a deep copy of the test step; nil is returned for nil step.
+func (ts *TestStep) Clone() *TestStep {
+
+	if ts == nil {
+		return nil
+	}
+	c := &TestStep{Name: ts.Name, Expected: ts.Expected, Status: ts.Status, Action: ts.Action.Clone(), Timeout: ts.Timeout,
+		Device: ts.Device, Output: ts.Output, Duration: ts.Duration}
+	if ts.Artifacts != nil {
+		c.Artifacts = append([]string{}, ts.Artifacts...)
+	}
+	if ts.Collected != nil {
+		c.Collected = append([]string{}, ts.Collected...)
+	}
+	return c
+}
+
 // CreateTestStep creates a new TestStep instance with given data.
 func CreateTestStep(name string, descr string, expected TestResult, status TestResult, act *Action) *TestStep {
-	return &TestStep{name, expected, status, act}
+	return &TestStep{Name: name, Expected: expected, Status: status, Action: act}
 }
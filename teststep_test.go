@@ -0,0 +1,403 @@
+package atf
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTestStepXMLRoundTrip(t *testing.T) {
+
+	executed := CreateTestStep("Step <&>", "", "XFail", "Pass", CreateAction("check.py", "-v"))
+	executed.Action.Result, executed.Action.Output, executed.Action.ExitCode = "Fail", "error\n", 1
+	executed.Artifacts, executed.Device, executed.Output = []string{"capture.pcap", "log.txt"}, "switch", "error\n"
+	executed.Timeout, executed.Duration = Duration(90*time.Second), Duration(1200*time.Millisecond)
+
+	tests := []struct {
+		name string
+		step *TestStep
+	}{
+		{"script", CreateTestStep("Step", "", "Pass", "NotTested", CreateAction("/bin/true", ""))},
+		{"executed", executed},
+		{"manual", CreateTestStep("Manual", "", "Pass", "NotTested", CreateManualAction("Press the button"))},
+		{"assertion", CreateTestStep("Assert", "", "Pass", "Pass", CreateAssertAction(AssertEquals, "1", "1"))},
+		{"no action", CreateTestStep("Empty", "", "Pass", "NotTested", nil)},
+	}
+	for _, tt := range tests {
+		x, err := tt.step.XML()
+		if err != nil {
+			t.Fatalf("%s: XML() failed: %s", tt.name, err)
+		}
+		got := new(TestStep)
+		if err := FromXML(x, got); err != nil {
+			t.Fatalf("%s: XML cannot be decoded: %s", tt.name, err)
+		}
+		if !reflect.DeepEqual(got, tt.step) {
+			gx, _ := got.XML()
+			t.Errorf("%s: decoded test step differs:\n%s\n%s", tt.name, x, gx)
+		}
+	}
+}
+
+func TestTestStepArtifacts(t *testing.T) {
+
+	src := t.TempDir()
+	for _, name := range []string{"out.log", "a b&c.pcap"} {
+		if err := os.WriteFile(filepath.Join(src, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		name     string
+		artifact string
+		collect  bool
+		want     string // expected collected artifact path, relative to the artifact dir (when collected)
+		link     string // expected HTML link
+		warning  bool
+	}{
+		{"linked in place", "out.log", false, "", `<a href="SRC/out.log">out.log</a>`, false},
+		{"collected", "out.log", true, "Case, the first/Step/out.log",
+			`<a href="DST/Case,%20the%20first/Step/out.log">out.log</a>`, false},
+		{"escaped name", "a b&c.pcap", false, "", `<a href="SRC/a%20b&amp;c.pcap">a b&amp;c.pcap</a>`, false},
+		{"missing", "missing.txt", true, "", `<a href="SRC/missing.txt">missing.txt</a>`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dst := t.TempDir()
+			step := CreateTestStep("Step", "", "Pass", "NotTested", CreateAction("/bin/true", ""))
+			step.Artifacts = []string{filepath.Join(src, tt.artifact)}
+			ts := newReportSet(step)
+
+			var warnings []string
+			var disp ExecDisplayFnCback = func(args ...string) {
+				if len(args) > 1 && args[0] == "warning" {
+					warnings = append(warnings, args[1])
+				}
+			}
+			opts := ExecOptions{}
+			if tt.collect {
+				opts.ArtifactDir = dst
+			}
+			ts.ExecuteWithOptions(&disp, opts)
+
+			// the configured artifacts are never modified
+			artifact := filepath.Join(src, tt.artifact)
+			if got := ts.Cases[0].Steps[0].Artifacts; len(got) != 1 || got[0] != artifact {
+				t.Fatalf("expected artifact %q, got %q", artifact, got)
+			}
+			want := ""
+			if tt.want != "" {
+				want = filepath.Join(dst, tt.want)
+				if got := ts.Cases[0].Steps[0].Collected; len(got) != 1 || got[0] != want {
+					t.Fatalf("expected collected artifact %q, got %q", want, got)
+				}
+				if b, err := os.ReadFile(want); err != nil || string(b) != tt.artifact {
+					t.Errorf("artifact has not been collected: %q (%v)", b, err)
+				}
+			} else if got := ts.Cases[0].Steps[0].Collected; len(got) != 0 {
+				t.Errorf("unexpected collected artifacts %q", got)
+			}
+			if (len(warnings) > 0) != tt.warning {
+				t.Errorf("unexpected warnings: %q", warnings)
+			}
+
+			html, err := CreateTestReport(ts).HTML()
+			if err != nil {
+				t.Fatalf("HTML() failed: %s", err)
+			}
+			link := strings.NewReplacer("SRC", filepath.ToSlash(src), "DST", filepath.ToSlash(dst)).Replace(tt.link)
+			if !strings.Contains(html, link) {
+				t.Errorf("artifact link %s is missing from the HTML report:\n%s", link, html)
+			}
+			j, err := ts.Cases[0].Steps[0].JSON()
+			if err != nil {
+				t.Fatalf("JSON() failed: %s", err)
+			}
+			b, _ := json.Marshal(artifact)
+			if !strings.Contains(j, `"Artifacts":[`+string(b)+`]`) {
+				t.Errorf("artifact path is missing from JSON:\n%s", j)
+			}
+			b, _ = json.Marshal(want)
+			if want != "" && !strings.Contains(j, `"Collected":[`+string(b)+`]`) {
+				t.Errorf("collected artifact path is missing from JSON:\n%s", j)
+			}
+		})
+	}
+}
+
+func TestTestStepArtifactsRerun(t *testing.T) {
+
+	src, dst := t.TempDir(), t.TempDir()
+	artifact := filepath.Join(src, "out.log")
+	if err := os.WriteFile(artifact, []byte("out"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	step := CreateTestStep("Step", "", "Pass", "NotTested", CreateAction("/bin/true", ""))
+	step.Artifacts = []string{artifact}
+	ts := newReportSet(step)
+	ts.ExecuteWithOptions(quietDisplay(), ExecOptions{ArtifactDir: dst})
+	if len(step.Collected) != 1 {
+		t.Fatalf("artifact has not been collected: %q", step.Collected)
+	}
+	ts.Reset()
+	if step.Collected != nil {
+		t.Errorf("reset step keeps collected artifacts %q", step.Collected)
+	}
+
+	// the step doesn't produce the artifact anymore: the copy from the previous run is not reported
+	if err := os.Remove(artifact); err != nil {
+		t.Fatal(err)
+	}
+	var warnings []string
+	var disp ExecDisplayFnCback = func(args ...string) {
+		if len(args) > 1 && args[0] == "warning" {
+			warnings = append(warnings, args[1])
+		}
+	}
+	ts.ExecuteWithOptions(&disp, ExecOptions{ArtifactDir: dst})
+	if len(step.Collected) != 0 || len(warnings) != 1 || !reflect.DeepEqual(step.Artifacts, []string{artifact}) {
+		t.Errorf("stale artifact reported: artifacts %q, collected %q, warnings %q", step.Artifacts, step.Collected,
+			warnings)
+	}
+}
+
+func TestTestStepArtifactsPath(t *testing.T) {
+
+	src := t.TempDir()
+	if err := os.WriteFile(filepath.Join(src, "out.log"), []byte("out"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		tcase string
+		step  string
+		want  string // expected artifact path, relative to the artifact dir
+	}{
+		{"../../outside", "Step", ".._.._outside/Step/out.log"},
+		{"a/b", "..", "a_b/_/out.log"},
+		{"..", "../..", "_/.._../out.log"},
+		{"Case", "", "Case/_/out.log"},
+		{".", "a\\b", "_/a_b/out.log"},
+	}
+	for _, tt := range tests {
+		root := t.TempDir()
+		dst := filepath.Join(root, "artifacts", "run")
+		step := CreateTestStep(tt.step, "", "Pass", "NotTested", CreateAction("/bin/true", ""))
+		step.Artifacts = []string{filepath.Join(src, "out.log")}
+		ts := newReportSet(step)
+		ts.Cases[0].Name = tt.tcase
+
+		var disp ExecDisplayFnCback = func(args ...string) {}
+		ts.ExecuteWithOptions(&disp, ExecOptions{ArtifactDir: dst})
+
+		want := filepath.Join(dst, tt.want)
+		if got := ts.Cases[0].Steps[0].Collected; len(got) != 1 || got[0] != want {
+			t.Errorf("%q/%q: expected artifact %q, got %q", tt.tcase, tt.step, want, got)
+		}
+		// nothing is written outside the artifact directory
+		entries, err := os.ReadDir(root)
+		if err != nil || len(entries) != 1 || entries[0].Name() != "artifacts" {
+			t.Errorf("%q/%q: unexpected files outside the artifact directory: %v (%v)", tt.tcase, tt.step, entries, err)
+		}
+	}
+}
+
+func TestTestStepTimeout(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		timeout  Duration
+		expected TestResult
+		status   TestResult
+		note     bool
+	}{
+		{"no timeout", 0, "Pass", "Pass", false},
+		{"long enough", Duration(5 * time.Second), "Pass", "Pass", false},
+		{"timed out", Duration(100 * time.Millisecond), "Pass", "Error", true},
+		{"timed out, expected failure", Duration(100 * time.Millisecond), "XFail", "Error", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sleep := "0.3"
+			if tt.note {
+				sleep = "5"
+			}
+			step := CreateTestStep("Sleep", "", tt.expected, "NotTested", CreateAction("/bin/sleep", sleep))
+			step.Timeout = tt.timeout
+			start := time.Now()
+			step.Execute(quietDisplay())
+			if step.Status != tt.status {
+				t.Errorf("expected status %q, got %q", tt.status, step.Status)
+			}
+			if note := "timed out after " + tt.timeout.String(); strings.Contains(step.Output, note) != tt.note {
+				t.Errorf("unexpected output: %q", step.Output)
+			}
+			if tt.note && time.Since(start) > 3*time.Second {
+				t.Errorf("step has not been aborted: %s", time.Since(start))
+			}
+		})
+	}
+}
+
+func TestTestStepTimeoutSetDeadline(t *testing.T) {
+
+	// the set deadline expires before the step's own timeout: the step has not timed out itself
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	step := CreateTestStep("Sleep", "", "Pass", "NotTested", CreateAction("/bin/sleep", "5"))
+	step.Timeout, step.ctx = Duration(3*time.Second), ctx
+	start := time.Now()
+	step.Execute(quietDisplay())
+	if time.Since(start) > 2*time.Second {
+		t.Errorf("step has not been aborted by the set deadline: %s", time.Since(start))
+	}
+	if strings.Contains(step.Output, "timed out after") {
+		t.Errorf("step has been reported as timed out: %q", step.Output)
+	}
+}
+
+func TestTestStepTimeoutConfig(t *testing.T) {
+
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		text    string
+		timeout Duration
+		err     error
+	}{
+		{"set.yaml", "name: S\ncases:\n  - name: C\n    steps:\n      - name: s\n        timeout: 1m30s\n" +
+			"        action: {script: /bin/true}\n", Duration(90 * time.Second), nil},
+		{"set.json", `{"Name": "S", "Cases": [{"Name": "C", "Steps": [{"Name": "s", "Timeout": "250ms", ` +
+			`"Action": {"Script": "/bin/true"}}]}]}`, Duration(250 * time.Millisecond), nil},
+		{"set.xml", `<TestSet name="S"><Cases><TestCase name="C"><Steps><TestStep name="s" timeout="2s">` +
+			`<Action><Script>/bin/true</Script></Action></TestStep></Steps></TestCase></Cases></TestSet>`,
+			Duration(2 * time.Second), nil},
+		{"none.json", `{"Name": "S", "Cases": [{"Name": "C", "Steps": [{"Name": "s", ` +
+			`"Action": {"Script": "/bin/true"}}]}]}`, 0, nil},
+		{"bad.json", `{"Name": "S", "Cases": [{"Name": "C", "Steps": [{"Name": "s", "Timeout": "soon", ` +
+			`"Action": {"Script": "/bin/true"}}]}]}`, 0, ErrorConfigSyntax},
+	}
+	for _, tt := range tests {
+		ts, err := Collect(writeConfig(t, dir, tt.name, tt.text))
+		if tt.err != nil {
+			if !errors.Is(err, tt.err) {
+				t.Errorf("%s: expected %v, got %v", tt.name, tt.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		if got := ts.Cases[0].Steps[0].Timeout; got != tt.timeout {
+			t.Errorf("%s: expected timeout %s, got %s", tt.name, tt.timeout, got)
+		}
+	}
+}
+
+func TestTestStepErrorVsFail(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		expected TestResult
+		action   *Action
+		timeout  Duration
+		status   TestResult
+		class    string
+		tcase    TestResult // the step that could not be executed fails the case, regardless of the expected status
+	}{
+		{"failing", "Pass", CreateAction("/bin/false", ""), 0, "Fail", "failed", "Fail"},
+		{"expected failure", "XFail", CreateAction("/bin/false", ""), 0, "Pass", "passed", "Pass"},
+		{"missing interpreter", "Pass", CreateAction("test.ixiatcl", ""), 0, "Error", "errored", "Fail"},
+		{"missing interpreter, expected failure", "XFail", CreateAction("test.ixiatcl", ""), 0, "Error", "errored",
+			"Fail"},
+		{"timed out", "Pass", CreateAction("/bin/sleep", "5"), Duration(100 * time.Millisecond), "Error", "errored",
+			"Fail"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step := CreateTestStep("Step", "", tt.expected, "NotTested", tt.action)
+			step.Timeout = tt.timeout
+			ts := newReportSet(step)
+			ts.ExecuteWithOptions(quietDisplay(), ExecOptions{IxiaTclExec: "bogus-ixia-tclsh"})
+
+			if step.Status != tt.status {
+				t.Errorf("expected step status %q, got %q", tt.status, step.Status)
+			}
+			if tt.status == "Error" && (step.Action.Result != "Error" || !strings.Contains(step.Output, "Execution error")) {
+				t.Errorf("expected an execution error, got %q: %q", step.Action.Result, step.Output)
+			}
+			if tc := ts.Cases[0]; tc.Status != tt.tcase {
+				t.Errorf("expected case status %q, got %q", tt.tcase, tc.Status)
+			}
+			html, err := step.HTML()
+			if err != nil {
+				t.Fatalf("HTML() failed: %s", err)
+			}
+			if cell := `<td class="` + tt.class + `">` + string(tt.status) + `</td>`; !strings.Contains(html, cell) {
+				t.Errorf("expected %s in HTML:\n%s", cell, html)
+			}
+		})
+	}
+}
+
+func TestTestStepOutput(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		action  *Action
+		timeout Duration
+		output  []string // expected parts of the step output; empty output when not defined
+	}{
+		{"script", CreateAction("/bin/echo", "hello"), 0, []string{"hello\n"}},
+		{"silent script", CreateAction("/bin/true", ""), 0, nil},
+		{"assertion", CreateAssertAction(AssertEquals, "1", "1"), 0, []string{"Assertion passed"}},
+		{"manual", CreateManualAction("Press the button"), 0, []string{"Press the button"}},
+		{"timed out", CreateAction("/bin/sleep", "5"), Duration(100 * time.Millisecond),
+			[]string{"Execution error", "Step timed out after 100ms\n"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step := CreateTestStep("Step", "", "Pass", "NotTested", tt.action)
+			step.Timeout, step.Output = tt.timeout, "stale output"
+			ts := newReportSet(step)
+			ts.Execute(quietDisplay())
+
+			if len(tt.output) == 0 && step.Output != "" {
+				t.Errorf("expected empty step output, got %q", step.Output)
+			}
+			for _, part := range tt.output {
+				if !strings.Contains(step.Output, part) {
+					t.Errorf("expected %q in step output, got %q", part, step.Output)
+				}
+			}
+			if step.Duration <= 0 || step.Duration < step.Action.Duration {
+				t.Errorf("expected step duration, got %s (action: %s)", step.Duration, step.Action.Duration)
+			}
+
+			text, err := CreateTestReport(ts).CSV()
+			if err != nil {
+				t.Fatalf("CSV() failed: %s", err)
+			}
+			records, err := csv.NewReader(strings.NewReader(text)).ReadAll()
+			if err != nil || len(records) != 2 {
+				t.Fatalf("invalid CSV (%v):\n%s", err, text)
+			}
+			want := []string{step.Duration.String(), strings.SplitN(step.Output, "\n", 2)[0]}
+			if got := []string{records[1][5], records[1][7]}; !reflect.DeepEqual(got, want) {
+				t.Errorf("expected step duration and output %q in CSV, got %q", want, got)
+			}
+
+			ts.Reset()
+			if step.Output != "" || step.Duration != 0 {
+				t.Errorf("reset step keeps output %q and duration %s", step.Output, step.Duration)
+			}
+		})
+	}
+}
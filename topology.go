@@ -3,6 +3,8 @@ package atf
 /*
  * topology.go - file defining Topology struct and its methods
  *
+ * Topology is a list of systems under test and devices, together with the
+ * links that connect the devices.
  */
 
 import (
@@ -11,36 +13,330 @@ import (
 	"fmt"
 )
 
-// Topology represents a list of SystemUnderTest instances.
-type Topology []*SysUnderTest
+// Link represents a connection between two devices: both endpoints are defined by a device and (optionally) its port.
+type Link struct {
+
+	// A is the first endpoint device
+	A Device
+
+	// PortA is the port of the first endpoint device
+	PortA *Port
+
+	// B is the second endpoint device
+	B Device
+
+	// PortB is the port of the second endpoint device
+	PortB *Port
+}
+
+// String returns a human-readable representation of the Link instance.
+func (l *Link) String() string {
+	txt := l.A.DeviceName()
+	if l.PortA != nil {
+		txt += ":" + l.PortA.Name
+	}
+	txt += " <-> " + l.B.DeviceName()
+	if l.PortB != nil {
+		txt += ":" + l.PortB.Name
+	}
+	return txt
+}
+
+// Return the port name; empty string when port is not defined.
+func portName(p *Port) string {
+	if p == nil {
+		return ""
+	}
+	return p.Name
+}
+
+// Topology represents a list of SystemUnderTest instances and devices, connected with links.
+type Topology struct {
+
+	// Suts is a list of systems under test
+	Suts []*SysUnderTest
+
+	// Devices is a list of devices
+	Devices []Device
+
+	// Links is a list of connections between devices
+	Links []*Link
+}
 
 // NewTopology returns new empty instance of Topology.
-func NewTopology() []*SysUnderTest { return make([]*SysUnderTest, 0) }
+func NewTopology() *Topology {
+	return &Topology{Suts: make([]*SysUnderTest, 0), Devices: make([]Device, 0), Links: make([]*Link, 0)}
+}
 
-// String returns a human-readable representation of the SUT instance.
-func (t Topology) String() string {
+// String returns a human-readable representation of the Topology instance.
+func (t *Topology) String() string {
 
 	txt := "TOPOLOGY\n"
-    for _, s := range t {
-        txt += fmt.Sprintf("%s\n%s", s.String())
-    }
+	for _, s := range t.Suts {
+		txt += fmt.Sprintf("%s\n", s.String())
+	}
+	for _, d := range t.Devices {
+		txt += fmt.Sprintf("%s\n", d.String())
+	}
+	for _, l := range t.Links {
+		txt += fmt.Sprintf("Link: %s\n", l.String())
+	}
 	return txt
 }
 
+// AddDevice adds a device to the topology; devices already in the topology are not added again.
+func (t *Topology) AddDevice(d Device) {
+	for _, dev := range t.Devices {
+		if dev == d {
+			return
+		}
+	}
+	t.Devices = append(t.Devices, d)
+}
+
+// AddLink connects two devices (using given ports) and returns the new link. Devices not yet in the topology are added.
+func (t *Topology) AddLink(a, b Device, portA, portB *Port) *Link {
+	t.AddDevice(a)
+	t.AddDevice(b)
+	l := &Link{A: a, PortA: portA, B: b, PortB: portB}
+	t.Links = append(t.Links, l)
+	return l
+}
+
+// Find looks up a system under test by its name (case-sensitive).
+func (t *Topology) Find(name string) (*SysUnderTest, bool) {
+	for _, s := range t.Suts {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return nil, false
+}
+
+// FindDevice looks up a device by its name (case-sensitive).
+func (t *Topology) FindDevice(name string) (Device, bool) {
+	for _, d := range t.Devices {
+		if d.DeviceName() == name {
+			return d, true
+		}
+	}
+	return nil, false
+}
+
+// FilterByType returns a list of devices of the given type.
+func (t *Topology) FilterByType(typ DeviceType) []Device {
+	devs := make([]Device, 0)
+	for _, d := range t.Devices {
+		if d.Type() == typ {
+			devs = append(devs, d)
+		}
+	}
+	return devs
+}
+
+// Neighbors returns a list of devices directly connected to the given device.
+func (t *Topology) Neighbors(d Device) []Device {
+
+	nbrs := make([]Device, 0)
+	add := func(n Device) {
+		for _, dev := range nbrs {
+			if dev == n {
+				return
+			}
+		}
+		nbrs = append(nbrs, n)
+	}
+	for _, l := range t.Links {
+		switch d {
+		case l.A:
+			add(l.B)
+		case l.B:
+			add(l.A)
+		}
+	}
+	return nbrs
+}
+
+// linkView is a serializable representation of the link: devices are referenced by name.
+type linkView struct {
+	A     string `xml:"a,attr"`
+	PortA string `xml:"portA,attr,omitempty" json:",omitempty"`
+	B     string `xml:"b,attr"`
+	PortB string `xml:"portB,attr,omitempty" json:",omitempty"`
+}
+
+// topologyView is a serializable representation of the topology.
+type topologyView struct {
+	XMLName xml.Name        `xml:"Topology" json:"-"`
+	Suts    []*SysUnderTest `xml:"Suts>SystemUnderTest"`
+	Devices []Device        `xml:"Devices>Device"`
+	Links   []linkView      `xml:"Links>Link"`
+}
+
+// Create a serializable representation of the topology.
+func (t *Topology) view() *topologyView {
+
+	v := &topologyView{Suts: t.Suts, Devices: t.Devices, Links: make([]linkView, 0, len(t.Links))}
+	for _, l := range t.Links {
+		v.Links = append(v.Links, linkView{A: l.A.DeviceName(), PortA: portName(l.PortA), B: l.B.DeviceName(),
+			PortB: portName(l.PortB)})
+	}
+	return v
+}
+
 // XML returns a XML-encoded representation of the Topology instance.
-func (t Topology) XML() (string, error) {
+func (t *Topology) XML() (string, error) { return t.XMLIndent(DefaultXMLPrefix, DefaultXMLIndent) }
+
+// XMLIndent returns the same representation as XML(), but every line begins with the given prefix and is indented
+// with one or more copies of the given indent.
+func (t *Topology) XMLIndent(prefix, indent string) (string, error) {
 
-	output, err := xml.Marshal(t)
+	output, err := xml.MarshalIndent(t.view(), prefix, indent)
 	if err != nil {
 		return "", err
 	}
 	return string(output), nil
 }
 
-// JSON returns an JSON-encoded representation of the SUT instance.
-func (t Topology) JSON() (string, error) {
+// deviceData holds the decoded data of any device type: when decoded, the device is created according to its type as
+// Server, EthernetDevice (also when it has ports) or GenericDevice.
+type deviceData struct {
+	GenericDevice `yaml:",inline" bson:",inline"`
+	Ports         []Port `xml:"Ports>Port" json:",omitempty" yaml:",omitempty"`
+	URI           string `xml:",omitempty" json:",omitempty" yaml:",omitempty"`
+}
+
+// Create the device of the proper type from the decoded data.
+func (d *deviceData) device() Device {
+
+	switch {
+	case d.Dtype == DevServer:
+		return &Server{GenericDevice: d.GenericDevice, URI: d.URI}
+	case d.Dtype == DevEthernet || len(d.Ports) > 0:
+		return &EthernetDevice{GenericDevice: d.GenericDevice, Ports: d.Ports}
+	}
+	g := d.GenericDevice
+	return &g
+}
+
+// topologyData is a decoded representation of the topology, see topologyView.
+type topologyData struct {
+	Suts    []*SysUnderTest `xml:"Suts>SystemUnderTest"`
+	Devices []*deviceData   `xml:"Devices>Device"`
+	Links   []linkView      `xml:"Links>Link"`
+}
+
+// Fill the topology with the decoded data; links must reference the known devices, otherwise ErrorInvalidValue is
+// returned.
+func (t *Topology) fromData(data *topologyData) error {
+
+	*t = *NewTopology()
+	if data.Suts != nil {
+		t.Suts = data.Suts
+	}
+	for _, d := range data.Devices {
+		t.AddDevice(d.device())
+	}
+	for _, l := range data.Links {
+		a, ok := t.FindDevice(l.A)
+		if !ok {
+			return fmt.Errorf("%w: link references unknown device %q", ErrorInvalidValue, l.A)
+		}
+		b, ok := t.FindDevice(l.B)
+		if !ok {
+			return fmt.Errorf("%w: link references unknown device %q", ErrorInvalidValue, l.B)
+		}
+		t.AddLink(a, b, findPort(a, l.PortA), findPort(b, l.PortB))
+	}
+	return nil
+}
+
+// Return the port of the device with the given name; a new port is created when the device has no such port. Nil is
+// returned for empty name.
+func findPort(d Device, name string) *Port {
+
+	if name == "" {
+		return nil
+	}
+	if e, ok := d.(*EthernetDevice); ok {
+		for ix := range e.Ports {
+			if e.Ports[ix].Name == name {
+				return &e.Ports[ix]
+			}
+		}
+	}
+	return CreatePort(name, "", PortTypeUnknown)
+}
+
+// MarshalXML implements the xml.Marshaler interface.
+func (t *Topology) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return e.EncodeElement(t.view(), start)
+}
+
+// UnmarshalXML implements the xml.Unmarshaler interface.
+func (t *Topology) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+
+	var data topologyData
+	if err := d.DecodeElement(&data, &start); err != nil {
+		return err
+	}
+	return t.fromData(&data)
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (t *Topology) MarshalJSON() ([]byte, error) { return json.Marshal(t.view()) }
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (t *Topology) UnmarshalJSON(b []byte) error {
+
+	var data topologyData
+	if err := json.Unmarshal(b, &data); err != nil {
+		return err
+	}
+	return t.fromData(&data)
+}
+
+// Create the topology data: devices are encoded the same way as they are decoded.
+func (t *Topology) data() *topologyData {
+
+	data := &topologyData{Suts: t.Suts, Devices: make([]*deviceData, 0, len(t.Devices)), Links: t.view().Links}
+	for _, d := range t.Devices {
+		data.Devices = append(data.Devices, newDeviceData(d))
+	}
+	return data
+}
+
+// MarshalYAML implements the yaml.Marshaler interface.
+func (t *Topology) MarshalYAML() (interface{}, error) { return t.data(), nil }
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (t *Topology) UnmarshalYAML(unmarshal func(interface{}) error) error {
+
+	var data topologyData
+	if err := unmarshal(&data); err != nil {
+		return err
+	}
+	return t.fromData(&data)
+}
+
+// Create the device data from the device of any (known) type.
+func newDeviceData(d Device) *deviceData {
+
+	switch dev := d.(type) {
+	case *GenericDevice:
+		return &deviceData{GenericDevice: *dev}
+	case *EthernetDevice:
+		return &deviceData{GenericDevice: dev.GenericDevice, Ports: dev.Ports}
+	case *Server:
+		return &deviceData{GenericDevice: dev.GenericDevice, URI: dev.URI}
+	}
+	return &deviceData{GenericDevice: *NewGenericDevice(d.DeviceName(), d.Type())}
+}
+
+// JSON returns an JSON-encoded representation of the Topology instance.
+func (t *Topology) JSON() (string, error) {
 
-	b, err := json.Marshal(t)
+	b, err := json.Marshal(t.view())
 	if err != nil {
 		return "", err
 	}
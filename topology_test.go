@@ -0,0 +1,152 @@
+package atf
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"reflect"
+	"testing"
+)
+
+// Create a star topology: a switch with a port for each of the three devices (two servers and a router).
+func newStarTopology() *Topology {
+
+	sw := NewEthernetDevice("switch")
+	for _, p := range []string{"eth1", "eth2", "eth3"} {
+		sw.Ports = append(sw.Ports, *CreatePort(p, "", PortCopper|Port1G|PortFDX))
+	}
+	srv1, srv2 := NewServer("srv1"), NewServer("srv2")
+	srv1.URI = "http://srv1"
+	router := NewGenericDevice("router", DevRouter)
+
+	t := NewTopology()
+	t.Suts = append(t.Suts, CreateSUT("Gateway", "Hardware", "1.0", "", "10.0.0.1"))
+	t.AddLink(sw, srv1, &sw.Ports[0], nil)
+	t.AddLink(sw, srv2, &sw.Ports[1], nil)
+	t.AddLink(router, sw, nil, &sw.Ports[2])
+	return t
+}
+
+// Return the names of the given devices.
+func deviceNames(devs []Device) []string {
+	names := make([]string, 0, len(devs))
+	for _, d := range devs {
+		names = append(names, d.DeviceName())
+	}
+	return names
+}
+
+func TestTopologyNeighbors(t *testing.T) {
+
+	topo := newStarTopology()
+	tests := []struct {
+		name string
+		nbrs []string
+	}{
+		{"switch", []string{"srv1", "srv2", "router"}},
+		{"srv1", []string{"switch"}},
+		{"router", []string{"switch"}},
+	}
+	for _, tt := range tests {
+		d, _ := topo.FindDevice(tt.name)
+		if got := deviceNames(topo.Neighbors(d)); !reflect.DeepEqual(got, tt.nbrs) {
+			t.Errorf("%s: expected neighbors %v, got %v", tt.name, tt.nbrs, got)
+		}
+	}
+	if n := topo.Neighbors(NewServer("isolated")); len(n) != 0 {
+		t.Errorf("unknown device has neighbors: %v", deviceNames(n))
+	}
+	if len(topo.Devices) != 4 {
+		t.Errorf("expected 4 devices (each added once), got %v", deviceNames(topo.Devices))
+	}
+}
+
+func TestTopologyRoundTrip(t *testing.T) {
+
+	tests := []struct {
+		name string
+		enc  func(t *Topology) ([]byte, error)
+		dec  func(b []byte, t *Topology) error
+	}{
+		{"XML", func(t *Topology) ([]byte, error) { return xml.Marshal(t) },
+			func(b []byte, t *Topology) error { return xml.Unmarshal(b, t) }},
+		{"JSON", func(t *Topology) ([]byte, error) { return json.Marshal(t) },
+			func(b []byte, t *Topology) error { return json.Unmarshal(b, t) }},
+	}
+	for _, tt := range tests {
+		topo := newStarTopology()
+		b, err := tt.enc(topo)
+		if err != nil {
+			t.Fatalf("%s: encoding failed: %s", tt.name, err)
+		}
+		got := new(Topology)
+		if err := tt.dec(b, got); err != nil {
+			t.Fatalf("%s: decoding failed: %s", tt.name, err)
+		}
+		if !reflect.DeepEqual(got.Devices, topo.Devices) {
+			t.Errorf("%s: expected devices %v, got %v", tt.name, topo.Devices, got.Devices)
+		}
+		if len(got.Suts) != 1 || got.Suts[0].IPaddr != "10.0.0.1" {
+			t.Errorf("%s: unexpected SUTs %v", tt.name, got.Suts)
+		}
+		if len(got.Links) != len(topo.Links) {
+			t.Fatalf("%s: expected %d links, got %d", tt.name, len(topo.Links), len(got.Links))
+		}
+		for ix, l := range got.Links {
+			if l.String() != topo.Links[ix].String() {
+				t.Errorf("%s: expected link %s, got %s", tt.name, topo.Links[ix], l)
+			}
+		}
+		// the ports are resolved to the device's own ports
+		sw, _ := got.FindDevice("switch")
+		if got.Links[0].PortA != &sw.(*EthernetDevice).Ports[0] {
+			t.Errorf("%s: link port is not the device's port", tt.name)
+		}
+	}
+
+	if err := json.Unmarshal([]byte(`{"Links": [{"A": "x", "B": "y"}]}`), new(Topology)); err == nil {
+		t.Error("expected error for a link between unknown devices")
+	}
+}
+
+func TestTopologyFind(t *testing.T) {
+
+	topo := newStarTopology()
+	tests := []struct {
+		name string
+		sut  bool
+		dev  bool
+	}{
+		{"Gateway", true, false},
+		{"gateway", false, false},
+		{"srv1", false, true},
+		{"SRV1", false, false},
+		{"switch", false, true},
+		{"", false, false},
+		{"nonexistent", false, false},
+	}
+	for _, tt := range tests {
+		s, ok := topo.Find(tt.name)
+		if ok != tt.sut || (ok && s.Name != tt.name) || (!ok && s != nil) {
+			t.Errorf("Find(%q): unexpected result %v, %t", tt.name, s, ok)
+		}
+		d, ok := topo.FindDevice(tt.name)
+		if ok != tt.dev || (ok && d.DeviceName() != tt.name) || (!ok && d != nil) {
+			t.Errorf("FindDevice(%q): unexpected result %v, %t", tt.name, d, ok)
+		}
+	}
+
+	types := []struct {
+		dtype DeviceType
+		names []string
+	}{
+		{DevServer, []string{"srv1", "srv2"}},
+		{DevEthernet, []string{"switch"}},
+		{DevRouter, []string{"router"}},
+		{DevSwitch, []string{}},
+	}
+	for _, tt := range types {
+		if got := deviceNames(topo.FilterByType(tt.dtype)); !reflect.DeepEqual(got, tt.names) {
+			t.Errorf("%s: expected %v, got %v", tt.dtype, tt.names, got)
+		}
+	}
+}
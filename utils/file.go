@@ -11,6 +11,7 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 )
 
@@ -57,8 +58,11 @@ func ReadLines(filename string) (lines []string, err error) {
 	if err != nil {
 		return []string{""}, err
 	}
-	// now we convert the text into an array of lines
+	// now we convert the text into an array of lines; Windows line endings (CRLF) are handled, too
 	lines = strings.Split(string(data), "\n")
+	for ix, l := range lines {
+		lines[ix] = strings.TrimSuffix(l, "\r")
+	}
 	return
 }
 
@@ -78,6 +82,49 @@ func WriteTextFile(path string, contents string) (err error) {
 	return
 }
 
+// AppendTextFile appends the contents to a text file with given path; the file is created if it doesn't exist.
+func AppendTextFile(path string, contents string) (err error) {
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	_, err = f.Write([]byte(contents))
+	return
+}
+
+// WriteTextFileAtomic writes a text file with given path atomically: the contents are written into a temporary file in the
+// same directory first, which is then renamed to the given path. This way, the readers never see a half-written file. If
+// anything goes wrong, the temporary file is removed.
+func WriteTextFileAtomic(path string, contents string) (err error) {
+
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return
+	}
+	// remove the temporary file if anything goes wrong
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+
+	// temporary files are private, but the final file should have the usual permissions
+	if err = f.Chmod(0644); err != nil {
+		return
+	}
+	if _, err = f.Write([]byte(contents)); err != nil {
+		return
+	}
+	if err = f.Close(); err != nil {
+		return
+	}
+	return os.Rename(f.Name(), path)
+}
+
 // CopyFile copies a file from source 'src' to destination (dst).
 func CopyFile(dst, src string) (int64, error) {
 
@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWriteTextFileAtomic(t *testing.T) {
+
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "existing.txt")
+	if err := os.WriteFile(existing, []byte("old contents"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	blocker := filepath.Join(dir, "directory")
+	if err := os.Mkdir(blocker, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path string
+		fail bool
+	}{
+		{filepath.Join(dir, "new.txt"), false},
+		{existing, false},
+		{blocker, true}, // renaming a file over a directory fails
+		{filepath.Join(dir, "nonexistent", "new.txt"), true},
+	}
+	for _, tt := range tests {
+		err := WriteTextFileAtomic(tt.path, "new contents")
+		if (err != nil) != tt.fail {
+			t.Errorf("%s: unexpected error %v", tt.path, err)
+		}
+		if !tt.fail {
+			text, _ := os.ReadFile(tt.path)
+			fi, _ := os.Stat(tt.path)
+			if string(text) != "new contents" || fi.Mode().Perm() != 0644 {
+				t.Errorf("%s: unexpected contents %q or mode %s", tt.path, text, fi.Mode())
+			}
+		}
+		if tmp, _ := filepath.Glob(filepath.Join(dir, "*.tmp*")); len(tmp) > 0 {
+			t.Errorf("%s: temporary files left behind: %v", tt.path, tmp)
+		}
+	}
+}
+
+func TestReadLines(t *testing.T) {
+
+	tests := []struct {
+		text  string
+		lines []string
+	}{
+		{"one\ntwo\nthree", []string{"one", "two", "three"}},
+		{"one\r\ntwo\r\nthree\r\n", []string{"one", "two", "three", ""}},
+		{"mixed\r\nendings\nhere", []string{"mixed", "endings", "here"}},
+		{"inner\rcarriage return\r\n", []string{"inner\rcarriage return", ""}},
+		{"", []string{""}},
+	}
+	for _, tt := range tests {
+		name := filepath.Join(t.TempDir(), "lines.txt")
+		if err := os.WriteFile(name, []byte(tt.text), 0644); err != nil {
+			t.Fatal(err)
+		}
+		lines, err := ReadLines(name)
+		if err != nil {
+			t.Fatalf("ReadLines() failed: %s", err)
+		}
+		if !reflect.DeepEqual(lines, tt.lines) {
+			t.Errorf("%q: expected %q, got %q", tt.text, tt.lines, lines)
+		}
+	}
+}
+
+func TestAppendTextFile(t *testing.T) {
+
+	name := filepath.Join(t.TempDir(), "manifest.txt")
+	for _, s := range []string{"first\n", "second\n", ""} {
+		if err := AppendTextFile(name, s); err != nil {
+			t.Fatalf("AppendTextFile() failed: %s", err)
+		}
+	}
+	if text, _ := os.ReadFile(name); string(text) != "first\nsecond\n" {
+		t.Errorf("unexpected contents %q", text)
+	}
+	if err := AppendTextFile(filepath.Join(name, "file.txt"), "text"); err == nil {
+		t.Error("expected error for invalid path")
+	}
+}
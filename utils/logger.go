@@ -11,8 +11,17 @@ package utils
  */
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
 	"os"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -35,17 +44,26 @@ type LogHandler interface {
 
 // a private struct that defines log handler data structures
 type logHandler struct {
-	// set severity for this handler
+	// set severity for this handler: the least severe messages that are logged
 	sev Severity
 
-	// a formatter for this handler
+	// the most severe messages that are logged (Emergency by default, meaning no upper limit)
+	maxSev Severity
+
+	// a format string for this handler
 	format string
 
+	// a formatter for this handler; by default, the format string is used with PrintfFormatter
+	formatter Formatter
+
 	// a handler's channel onto which log messages are sent
 	msgch chan *logmsg
 
-	// a channel to signal when to stop the handler goroutine
-	stop chan int
+	// a channel that is closed when the handler goroutine has finished
+	done chan int
+
+	// a lock protecting the message channel: sending a message and closing the channel must not overlap
+	mu sync.Mutex
 }
 
 // Severity returns the severity value.
@@ -54,17 +72,123 @@ func (l *logHandler) Severity() Severity { return l.sev }
 // SetSeverity resets the severity value for the log handler.
 func (l *logHandler) SetSeverity(s Severity) { l.sev = s }
 
+// SetSeverityRange limits the handler to log only the messages in the given severity range: 'min' is the least severe and
+// 'max' is the most severe level that is logged. For instance, SetSeverityRange(Warning, Error) logs only warnings and
+// errors.
+func (l *logHandler) SetSeverityRange(min, max Severity) {
+	l.sev = min
+	l.maxSev = max
+}
+
+// Check whether a message with given severity is logged by this handler.
+func (l *logHandler) accepts(sev Severity) bool { return shouldLog(l.sev, sev) && sev >= l.maxSev }
+
 // Format returns the log message format value.
 func (l *logHandler) Format() string { return l.format }
 
-// SetFormat resets the log message format.
-func (l *logHandler) SetFormat(fmt string) { l.format = fmt }
+// SetFormat resets the log message format; the format is also used by the handler's PrintfFormatter (if any).
+func (l *logHandler) SetFormat(fmt string) {
+	l.format = fmt
+	if p, ok := l.formatter.(*PrintfFormatter); ok {
+		p.Fmt = fmt
+	}
+}
+
+// Formatter returns the formatter used by the handler.
+func (l *logHandler) Formatter() Formatter { return l.formatter }
+
+// SetFormatter sets the formatter used by the handler; when nil, the default PrintfFormatter with handler's format
+// string is used.
+func (l *logHandler) SetFormatter(f Formatter) {
+	if f == nil {
+		f = &PrintfFormatter{Fmt: l.format}
+	}
+	l.formatter = f
+}
+
+// SetTimestampLayout sets the layout of the log timestamps (time.RFC3339Nano, for instance); empty layout means the
+// package default (see TimestampLayout). The layout is passed to the formatter when it implements the LayoutSetter
+// interface (as PrintfFormatter does); other formatters own their timestamps and an error is returned for them.
+func (l *logHandler) SetTimestampLayout(layout string) error {
+	ls, ok := l.formatter.(LayoutSetter)
+	if !ok {
+		return fmt.Errorf("log: formatter %T does not support timestamp layouts", l.formatter)
+	}
+	ls.SetTimestampLayout(layout)
+	return nil
+}
+
+// Create a log line from the given message using the handler's formatter.
+func (l *logHandler) formatMsg(sev Severity, msg string) string { return l.formatter.Format(sev, time.Now(), msg) }
 
 // Create a new log handler instance.
-func newLogHandler(fmt string, sev Severity) *logHandler { return &logHandler{sev, fmt, nil, nil} }
+func newLogHandler(fmt string, sev Severity) *logHandler {
+	return &logHandler{sev: sev, maxSev: Emergency, format: fmt, formatter: &PrintfFormatter{Fmt: fmt}}
+}
 
 // Clear clears the log (empty implementation to satisfy the interface, only file logger needs this one...)
-func (l *logHandler) Clear() error { return l.Clear() }
+func (l *logHandler) Clear() error { return nil }
+
+// Start the handler loop as a goroutine: received messages are written using the given function until the message
+// channel is closed. The messages still buffered in the channel are written before the goroutine signals it's done.
+func (l *logHandler) start(write func(Severity, string)) {
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.msgch = make(chan *logmsg, 10) // message channel (buffered)
+	l.done = make(chan int)          // done channel
+
+	go func(msgch chan *logmsg, done chan int) {
+		for m := range msgch {
+			write(m.sev, m.msg)
+		}
+		close(done)
+	}(l.msgch, l.done)
+}
+
+// Stop the handler loop and block until all the buffered messages have been written. Messages sent after the handler
+// has been stopped are dropped.
+func (l *logHandler) shutdown() {
+
+	l.mu.Lock()
+	msgch, done := l.msgch, l.done
+	l.msgch = nil
+	if msgch != nil {
+		close(msgch)
+	}
+	l.mu.Unlock()
+
+	if done != nil {
+		<-done
+	}
+}
+
+// Send a message onto the handler's channel; when 'wait' is not set and the channel is full, the message is dropped
+// rather than blocking the caller and false is returned. Messages are (silently) dropped when the handler is not running.
+func (l *logHandler) send(sev Severity, msg string, wait bool) bool {
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.msgch == nil {
+		return true
+	}
+	if wait {
+		l.msgch <- &logmsg{sev, msg}
+		return true
+	}
+	select {
+	case l.msgch <- &logmsg{sev, msg}:
+		return true
+	default:
+		return false
+	}
+}
+
+// shouldLog reports whether a message with given severity passes the handler's severity threshold.
+// Severities are ordered as in syslog: the lower the value, the more severe the message (Emergency is 0, Debug is 7).
+// A handler logs the messages with its own severity and all more severe messages: a handler set to Warning logs
+// Warning, Error, Critical, Alert and Emergency messages and drops Notice, Informational and Debug messages.
+func shouldLog(handlerSev, msgSev Severity) bool { return msgSev <= handlerSev }
 
 /************************** Log ***********************************/
 
@@ -76,13 +200,18 @@ type logmsg struct {
 
 // Log is a list (a slice) of different log handlers that can be added at will.
 type Log struct {
-	// Handlers is a list of log handlers
+	// Handlers is a list of log handlers; use AddHandler() to add a new one safely
 	Handlers []LogHandler
+
+	// a lock protecting the list of handlers
+	mu sync.RWMutex
 }
 
 // String returns a human-readable representation of the Log instance.
 func (l *Log) String() string {
 
+	l.mu.RLock()
+	defer l.mu.RUnlock()
 	s := ""
 	for _, h := range l.Handlers {
 		if h != nil {
@@ -92,8 +221,16 @@ func (l *Log) String() string {
 	return s
 }
 
-// AddHandler appends a new handler to the list of handlers
-func (l *Log) AddHandler(h LogHandler) []LogHandler { return append(l.Handlers, h) }
+// AddHandler appends a new handler to the list of handlers and returns the updated list.
+func (l *Log) AddHandler(h LogHandler) []LogHandler {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// nil handlers are ignored: use NullHandler to discard the messages
+	if h != nil {
+		l.Handlers = append(l.Handlers, h)
+	}
+	return l.Handlers
+}
 
 /*
 // A dispatch log messages method.
@@ -125,77 +262,44 @@ func (l *Log) dispatch(sev Severity, msg string) {
 
 // Log is a generic log method: send a message with given severity.
 func (l *Log) Log(sev Severity, msg string) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
 	for _, h := range l.Handlers {
 		h.Send(sev, msg)
 	}
 }
 
 // LogS is a pure string version of the Log() method: send a message with given severity (here given as string).
-func (l *Log) LogS(sev, msg string) {
-	s := SeverityFromString(sev)
-	for _, h := range l.Handlers {
-		h.Send(s, msg)
-	}
-}
+func (l *Log) LogS(sev, msg string) { l.Log(SeverityFromString(sev), msg) }
 
 // Debug logs a debug message.
-func (l *Log) Debug(msg string) {
-	for _, h := range l.Handlers {
-		h.Send(Debug, msg)
-	}
-}
+func (l *Log) Debug(msg string) { l.Log(Debug, msg) }
 
 // Info logs an informational message.
-func (l *Log) Info(msg string) {
-	for _, h := range l.Handlers {
-		h.Send(Informational, msg)
-	}
-}
+func (l *Log) Info(msg string) { l.Log(Informational, msg) }
 
 // Notice logs a notice message.
-func (l *Log) Notice(msg string) {
-	for _, h := range l.Handlers {
-		h.Send(Notice, msg)
-	}
-}
+func (l *Log) Notice(msg string) { l.Log(Notice, msg) }
 
 // Warning logs a warning message.
-func (l *Log) Warning(msg string) {
-	for _, h := range l.Handlers {
-		h.Send(Warning, msg)
-	}
-}
+func (l *Log) Warning(msg string) { l.Log(Warning, msg) }
 
 // Error logs an error message.
-func (l *Log) Error(msg string) {
-	for _, h := range l.Handlers {
-		h.Send(Error, msg)
-	}
-}
+func (l *Log) Error(msg string) { l.Log(Error, msg) }
 
 // Critical logs a critical message.
-func (l *Log) Critical(msg string) {
-	for _, h := range l.Handlers {
-		h.Send(Critical, msg)
-	}
-}
+func (l *Log) Critical(msg string) { l.Log(Critical, msg) }
 
 // Alert logs an alert message.
-func (l *Log) Alert(msg string) {
-	for _, h := range l.Handlers {
-		h.Send(Alert, msg)
-	}
-}
+func (l *Log) Alert(msg string) { l.Log(Alert, msg) }
 
 // Emergency logs an emergency message.
-func (l *Log) Emergency(msg string) {
-	for _, h := range l.Handlers {
-		h.Send(Emergency, msg)
-	}
-}
+func (l *Log) Emergency(msg string) { l.Log(Emergency, msg) }
 
-// Close closes the log.
+// Close closes the log: no message is being sent while the handlers are closed.
 func (l *Log) Close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
 	for _, h := range l.Handlers {
 		h.Close()
 	}
@@ -203,6 +307,8 @@ func (l *Log) Close() {
 
 // Clear clears the contents of the log. (empty implementation to satisfy the interface, only FileHandler actually needs one...)
 func (l *Log) Clear() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
 	for _, h := range l.Handlers {
 		h.Clear()
 	}
@@ -212,11 +318,13 @@ func (l *Log) Clear() {
 // are sent and the other where signal when to stop is sent. Return the Log instance.
 func NewLog() *Log {
 	// create new Log instance
-	return &Log{make([]LogHandler, 0, 2)}
+	return &Log{Handlers: make([]LogHandler, 0, 2)}
 }
 
 // Start starts the log handlers.
 func (l *Log) Start() error {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
 	var err error
 	for _, h := range l.Handlers {
 		if err = h.Start(); err != nil {
@@ -228,9 +336,37 @@ func (l *Log) Start() error {
 
 /************************** Formatter  ***********************************/
 
-// Formatter is an interface defining the generic formatter
+// Formatter is an interface defining the generic formatter: it creates a log line from the message severity, time and text.
 type Formatter interface {
-	Format(string)
+	Format(sev Severity, t time.Time, msg string) string
+}
+
+// PrintfFormatter is a formatter using a printf-like format string; the format is given the timestamp (as string),
+// severity and message, in this order. This is the default formatter used by the handlers.
+type PrintfFormatter struct {
+
+	// Fmt is a printf-like format string
+	Fmt string
+
+	// Layout is a timestamp layout (TimestampLayout, when empty)
+	Layout string
+}
+
+// LayoutSetter is an interface implemented by the formatters that accept the timestamp layout set on the handler.
+type LayoutSetter interface {
+	SetTimestampLayout(layout string)
+}
+
+// SetTimestampLayout implements the LayoutSetter interface.
+func (p *PrintfFormatter) SetTimestampLayout(layout string) { p.Layout = layout }
+
+// Format implements the Formatter interface.
+func (p *PrintfFormatter) Format(sev Severity, t time.Time, msg string) string {
+	layout := p.Layout
+	if layout == "" {
+		layout = TimestampLayout
+	}
+	return fmt.Sprintf(p.Fmt, t.Format(layout), sev, msg)
 }
 
 /************************** FileHandler ***********************************/
@@ -249,19 +385,16 @@ type FileHandler struct {
 
 // Write a messages with given severity to a logfile.
 func (f *FileHandler) write(sev Severity, msg string) {
-	if f.Severity() >= sev {
-		fmt.Fprintf(f.file, f.Format(), Now(), sev, msg)
+	if f.file != nil && f.accepts(sev) {
+		fmt.Fprint(f.file, f.formatMsg(sev, msg))
 	}
 }
 
 // Close closes the file handler.
 func (f *FileHandler) Close() {
 
-	// send a signal to quit goroutine
-	if f.stop != nil {
-		close(f.logHandler.msgch)
-		f.stop <- 1
-	}
+	// stop the goroutine, wait for the messages to be flushed
+	f.shutdown()
 
 	if f.file != nil {
 		f.file.Close()
@@ -270,15 +403,14 @@ func (f *FileHandler) Close() {
 
 // String returns a human-readable representation of the FileHandler instance.
 func (f *FileHandler) String() string {
+	if f.file == nil {
+		return fmt.Sprintf("  FileHandler: fmt=%q, lvl=%-10s, file=%q (not open)\n", f.Format(), f.Severity(), f.filename)
+	}
 	return fmt.Sprintf("  FileHandler: fmt=%q, lvl=%-10s, fd=%d\n", f.Format(), f.Severity(), f.file.Fd())
 }
 
 // Send sends a log message onto an internal channel.
-func (f *FileHandler) Send(sev Severity, msg string) {
-	if f.logHandler.msgch != nil {
-		f.logHandler.msgch <- &logmsg{sev, msg}
-	}
-}
+func (f *FileHandler) Send(sev Severity, msg string) { f.send(sev, msg, true) }
 
 // Clear clears the contents of the log file
 func (f *FileHandler) Clear() error {
@@ -286,6 +418,7 @@ func (f *FileHandler) Clear() error {
 	var err error
 
 	f.Close() // we must close the file
+	f.file = nil
 
 	if err = os.Remove(f.filename); err != nil {
 		return err
@@ -293,43 +426,140 @@ func (f *FileHandler) Clear() error {
 	if f.file, err = os.OpenFile(f.filename, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0755); err != nil {
 		return err
 	}
-	f.Start() // we must close the file
-	return err
+	return f.Start() // and restart the handler
 }
 
-// Start runs handler as a goroutine.
+// Start runs handler as a goroutine. An error is returned when the log file is not open.
 func (f *FileHandler) Start() error {
-
-	f.logHandler.msgch = make(chan *logmsg, 10) // message channel (buffered)
-	f.logHandler.stop = make(chan int, 1)       // stop channel
-
-	go func(f *FileHandler) {
-
-		for {
-			select {
-			// when message is received over channel, write it
-			case m, ok := <-f.logHandler.msgch:
-				if ok {
-					f.write(m.sev, m.msg)
-				}
-			// when data is received over stop channel, just exit the goroutine
-			case <-f.logHandler.stop:
-				return
-	//		default: // do nothing
-			}
-		}
-	}(f)
-
+	if f.file == nil {
+		return fmt.Errorf("log: file %q is not open", f.filename)
+	}
+	f.start(f.write)
 	return nil
 }
 
-// NewFileHandler creates a new file handler.
+// NewFileHandler creates a new file handler. When the log file cannot be opened, the handler is returned together with the
+// error; such handler discards all the messages and its Start() method fails.
 func NewFileHandler(filename string, fmt string, sev Severity) (*FileHandler, error) {
 	// open log file for append data
 	f, err := os.OpenFile(filename, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0755)
 	return &FileHandler{newLogHandler(fmt, sev), f, filename}, err
 }
 
+/************************** RotatingFileHandler ***********************************/
+
+// RotatingFileHandler is a handler that writes messages to local log file and rotates the file when it grows too big or
+// too old. Rotated files are renamed to "<filename>.1", "<filename>.2" etc. (the higher the number, the older the file),
+// only the configured number of backups is kept.
+type RotatingFileHandler struct {
+	// rotating handler is a file handler with some additional data
+	*FileHandler
+
+	// maximum size of the log file in bytes; zero means no size-based rotation
+	maxBytes int64
+
+	// number of rotated files to keep
+	backups int
+
+	// MaxAge is the maximum age of the log file; zero means no age-based rotation
+	MaxAge time.Duration
+
+	// current size of the log file
+	size int64
+
+	// the time when the current log file was opened
+	opened time.Time
+}
+
+// Write a message with given severity to a logfile, rotate the file when needed.
+func (r *RotatingFileHandler) write(sev Severity, msg string) {
+	if r.accepts(sev) {
+		line := r.formatMsg(sev, msg)
+		if r.needsRotation(int64(len(line))) {
+			r.rotate()
+		}
+		if r.file != nil {
+			n, _ := fmt.Fprint(r.file, line)
+			r.size += int64(n)
+		}
+	}
+}
+
+// Check whether the log file needs to be rotated before n bytes are written.
+func (r *RotatingFileHandler) needsRotation(n int64) bool {
+	if r.maxBytes > 0 && r.size > 0 && r.size+n > r.maxBytes {
+		return true
+	}
+	return r.MaxAge > 0 && time.Since(r.opened) > r.MaxAge
+}
+
+// Rotate the log files: shift the existing backups, rename the current file to the first backup and reopen a fresh file.
+func (r *RotatingFileHandler) rotate() error {
+
+	if r.file != nil {
+		r.file.Close()
+	}
+
+	if r.backups > 0 {
+		os.Remove(fmt.Sprintf("%s.%d", r.filename, r.backups))
+		for i := r.backups - 1; i > 0; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", r.filename, i), fmt.Sprintf("%s.%d", r.filename, i+1))
+		}
+		os.Rename(r.filename, r.filename+".1")
+	} else {
+		os.Remove(r.filename)
+	}
+	return r.open()
+}
+
+// Open the log file for appending data and remember its current size.
+func (r *RotatingFileHandler) open() (err error) {
+
+	r.size = 0
+	r.opened = time.Now()
+	if r.file, err = os.OpenFile(r.filename, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0755); err != nil {
+		return err
+	}
+	if fi, err := r.file.Stat(); err == nil {
+		r.size = fi.Size()
+	}
+	return nil
+}
+
+// String returns a human-readable representation of the RotatingFileHandler instance.
+func (r *RotatingFileHandler) String() string {
+	return fmt.Sprintf("  RotatingFileHandler: fmt=%q, lvl=%-10s, file=%q, max=%d, backups=%d\n",
+		r.Format(), r.Severity(), r.filename, r.maxBytes, r.backups)
+}
+
+// Clear clears the contents of the log file (backups are left intact).
+func (r *RotatingFileHandler) Clear() error {
+
+	r.Close() // we must close the file
+
+	if err := os.Remove(r.filename); err != nil {
+		return err
+	}
+	if err := r.open(); err != nil {
+		return err
+	}
+	return r.Start()
+}
+
+// Start runs handler as a goroutine.
+func (r *RotatingFileHandler) Start() error {
+	r.start(r.write)
+	return nil
+}
+
+// NewRotatingFileHandler creates a new rotating file handler. The log file is rotated when it would exceed 'maxBytes'
+// bytes; 'backups' rotated files are kept.
+func NewRotatingFileHandler(filename, fmt string, sev Severity, maxBytes int64, backups int) (*RotatingFileHandler, error) {
+	r := &RotatingFileHandler{FileHandler: &FileHandler{logHandler: newLogHandler(fmt, sev), filename: filename},
+		maxBytes: maxBytes, backups: backups}
+	return r, r.open()
+}
+
 /************************** StreamHandler ***********************************/
 
 // StreamHandler is a handler that writes messages to STDOUT (console)
@@ -337,8 +567,8 @@ type StreamHandler FileHandler
 
 // Write a message with given severity to STDOUT.
 func (s *StreamHandler) write(sev Severity, msg string) {
-	if s.Severity() >= sev {
-		fmt.Printf(s.Format(), Now(), sev, msg)
+	if s.accepts(sev) {
+		fmt.Print(s.formatMsg(sev, msg))
 	}
 }
 
@@ -349,44 +579,16 @@ func (s *StreamHandler) String() string {
 
 // Close closes the stream handler.
 func (s *StreamHandler) Close() {
-	// send a signal to quit goroutine
-	if s.stop != nil {
-		close(s.logHandler.msgch)
-		s.stop <- 1
-	}
+	// stop the goroutine, wait for the messages to be flushed
+	s.shutdown()
 }
 
 // Send sends a log message onto internal channel.
-func (s *StreamHandler) Send(sev Severity, msg string) {
-	if s.logHandler.msgch != nil {
-		s.logHandler.msgch <- &logmsg{sev, msg}
-	}
-}
+func (s *StreamHandler) Send(sev Severity, msg string) { s.send(sev, msg, true) }
 
 // Start runs handler as a goroutine.
 func (s *StreamHandler) Start() error {
-
-	s.logHandler.msgch = make(chan *logmsg, 10) // message channel (buffered)
-	s.logHandler.stop = make(chan int, 1)       // stop channel
-
-	go func(s *StreamHandler) {
-
-		for {
-			select {
-			// when message is received over channel, write it
-			case m, ok := <-s.logHandler.msgch:
-				//fmt.Printf("DEBUG, logger: msg=%v\n", m) // DEBUG
-				if ok {
-					s.write(m.sev, m.msg)
-				}
-			// when data is received over stop channel, just exit the goroutine
-			case <-s.logHandler.stop:
-				return
-			default: // do nothing
-			}
-		}
-	}(s)
-
+	s.start(s.write)
 	return nil
 }
 
@@ -396,9 +598,83 @@ func (s *StreamHandler) Clear() error { return nil }
 // NewStreamHandler creates a new stream handler.
 func NewStreamHandler(fmt string, sev Severity) *StreamHandler { return &StreamHandler{newLogHandler(fmt, sev), os.Stdout, ""} }
 
+/************************** ColorStreamHandler ***********************************/
+
+// ANSI color escape sequences used by the ColorStreamHandler
+const (
+	colorReset  = "\x1b[0m"
+	colorRed    = "\x1b[31m"
+	colorYellow = "\x1b[33m"
+	colorCyan   = "\x1b[36m"
+	colorGray   = "\x1b[90m"
+)
+
+// ColorStreamHandler is a stream handler that colors the messages according to their severity: Error and more severe
+// messages are red, warnings are yellow, notices are cyan and debug messages are gray.
+type ColorStreamHandler struct {
+	// color handler is a stream handler with colors
+	*StreamHandler
+
+	// Color defines whether the messages are colored; by default, it is set only when STDOUT is a terminal
+	Color bool
+}
+
+// Return the color escape sequence for the given severity; empty string means the default color.
+func severityColor(sev Severity) string {
+	switch {
+	case sev <= Error:
+		return colorRed
+	case sev == Warning:
+		return colorYellow
+	case sev == Notice:
+		return colorCyan
+	case sev == Debug:
+		return colorGray
+	}
+	return ""
+}
+
+// Write a (colored) message with given severity to STDOUT.
+func (c *ColorStreamHandler) write(sev Severity, msg string) {
+	if c.accepts(sev) {
+		line := c.formatMsg(sev, msg)
+		if col := severityColor(sev); c.Color && col != "" {
+			// keep the line terminator outside of the colored text
+			text := strings.TrimRight(line, "\n")
+			line = col + text + colorReset + line[len(text):]
+		}
+		fmt.Fprint(c.file, line)
+	}
+}
+
+// String returns a human-readable representation of the ColorStreamHandler instance.
+func (c *ColorStreamHandler) String() string {
+	return fmt.Sprintf("ColorStreamHandler: fmt=%q, lvl=%-10s, color=%t\n", c.Format(), c.Severity(), c.Color)
+}
+
+// Start runs handler as a goroutine.
+func (c *ColorStreamHandler) Start() error {
+	c.start(c.write)
+	return nil
+}
+
+// Check whether the given file is a terminal.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+// NewColorStreamHandler creates a new color stream handler. Coloring is enabled only when STDOUT is a terminal.
+func NewColorStreamHandler(fmt string, sev Severity) *ColorStreamHandler {
+	return &ColorStreamHandler{StreamHandler: NewStreamHandler(fmt, sev), Color: isTerminal(os.Stdout)}
+}
+
 /************************** SyslogHandler ***********************************/
 
-// SyslogHandler is a handler that sends the log messages to standard syslog port (UDP 514)
+// SyslogHandler is a handler that sends the log messages to standard syslog port (UDP or TCP 514)
 type SyslogHandler struct {
 	// all handlers share common data structures
 	*logHandler
@@ -408,24 +684,51 @@ type SyslogHandler struct {
 
 	// a syslog message built according to RFC
 	*SyslogMsg
+
+	// When delivery fails, the message is retried at most Retries times (3 by default), reconnecting to the server; the
+	// first retry waits for RetryDelay and the delay doubles with every next one. Only then the message is written to the
+	// fallback.
+	Retries    int
+	RetryDelay time.Duration
+
+	// Fallback receives the messages that could not be delivered (os.Stderr by default)
+	Fallback io.Writer
+
+	// a lock protecting the fallback writer, which is used by both the senders and the handler goroutine
+	fbmu sync.Mutex
 }
 
-// Write a log message with given severity to wire.
+// Write a log message with given severity to wire; the message that cannot be delivered is retried in place with a
+// bounded backoff, so the handler goroutine is blocked (and the following messages are queued) meanwhile.
 func (s *SyslogHandler) write(level Severity, msg string) error {
-	if s.Severity() >= level {
-		s.Fac = FacLocal0
+	if s.accepts(level) {
 		s.Sev = level
 		s.Msg = fmt.Sprintf("%s %s", level.String(), msg)
-		t := time.Now()
-		s.SetTimestamp(t)
+		s.SetTimestamp(time.Now())
+
+		// failed TCP connection is re-established by the next send
 		err := s.SyslogMsg.Send(s.IP)
+		for n, delay := 0, s.RetryDelay; err != nil && n < s.Retries; n, delay = n+1, delay*2 {
+			time.Sleep(delay)
+			err = s.SyslogMsg.Send(s.IP)
+		}
 		if err != nil {
+			s.fallback(s.Msg, err.Error())
 			return err
 		}
 	}
 	return nil
 }
 
+// Write an undelivered message to the fallback (if defined), together with the reason.
+func (s *SyslogHandler) fallback(msg, reason string) {
+	s.fbmu.Lock()
+	defer s.fbmu.Unlock()
+	if s.Fallback != nil {
+		fmt.Fprintf(s.Fallback, "syslog: delivery to %s failed (%s): %s\n", s.IP, reason, msg)
+	}
+}
+
 // String returns a human-readable representation of the SyslogHandler instance.
 func (s *SyslogHandler) String() string {
 	return fmt.Sprintf("SyslogHandler: fmt=%q, lvl=%-10s, Server=%q\n", s.Format(), s.Severity(), s.IP)
@@ -433,52 +736,213 @@ func (s *SyslogHandler) String() string {
 
 // Close closes the syslog handler.
 func (s *SyslogHandler) Close() {
-	// send a signal to quit goroutine
-	if s.stop != nil {
-		close(s.logHandler.msgch)
-		s.logHandler.stop <- 1
-	}
+	// stop the goroutine, wait for the messages to be flushed
+	s.shutdown()
+	s.Disconnect()
 }
 
-// Send sends a log message onto internal channel.
+// Send sends a log message onto internal channel. When the channel is full, the message is written to the fallback
+// rather than blocking the caller.
 func (s *SyslogHandler) Send(sev Severity, msg string) {
-	if s.logHandler.msgch != nil {
-		s.logHandler.msgch <- &logmsg{sev, msg}
+	if !s.send(sev, msg, false) && s.accepts(sev) {
+		s.fallback(fmt.Sprintf("%s %s", sev.String(), msg), "buffer full")
 	}
 }
 
 // Start runs a handler as a goroutine.
 func (s *SyslogHandler) Start() error {
+	s.start(func(sev Severity, msg string) { s.write(sev, msg) })
+	return nil
+}
+
+// Clear clears the log (empty implementation to satisfy the interface, only file logger needs this one...).
+func (s *SyslogHandler) Clear() error {
+	return nil
+}
+
+// NewSyslogHandler creates a new syslog handler. An error is returned when the syslog server IP address is malformed.
+func NewSyslogHandler(ip, fmt string, sev Severity) (*SyslogHandler, error) {
+	if net.ParseIP(ip) == nil {
+		return nil, errors.New("syslog: invalid server IP address: " + ip)
+	}
+	return &SyslogHandler{logHandler: newLogHandler(fmt, sev), IP: ip, SyslogMsg: NewSyslogMsg(), Retries: 3,
+		RetryDelay: 100 * time.Millisecond, Fallback: os.Stderr}, nil
+}
+
+// SetFacility sets the facility of the messages by its name (e.g. "local0" or "mail").
+func (s *SyslogHandler) SetFacility(name string) error {
+	fac := FacilityFromString(name)
+	if fac == UnknownFacility {
+		return fmt.Errorf("syslog: unknown facility %q", name)
+	}
+	s.Fac = fac
+	return nil
+}
+
+// NewSyslogHandlerPort creates a new syslog handler that sends messages to the given (non-standard) port.
+func NewSyslogHandlerPort(ip string, port int, fmt string, sev Severity) (*SyslogHandler, error) {
+	h, err := NewSyslogHandler(ip, fmt, sev)
+	if err != nil {
+		return nil, err
+	}
+	h.Port = port
+	return h, nil
+}
+
+// NewSyslogHandlerTCP creates a new syslog handler that sends messages over TCP.
+func NewSyslogHandlerTCP(ip, fmt string, sev Severity) (*SyslogHandler, error) {
+	h, err := NewSyslogHandler(ip, fmt, sev)
+	if err != nil {
+		return nil, err
+	}
+	h.Transport = "tcp"
+	return h, nil
+}
+
+/************************** WebhookHandler ***********************************/
+
+// WebhookHandler is a handler that POSTs the log messages as JSON to a configured URL (a Slack/Teams/generic webhook).
+// The JSON body has the following fields: "severity", "message" and "time"; the message is sent as it is, so the
+// handler's format is not used. Delivery is retried a couple of times; if it still fails, the message is dropped.
+type WebhookHandler struct {
+	// all handlers share common data structures
+	*logHandler
 
-	s.logHandler.msgch = make(chan *logmsg, 10) // message channel (buffered)
-	s.logHandler.stop = make(chan int, 1)       // stop channel
-
-	go func(s *SyslogHandler) {
-
-		for {
-			select {
-			// when message is received over channel, write it
-			case m, ok := <-s.logHandler.msgch:
-				if ok {
-					s.write(m.sev, m.msg)
-				}
-			// when data is received over stop channel, just exit the goroutine
-			case <-s.logHandler.stop:
-				return
-			default: // do nothing
-			}
+	// URL is the webhook endpoint
+	URL string
+
+	// Retries is a number of delivery retries (2 by default); the first retry waits for RetryDelay (200ms by default)
+	// and the delay doubles with every next one
+	Retries    int
+	RetryDelay time.Duration
+
+	// CloseTimeout limits the time Close() waits for the pending messages to be delivered (5s by default); the messages
+	// that are not delivered in time are dropped
+	CloseTimeout time.Duration
+
+	// a HTTP client used to deliver messages (with timeout)
+	client *http.Client
+
+	// a context cancelled when the pending messages are to be dropped, and its cancel function
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// webhook message JSON body
+type webhookMsg struct {
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+	Time     string `json:"time"`
+}
+
+// Write a message with given severity to the webhook, retry when delivery fails.
+func (w *WebhookHandler) write(sev Severity, msg string) {
+
+	if !w.accepts(sev) {
+		return
+	}
+	// time and severity are sent as separate fields, so the message is not formatted
+	body, err := json.Marshal(&webhookMsg{Severity: sev.String(), Message: msg, Time: Now()})
+	if err != nil {
+		return
+	}
+	for n, delay := 0, w.RetryDelay; w.ctx.Err() == nil; n, delay = n+1, delay*2 {
+		if err = w.post(body); err == nil || n == w.Retries {
+			return
+		}
+		select {
+		case <-w.ctx.Done():
+		case <-time.After(delay):
 		}
-	}(s)
+	}
+}
+
+// POST a single message body to the webhook.
+func (w *WebhookHandler) post(body []byte) error {
 
+	req, err := http.NewRequestWithContext(w.ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook: %s", resp.Status)
+	}
 	return nil
 }
 
-// Clear clears the log (empty implementation to satisfy the interface, only file logger needs this one...).
-func (s *SyslogHandler) Clear() error {
+// String returns a human-readable representation of the WebhookHandler instance.
+func (w *WebhookHandler) String() string {
+	return fmt.Sprintf("WebhookHandler: fmt=%q, lvl=%-10s, URL=%q\n", w.Format(), w.Severity(), w.URL)
+}
+
+// Close closes the webhook handler. The pending messages are delivered, but at most for CloseTimeout: the rest of them
+// is dropped.
+func (w *WebhookHandler) Close() {
+	if w.cancel == nil {
+		return
+	}
+	// stop the goroutine, wait for the messages to be flushed (or dropped, when the timeout expires)
+	timer := time.AfterFunc(w.CloseTimeout, w.cancel)
+	defer timer.Stop()
+	w.shutdown()
+	w.cancel()
+}
+
+// Send sends a log message onto internal channel. When the channel is full, the message is dropped rather than blocking
+// the caller.
+func (w *WebhookHandler) Send(sev Severity, msg string) { w.send(sev, msg, false) }
+
+// Start runs a handler as a goroutine.
+func (w *WebhookHandler) Start() error {
+	w.ctx, w.cancel = context.WithCancel(context.Background())
+	w.start(w.write)
 	return nil
 }
 
-// NewSyslogHandler creates a new sysloh handler.
-func NewSyslogHandler(ip, fmt string, sev Severity) *SyslogHandler {
-	return &SyslogHandler{newLogHandler(fmt, sev), ip, NewSyslogMsg()}
+// Clear clears the log (empty implementation to satisfy the interface, only file logger needs this one...).
+func (w *WebhookHandler) Clear() error { return nil }
+
+// NewWebhookHandler creates a new webhook handler.
+func NewWebhookHandler(url, fmt string, sev Severity) *WebhookHandler {
+	return &WebhookHandler{logHandler: newLogHandler(fmt, sev), URL: url, Retries: 2,
+		RetryDelay: 200 * time.Millisecond, CloseTimeout: 5 * time.Second, client: &http.Client{Timeout: 5 * time.Second}}
+}
+
+/************************** NullHandler ***********************************/
+
+// NullHandler is a handler that discards all the messages; it is meant to disable logging entirely.
+type NullHandler struct {
+	// all handlers share common data structures
+	*logHandler
+}
+
+// String returns a human-readable representation of the NullHandler instance.
+func (n *NullHandler) String() string { return "NullHandler\n" }
+
+// Start does nothing.
+func (n *NullHandler) Start() error { return nil }
+
+// Close does nothing.
+func (n *NullHandler) Close() {}
+
+// Send discards the message.
+func (n *NullHandler) Send(sev Severity, msg string) {}
+
+// Clear does nothing.
+func (n *NullHandler) Clear() error { return nil }
+
+// NewNullHandler creates a new null handler.
+func NewNullHandler() *NullHandler { return &NullHandler{logHandler: newLogHandler("", Debug)} }
+
+// NewNullLog creates a new logger that discards all the messages.
+func NewNullLog() *Log {
+	l := NewLog()
+	l.AddHandler(NewNullHandler())
+	return l
 }
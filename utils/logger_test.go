@@ -0,0 +1,580 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"runtime/metrics"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHandlerClear(t *testing.T) {
+
+	syslog, err := NewSyslogHandler("127.0.0.1", "%s %s %s\n", Debug)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		h    interface{ Clear() error }
+	}{
+		{"base", newLogHandler("%s %s %s\n", Debug)},
+		{"stream", NewStreamHandler("%s %s %s\n", Debug)},
+		{"syslog", syslog},
+		{"null", NewNullHandler()},
+	}
+	for _, tt := range tests {
+		done := make(chan error, 1)
+		go func() { done <- tt.h.Clear() }()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("%s: Clear() failed: %s", tt.name, err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s: Clear() did not return", tt.name)
+		}
+	}
+}
+
+func TestShouldLog(t *testing.T) {
+
+	// for every handler severity, the messages logged: Emergency, Alert, Critical, Error, Warning, Notice, Info, Debug
+	tests := []struct {
+		handler Severity
+		logged  string
+	}{
+		{Emergency, "10000000"},
+		{Alert, "11000000"},
+		{Critical, "11100000"},
+		{Error, "11110000"},
+		{Warning, "11111000"},
+		{Notice, "11111100"},
+		{Informational, "11111110"},
+		{Debug, "11111111"},
+	}
+	for _, tt := range tests {
+		for msg := Emergency; msg <= Debug; msg++ {
+			if want := tt.logged[msg] == '1'; shouldLog(tt.handler, msg) != want {
+				t.Errorf("handler %s, message %s: expected %t", tt.handler, msg, want)
+			}
+		}
+	}
+}
+
+// Return the CPU time spent running the Go code so far (the metric is updated by the garbage collector).
+func userCPU() float64 {
+	runtime.GC()
+	s := []metrics.Sample{{Name: "/cpu/classes/user:cpu-seconds"}}
+	metrics.Read(s)
+	return s[0].Value.Float64()
+}
+
+func TestHandlerIdle(t *testing.T) {
+
+	syslog, err := NewSyslogHandler("127.0.0.1", "%s %s %s\n", Debug)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handlers := []LogHandler{NewStreamHandler("%s %s %s\n", Debug), syslog, NewWebhookHandler("", "%s %s %s\n", Debug)}
+	for _, h := range handlers {
+		h.Start()
+		defer h.Close()
+	}
+
+	// idle handlers must block: the spinning loops would burn the whole period
+	const period = 500 * time.Millisecond
+	start := userCPU()
+	time.Sleep(period)
+	if spent := userCPU() - start; spent > period.Seconds()/2 {
+		t.Errorf("idle handlers spent %.2fs of CPU time in %s", spent, period)
+	}
+}
+
+func TestRotatingFileHandler(t *testing.T) {
+
+	tests := []struct {
+		backups int
+		maxAge  time.Duration
+		files   int
+	}{
+		{2, 0, 3},
+		{5, 0, 4},
+		{0, 0, 1},
+		{1, time.Nanosecond, 2},
+	}
+	for _, tt := range tests {
+		name := filepath.Join(t.TempDir(), "test.log")
+		r, err := NewRotatingFileHandler(name, "%[3]s\n", Debug, 100, tt.backups)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.MaxAge = tt.maxAge
+		r.Start()
+		for i := 0; i < 10; i++ {
+			r.Send(Error, fmt.Sprintf("message #%d %s", i, strings.Repeat("x", 20)))
+		}
+		r.Close()
+
+		files, _ := filepath.Glob(name + "*")
+		if len(files) != tt.files {
+			t.Errorf("backups %d, age %s: expected %d files, got %v", tt.backups, tt.maxAge, tt.files, files)
+		}
+		for _, f := range files {
+			if fi, err := os.Stat(f); err != nil || fi.Size() > 100 {
+				t.Errorf("file %s is too big: %v", f, fi.Size())
+			}
+		}
+		if text, _ := os.ReadFile(name); !strings.HasPrefix(string(text), "message #9") {
+			t.Errorf("the latest message is not in the current file: %q", text)
+		}
+	}
+}
+
+func TestFileHandlerCloseFlushes(t *testing.T) {
+
+	for _, n := range []int{1, 10, 1000} {
+		name := filepath.Join(t.TempDir(), "test.log")
+		f, err := NewFileHandler(name, "%[3]s\n", Debug)
+		if err != nil {
+			t.Fatal(err)
+		}
+		l := NewLog()
+		l.AddHandler(f)
+		l.Start()
+		for i := 0; i < n; i++ {
+			l.Info(fmt.Sprintf("message #%d", i))
+		}
+		l.Close()
+
+		text, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(strings.TrimSpace(string(text)), "\n")
+		if len(lines) != n || lines[n-1] != fmt.Sprintf("message #%d", n-1) {
+			t.Errorf("expected %d messages, got %d", n, len(lines))
+		}
+		// messages sent after close are dropped, but they must not block
+		l.Info("dropped")
+	}
+}
+
+func TestColorStreamHandler(t *testing.T) {
+
+	tests := []struct {
+		sev   Severity
+		color string
+	}{
+		{Emergency, colorRed},
+		{Error, colorRed},
+		{Warning, colorYellow},
+		{Notice, colorCyan},
+		{Informational, ""},
+		{Debug, colorGray},
+	}
+	for _, forced := range []bool{true, false} {
+		out, err := os.CreateTemp(t.TempDir(), "stdout")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if isTerminal(out) {
+			t.Errorf("file %s is detected as a terminal", out.Name())
+		}
+		c := NewColorStreamHandler("%[3]s\n", Debug)
+		c.file, c.Color = out, forced
+		for _, tt := range tests {
+			c.write(tt.sev, tt.sev.String())
+		}
+		out.Close()
+
+		text, _ := os.ReadFile(out.Name())
+		lines := strings.Split(string(text), "\n")
+		for ix, tt := range tests {
+			want := tt.sev.String()
+			if forced && tt.color != "" {
+				want = tt.color + want + colorReset
+			}
+			if lines[ix] != want {
+				t.Errorf("color %t, %s: expected %q, got %q", forced, tt.sev, want, lines[ix])
+			}
+		}
+	}
+}
+
+func TestWebhookHandler(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		failures int
+		sev      Severity
+		attempts int
+		received bool
+	}{
+		{"delivered", 0, Error, 1, true},
+		{"retried", 2, Critical, 3, true},
+		{"dropped", 5, Error, 3, false},
+		{"filtered", 0, Informational, 0, false},
+	}
+	for _, tt := range tests {
+		var mu sync.Mutex
+		attempts := 0
+		var msg webhookMsg
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			if attempts++; attempts <= tt.failures {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			if r.Header.Get("Content-Type") != "application/json" || json.NewDecoder(r.Body).Decode(&msg) != nil {
+				w.WriteHeader(http.StatusBadRequest)
+			}
+		}))
+
+		// the message is sent as it is, not formatted
+		w := NewWebhookHandler(srv.URL, "%s %s %s", Warning)
+		w.RetryDelay = 10 * time.Millisecond
+		w.Start()
+		w.Send(tt.sev, "disk is full")
+		w.Close()
+		srv.Close()
+
+		if attempts != tt.attempts {
+			t.Errorf("%s: expected %d attempts, got %d", tt.name, tt.attempts, attempts)
+		}
+		if received := msg.Message != ""; received != tt.received {
+			t.Errorf("%s: expected received %t, got %+v", tt.name, tt.received, msg)
+		}
+		if tt.received && (msg.Severity != tt.sev.String() || msg.Message != "disk is full" || msg.Time == "") {
+			t.Errorf("%s: unexpected message %+v", tt.name, msg)
+		}
+	}
+}
+
+func TestWebhookHandlerNonBlocking(t *testing.T) {
+
+	release := make(chan int)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { <-release }))
+	defer srv.Close()
+
+	w := NewWebhookHandler(srv.URL, "%[3]s", Debug)
+	w.Start()
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		w.Send(Error, "flood")
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("sending to a stalled webhook blocked for %s", d)
+	}
+	close(release)
+	w.Close()
+}
+
+func TestWebhookHandlerClose(t *testing.T) {
+
+	release := make(chan int)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	// the stalled webhook does not block the close for longer than CloseTimeout: pending messages are dropped
+	w := NewWebhookHandler(srv.URL, "%[3]s", Debug)
+	w.CloseTimeout = 100 * time.Millisecond
+	w.Start()
+	for i := 0; i < 5; i++ {
+		w.Send(Error, "pending")
+	}
+	start := time.Now()
+	w.Close()
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("closing a stalled webhook blocked for %s", d)
+	}
+}
+
+// Run this one with the -race flag.
+func TestLogConcurrent(t *testing.T) {
+
+	dir := t.TempDir()
+	newHandler := func(ix int) LogHandler {
+		f, err := NewFileHandler(filepath.Join(dir, fmt.Sprintf("%d.log", ix)), "%[3]s\n", Debug)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Start()
+		return f
+	}
+
+	l := NewLog()
+	l.AddHandler(newHandler(0))
+	l.Info("before")
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				l.Log(Severity(j%8), fmt.Sprintf("goroutine %d, message %d", i, j))
+				l.Error("error")
+			}
+		}(i)
+	}
+	for i := 1; i <= 5; i++ {
+		l.AddHandler(newHandler(i))
+		_ = l.String()
+	}
+	l.Close()
+	wg.Wait()
+
+	// the messages sent after close are dropped
+	l.Info("after close")
+	if text, _ := os.ReadFile(filepath.Join(dir, "0.log")); len(text) == 0 || strings.Contains(string(text), "after close") {
+		t.Errorf("unexpected log contents (%d bytes)", len(text))
+	}
+}
+
+func TestSeverityRange(t *testing.T) {
+
+	tests := []struct {
+		min, max Severity
+		logged   string
+	}{
+		{Debug, Emergency, "11111111"},
+		{Warning, Error, "00011000"},
+		{Notice, Notice, "00000100"},
+		{Debug, Informational, "00000011"},
+		{Error, Warning, "00000000"},
+	}
+	for _, tt := range tests {
+		h := newLogHandler("%s %s %s\n", Debug)
+		h.SetSeverityRange(tt.min, tt.max)
+		for msg := Emergency; msg <= Debug; msg++ {
+			if want := tt.logged[msg] == '1'; h.accepts(msg) != want {
+				t.Errorf("range %s-%s, message %s: expected %t", tt.min, tt.max, msg, want)
+			}
+		}
+	}
+
+	// only the middle band ends up in the file
+	name := filepath.Join(t.TempDir(), "test.log")
+	f, err := NewFileHandler(name, "%[3]s\n", Debug)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.SetSeverityRange(Warning, Error)
+	f.Start()
+	for msg := Emergency; msg <= Debug; msg++ {
+		f.Send(msg, msg.String())
+	}
+	f.Close()
+	if text, _ := os.ReadFile(name); string(text) != "ERROR\nWARNING\n" {
+		t.Errorf("unexpected log contents %q", text)
+	}
+}
+
+// A formatter creating JSON-like log lines, without the timestamp.
+type testFormatter struct{}
+
+func (testFormatter) Format(sev Severity, t time.Time, msg string) string {
+	return fmt.Sprintf("{%q: %q}\n", sev.String(), msg)
+}
+
+func TestPrintfFormatter(t *testing.T) {
+
+	ts := time.Date(2024, 2, 3, 4, 5, 6, 700000000, time.UTC)
+	tests := []struct {
+		fmt, layout string
+		want        string
+	}{
+		{"%s %s %s\n", "", "2024-02-03 04:05:06 ERROR disk is full\n"},
+		{"[%s] %-8s| %s", "", "[2024-02-03 04:05:06] ERROR   | disk is full"},
+		{"%s %s %s", time.RFC3339Nano, "2024-02-03T04:05:06.7Z ERROR disk is full"},
+		{"%[3]s (%[2]s)", time.Kitchen, "disk is full (ERROR)"},
+	}
+	for _, tt := range tests {
+		p := &PrintfFormatter{Fmt: tt.fmt}
+		p.SetTimestampLayout(tt.layout)
+		if got := p.Format(Error, ts, "disk is full"); got != tt.want {
+			t.Errorf("%q, %q: expected %q, got %q", tt.fmt, tt.layout, tt.want, got)
+		}
+	}
+}
+
+func TestHandlerFormatter(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		setup  func(h *logHandler)
+		want   string
+		layout bool
+	}{
+		{"default", func(h *logHandler) {}, "ERROR: 100% full\n", true},
+		{"format changed", func(h *logHandler) { h.SetFormat("%[2]s - %[3]s\n") }, "ERROR - 100% full\n", true},
+		{"custom formatter", func(h *logHandler) { h.SetFormatter(testFormatter{}) }, "{\"ERROR\": \"100% full\"}\n", false},
+		{"formatter reset", func(h *logHandler) {
+			h.SetFormatter(testFormatter{})
+			h.SetFormatter(nil)
+		}, "ERROR: 100% full\n", true},
+	}
+	for _, tt := range tests {
+		fh, err := NewFileHandler(filepath.Join(t.TempDir(), "test.log"), "%[2]s: %[3]s\n", Debug)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tt.setup(fh.logHandler)
+		if err := fh.SetTimestampLayout(time.RFC3339); (err == nil) != tt.layout {
+			t.Errorf("%s: SetTimestampLayout() returned %v", tt.name, err)
+		}
+		fh.Start()
+		fh.Send(Error, "100% full")
+		fh.Close()
+		if text, _ := os.ReadFile(fh.filename); string(text) != tt.want {
+			t.Errorf("%s: file handler wrote %q, expected %q", tt.name, text, tt.want)
+		}
+
+		// stream handler uses the same formatter, so STDOUT is redirected
+		sh := NewStreamHandler("%[2]s: %[3]s\n", Debug)
+		tt.setup(sh.logHandler)
+		out, err := os.CreateTemp(t.TempDir(), "stdout")
+		if err != nil {
+			t.Fatal(err)
+		}
+		stdout := os.Stdout
+		os.Stdout = out
+		sh.write(Error, "100% full")
+		os.Stdout = stdout
+		out.Close()
+		if text, _ := os.ReadFile(out.Name()); string(text) != tt.want {
+			t.Errorf("%s: stream handler wrote %q, expected %q", tt.name, text, tt.want)
+		}
+	}
+}
+
+func TestHandlerTimestampLayout(t *testing.T) {
+
+	tests := []struct {
+		layout string
+		want   string
+	}{
+		{"", `^\d{4}-\d\d-\d\d \d\d:\d\d:\d\d$`},
+		{time.RFC3339, `^\d{4}-\d\d-\d\dT\d\d:\d\d:\d\d(Z|[+-]\d\d:\d\d)$`},
+		{time.RFC3339Nano, `^\d{4}-\d\d-\d\dT\d\d:\d\d:\d\d(\.\d{1,9})?(Z|[+-]\d\d:\d\d)$`},
+		{"2006-01-02 15:04:05.000", `^\d{4}-\d\d-\d\d \d\d:\d\d:\d\d\.\d{3}$`},
+	}
+	for _, tt := range tests {
+		fh, err := NewFileHandler(filepath.Join(t.TempDir(), "test.log"), "%s|%s|%s\n", Debug)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := fh.SetTimestampLayout(tt.layout); err != nil {
+			t.Fatalf("%q: SetTimestampLayout() failed: %s", tt.layout, err)
+		}
+		fh.Start()
+		fh.Send(Notice, "message")
+		fh.Close()
+
+		text, _ := os.ReadFile(fh.filename)
+		fields := strings.Split(strings.TrimSuffix(string(text), "\n"), "|")
+		if len(fields) != 3 || fields[1] != "NOTICE" || fields[2] != "message" {
+			t.Fatalf("%q: unexpected log line %q", tt.layout, text)
+		}
+		if !regexp.MustCompile(tt.want).MatchString(fields[0]) {
+			t.Errorf("%q: timestamp %q does not match %s", tt.layout, fields[0], tt.want)
+		}
+		layout := tt.layout
+		if layout == "" {
+			layout = TimestampLayout
+		}
+		if _, err := time.Parse(layout, fields[0]); err != nil {
+			t.Errorf("%q: timestamp cannot be parsed: %s", tt.layout, err)
+		}
+	}
+}
+
+func TestNullLog(t *testing.T) {
+
+	tests := []struct {
+		name string
+		log  func() *Log
+		want string
+	}{
+		{"null log", NewNullLog, "NullHandler\n"},
+		{"empty log", NewLog, ""},
+		{"nil handler", func() *Log {
+			l := NewNullLog()
+			l.AddHandler(nil)
+			return l
+		}, "NullHandler\n"},
+	}
+	for _, tt := range tests {
+		l := tt.log()
+		if err := l.Start(); err != nil {
+			t.Errorf("%s: Start() failed: %s", tt.name, err)
+		}
+		l.Debug("debug")
+		l.Info("info")
+		l.Notice("notice")
+		l.Warning("warning")
+		l.Error("error")
+		l.Critical("critical")
+		l.Alert("alert")
+		l.Emergency("emergency")
+		l.LogS("unknown", "message")
+		l.Clear()
+		if got := l.String(); got != tt.want {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.want, got)
+		}
+		l.Close()
+	}
+	var _ LogHandler = NewNullHandler()
+}
+
+func TestFileHandlerNotOpen(t *testing.T) {
+
+	dir := t.TempDir()
+	tests := []struct {
+		name     string
+		filename string
+		open     bool
+	}{
+		{"writable", filepath.Join(dir, "test.log"), true},
+		{"missing directory", filepath.Join(dir, "missing", "test.log"), false},
+		{"directory", dir, false},
+	}
+	for _, tt := range tests {
+		fh, err := NewFileHandler(tt.filename, "%s %s %s\n", Debug)
+		if fh == nil || (err == nil) != tt.open {
+			t.Fatalf("%s: NewFileHandler() returned %v, %v", tt.name, fh, err)
+		}
+		s := fh.String()
+		if strings.Contains(s, "(not open)") == tt.open || strings.Contains(s, "fd=") != tt.open {
+			t.Errorf("%s: unexpected representation %q", tt.name, s)
+		}
+		if err := fh.Start(); (err == nil) != tt.open {
+			t.Errorf("%s: Start() returned %v", tt.name, err)
+		}
+
+		// the handler that is not open discards the messages
+		l := NewLog()
+		l.AddHandler(fh)
+		l.Error("message")
+		fh.write(Error, "message")
+		if !strings.Contains(l.String(), "FileHandler") {
+			t.Errorf("%s: unexpected log representation %q", tt.name, l.String())
+		}
+		fh.Close()
+	}
+}
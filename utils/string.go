@@ -30,7 +30,7 @@ func CopyS(a string) string {
 // As basic as it gets...
 func CopyS(s string) string {
 	a := []byte(s)
-	b := []byte("")
+	b := make([]byte, len(a))
 	copy(b, a)
 	return string(b)
 }
@@ -0,0 +1,19 @@
+package utils
+
+import (
+	"testing"
+	"unsafe"
+)
+
+func TestCopyS(t *testing.T) {
+
+	for _, s := range []string{"hello", "a", "with spaces and ünicode", ""} {
+		c := CopyS(s)
+		if c != s {
+			t.Errorf("expected %q, got %q", s, c)
+		}
+		if len(s) > 0 && unsafe.StringData(c) == unsafe.StringData(s) {
+			t.Errorf("copy of %q shares memory with the original", s)
+		}
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -97,21 +99,106 @@ const (
 	FacLocal5
 	FacLocal6
 	FacLocal7
+	UnknownFacility
 )
 
+// standard facility names, indexed by Facility value
+var facilityNames = []string{"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news", "uucp", "cron",
+	"authpriv", "ftp", "ntp", "audit", "alert", "clock", "local0", "local1", "local2", "local3", "local4", "local5",
+	"local6", "local7"}
+
+// String returns a standard (lowercase) name of the Facility value; "unknown" is returned for invalid values.
+func (f Facility) String() string {
+	if f < 0 || int(f) >= len(facilityNames) {
+		return "unknown"
+	}
+	return facilityNames[f]
+}
+
+// FacilityFromString converts facility given as string (e.g. "local0" or "mail", case-insensitive) into proper Facility
+// value. If invalid string is given, function returns 'UnknownFacility' value.
+func FacilityFromString(fac string) Facility {
+	fac = strings.ToLower(strings.TrimSpace(fac))
+	for ix, name := range facilityNames {
+		if name == fac {
+			return Facility(ix)
+		}
+	}
+	return UnknownFacility
+}
+
 const (
 	// TimestampFmt defines a standard syslog message timestamp format
 	TimestampFmt = "Jan _2 15:04:05"
+	// TimestampFmt5424 defines a RFC5424 syslog message timestamp format (ISO-8601 with microseconds)
+	TimestampFmt5424 = "2006-01-02T15:04:05.000000Z07:00"
 	// SyslogPort defines the standard UDP port for syslog (514)
 	SyslogPort = 514
+	// SyslogTimeout limits the time spent connecting to the syslog server and sending a message over TCP
+	SyslogTimeout = 5 * time.Second
 )
 
+// SyslogProtocol defines the format of the syslog messages.
+type SyslogProtocol int
+
+const (
+	// RFC3164 is the old BSD syslog message format
+	RFC3164 SyslogProtocol = iota
+	// RFC5424 is the new syslog message format
+	RFC5424
+)
+
+// SDElement defines a single RFC5424 structured data element: an ID and a list of key/value parameters.
+type SDElement struct {
+	ID     string
+	Params map[string]string
+}
+
+// String returns a RFC5424-formatted structured data element; parameters are sorted by name.
+func (e SDElement) String() string {
+
+	keys := make([]string, 0, len(e.Params))
+	for k := range e.Params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	// '"', '\' and ']' must be escaped in parameter values
+	esc := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+	s := "[" + e.ID
+	for _, k := range keys {
+		s += fmt.Sprintf(" %s=\"%s\"", k, esc.Replace(e.Params[k]))
+	}
+	return s + "]"
+}
+
 // SyslogMsg defines a syslog message type.
 type SyslogMsg struct {
 	Sev                 Severity
 	Fac                 Facility
 	timestamp, Hostname string
 	Msg                 string
+
+	// message timestamp as time, needed for RFC5424 messages
+	stamp time.Time
+
+	// AppName, ProcID and MsgID are RFC5424 header fields
+	AppName, ProcID, MsgID string
+
+	// StructuredData is a list of RFC5424 structured data elements
+	StructuredData []SDElement
+
+	// Protocol defines the format of the message that is sent
+	Protocol SyslogProtocol
+
+	// Transport defines the transport protocol used to send the message: "udp" (default) or "tcp"
+	Transport string
+
+	// Port is the syslog server port (514 by default)
+	Port int
+
+	// persistent connection to the syslog server (TCP only)
+	conn net.Conn
 }
 
 // Priority returns a value of syslog priority.
@@ -124,7 +211,10 @@ func (s *SyslogMsg) Priority() string {
 func (s *SyslogMsg) TimeStamp() string { return s.timestamp }
 
 // SetTimestamp sets a new timestamp for the syslog message.
-func (s *SyslogMsg) SetTimestamp(stamp time.Time) { s.timestamp = stamp.Format(TimestampFmt) }
+func (s *SyslogMsg) SetTimestamp(stamp time.Time) {
+	s.stamp = stamp
+	s.timestamp = stamp.Format(TimestampFmt)
+}
 
 // SSetTimestamp sets a new timestamp for the syslog message (timestamp is given as a string value).
 func (s *SyslogMsg) SSetTimestamp(stamp string) error {
@@ -137,10 +227,48 @@ func (s *SyslogMsg) SSetTimestamp(stamp string) error {
 	return nil
 }
 
+// AddStructuredData appends a new structured data element with given ID and parameters to the message.
+func (s *SyslogMsg) AddStructuredData(id string, params map[string]string) {
+	s.StructuredData = append(s.StructuredData, SDElement{ID: id, Params: params})
+}
+
 // Get returns the properly formatted syslog message.
 func (s *SyslogMsg) Get() string { return fmt.Sprintf("%s%s %s %s", s.Priority(), s.timestamp, s.Hostname, s.Msg) }
 
+// GetRFC5424 returns the syslog message formatted according to RFC5424:
+// "<pri>1 timestamp hostname app-name procid msgid structured-data msg". Empty header fields are replaced by "-".
+func (s *SyslogMsg) GetRFC5424() string {
+
+	nilval := func(v string) string {
+		if v == "" {
+			return "-"
+		}
+		return v
+	}
+
+	stamp := "-"
+	if !s.stamp.IsZero() {
+		stamp = s.stamp.Format(TimestampFmt5424)
+	}
+	sd := ""
+	for _, e := range s.StructuredData {
+		sd += e.String()
+	}
+	return fmt.Sprintf("%s1 %s %s %s %s %s %s %s", s.Priority(), stamp, nilval(s.Hostname), nilval(s.AppName),
+		nilval(s.ProcID), nilval(s.MsgID), nilval(sd), s.Msg)
+}
+
+// Private method that returns the message formatted according to the selected protocol.
+func (s *SyslogMsg) format() string {
+	if s.Protocol == RFC5424 {
+		return s.GetRFC5424()
+	}
+	return s.Get()
+}
+
 // Send sends the syslog message to given IP address.
+// Messages are sent over UDP by default. When TCP transport is selected, the messages are framed using octet counting
+// (RFC6587) and the connection is kept open across messages; use Disconnect() to close it.
 func (s *SyslogMsg) Send(ip string) error {
 
 	//var addr net.IP
@@ -148,17 +276,54 @@ func (s *SyslogMsg) Send(ip string) error {
 	if ip != "" {
 		s.Hostname = ip
 	}
+
+	if s.Transport == "tcp" {
+		return s.sendTCP()
+	}
 	addr := net.ParseIP(s.Hostname)
 
 	// let's make an UDP connection and send the message
-	conn, err := net.DialUDP("udp", nil, &net.UDPAddr{addr, SyslogPort, ""})
+	conn, err := net.DialUDP("udp", nil, &net.UDPAddr{IP: addr, Port: s.Port})
 	if err != nil {
 		return err
 	}
 	defer conn.Close()
-	fmt.Fprintf(conn, s.Get())
+
+	// message may contain '%', so it must not be used as a format string; terminate the message with a newline
+	_, err = fmt.Fprint(conn, s.format()+"\n")
+	return err
+}
+
+// Send the message over the (persistent) TCP connection using the octet-counting framing: "<length> <message>".
+func (s *SyslogMsg) sendTCP() error {
+
+	if s.conn == nil {
+		conn, err := net.DialTimeout("tcp", net.JoinHostPort(s.Hostname, strconv.Itoa(s.Port)), SyslogTimeout)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+
+	msg := s.format()
+	s.conn.SetWriteDeadline(time.Now().Add(SyslogTimeout))
+	if _, err := fmt.Fprintf(s.conn, "%d %s", len(msg), msg); err != nil {
+		// the connection is broken, it will be re-established with the next message
+		s.Disconnect()
+		return err
+	}
 	return nil
 }
 
+// Disconnect closes the persistent (TCP) connection to the syslog server, if there is one.
+func (s *SyslogMsg) Disconnect() {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
+
 // NewSyslogMsg creates new syslog message with default fields.
-func NewSyslogMsg() *SyslogMsg { return &SyslogMsg{Informational, FacLocal0, "", "", ""} }
+func NewSyslogMsg() *SyslogMsg {
+	return &SyslogMsg{Sev: Informational, Fac: FacLocal0, Protocol: RFC3164, Transport: "udp", Port: SyslogPort}
+}
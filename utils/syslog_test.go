@@ -0,0 +1,436 @@
+package utils
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC5424 message: HEADER SP STRUCTURED-DATA [SP MSG], HEADER = PRI VERSION SP TIMESTAMP SP HOSTNAME SP APP-NAME SP
+// PROCID SP MSGID
+var rfc5424 = regexp.MustCompile(`^<(\d{1,3})>1 (-|\S+) ([!-~]{1,255}) ([!-~]{1,48}) ([!-~]{1,128}) ([!-~]{1,32}) ` +
+	`(-|(?:\[[^ =\]"]{1,32}(?: [^ =\]"]{1,32}="(?:[^"\\\]]|\\["\\\]])*")*\])+) (.*)$`)
+
+func TestSyslogMsgRFC5424(t *testing.T) {
+
+	stamp := time.Date(2024, 3, 1, 12, 30, 45, 123456000, time.UTC)
+	tests := []struct {
+		modify func(m *SyslogMsg)
+		pri    string
+		sd     string
+	}{
+		{func(m *SyslogMsg) {}, "<134>", "-"},
+		{func(m *SyslogMsg) { m.Sev, m.Fac = Error, FacKernel }, "<3>", "-"},
+		{func(m *SyslogMsg) { m.AppName, m.ProcID, m.MsgID = "atf", "42", "TEST" }, "<134>", "-"},
+		{func(m *SyslogMsg) {
+			m.AddStructuredData("test@32473", map[string]string{"set": "Smoke", "case": `a "quoted] \ name`})
+			m.AddStructuredData("meta", nil)
+		}, "<134>", `[test@32473 case="a \"quoted\] \\ name" set="Smoke"][meta]`},
+	}
+	for _, tt := range tests {
+		m := NewSyslogMsg()
+		m.Hostname, m.Msg = "10.0.0.1", "message text %s"
+		m.SetTimestamp(stamp)
+		tt.modify(m)
+
+		msg := m.GetRFC5424()
+		parts := rfc5424.FindStringSubmatch(msg)
+		if parts == nil {
+			t.Errorf("message does not match the RFC5424 grammar: %q", msg)
+			continue
+		}
+		if "<"+parts[1]+">" != tt.pri || parts[7] != tt.sd || parts[8] != m.Msg {
+			t.Errorf("unexpected priority, structured data or message: %q", msg)
+		}
+		if ts, err := time.Parse(time.RFC3339Nano, parts[2]); err != nil || !ts.Equal(stamp) {
+			t.Errorf("invalid timestamp %q: %v", parts[2], err)
+		}
+	}
+
+	// empty header fields are replaced by NILVALUE
+	if msg := (&SyslogMsg{Sev: Debug, Msg: "text"}).GetRFC5424(); msg != "<7>1 - - - - - - text" {
+		t.Errorf("unexpected message with empty fields: %q", msg)
+	}
+}
+
+// Parse the octet-counted (RFC6587) frames from the given data.
+func parseFrames(t *testing.T, data []byte) []string {
+
+	t.Helper()
+	var frames []string
+	for len(data) > 0 {
+		sp := bytes.IndexByte(data, ' ')
+		if sp < 0 {
+			t.Fatalf("frame without length: %q", data)
+		}
+		n, err := strconv.Atoi(string(data[:sp]))
+		if err != nil || sp+1+n > len(data) {
+			t.Fatalf("invalid frame length %q", data[:sp])
+		}
+		frames = append(frames, string(data[sp+1:sp+1+n]))
+		data = data[sp+1+n:]
+	}
+	return frames
+}
+
+func TestSyslogHandlerTCP(t *testing.T) {
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	// collect the data of all the accepted connections
+	type result struct {
+		conns int
+		data  []byte
+	}
+	received := make(chan result)
+	go func() {
+		var r result
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				break
+			}
+			r.conns++
+			data, _ := io.ReadAll(conn)
+			r.data = append(r.data, data...)
+			conn.Close()
+			ln.Close()
+		}
+		received <- r
+	}()
+
+	h, err := NewSyslogHandlerTCP("127.0.0.1", "%s %s %s", Debug)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Port = ln.Addr().(*net.TCPAddr).Port
+	h.Start()
+	msgs := []string{"first", "multi\nline", "100% sure %s"}
+	for _, m := range msgs {
+		h.Send(Error, m)
+	}
+	h.Close()
+
+	r := <-received
+	if r.conns != 1 {
+		t.Errorf("expected a single connection, got %d", r.conns)
+	}
+	frames := parseFrames(t, r.data)
+	if len(frames) != len(msgs) {
+		t.Fatalf("expected %d frames, got %q", len(msgs), frames)
+	}
+	for ix, f := range frames {
+		if !strings.HasPrefix(f, "<131>") || !strings.HasSuffix(f, " ERROR "+msgs[ix]) {
+			t.Errorf("unexpected frame %q", f)
+		}
+	}
+}
+
+// Create a local UDP listener on an arbitrary port; the listener is closed when the test finishes.
+func listenUDP(t *testing.T) *net.UDPConn {
+
+	t.Helper()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+func TestSyslogHandlerPort(t *testing.T) {
+
+	if h, _ := NewSyslogHandler("127.0.0.1", "%s %s %s", Debug); h.Port != SyslogPort {
+		t.Errorf("expected default port %d, got %d", SyslogPort, h.Port)
+	}
+	if _, err := NewSyslogHandlerPort("localhost", 1514, "%s %s %s", Debug); err == nil {
+		t.Error("expected error for invalid server IP address")
+	}
+
+	conn := listenUDP(t)
+	h, err := NewSyslogHandlerPort("127.0.0.1", conn.LocalAddr().(*net.UDPAddr).Port, "%s %s %s", Debug)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Start()
+	h.Send(Warning, "hello")
+	h.Close()
+
+	buf := make([]byte, 1024)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("no message received: %s", err)
+	}
+	if msg := string(buf[:n]); !strings.HasPrefix(msg, "<132>") || !strings.Contains(msg, "WARNING hello") {
+		t.Errorf("unexpected message %q", msg)
+	}
+}
+
+func TestSyslogMsgSend(t *testing.T) {
+
+	tests := []struct {
+		protocol SyslogProtocol
+		msg      string
+	}{
+		{RFC3164, "plain message"},
+		{RFC3164, "100% sure: %s %d %v"},
+		{RFC5424, "100% sure: %s %d %v"},
+	}
+	conn := listenUDP(t)
+	for _, tt := range tests {
+		m := NewSyslogMsg()
+		m.Port, m.Protocol, m.Msg = conn.LocalAddr().(*net.UDPAddr).Port, tt.protocol, tt.msg
+		m.SetTimestamp(time.Now())
+		if err := m.Send("127.0.0.1"); err != nil {
+			t.Fatalf("Send() failed: %s", err)
+		}
+
+		buf := make([]byte, 1024)
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatalf("no message received: %s", err)
+		}
+		if want := m.format() + "\n"; string(buf[:n]) != want {
+			t.Errorf("expected %q on wire, got %q", want, buf[:n])
+		}
+		if !strings.HasSuffix(string(buf[:n]), " "+tt.msg+"\n") {
+			t.Errorf("message is not transmitted verbatim: %q", buf[:n])
+		}
+	}
+}
+
+func TestFacilityFromString(t *testing.T) {
+
+	tests := []struct {
+		name string
+		fac  Facility
+	}{
+		{"local0", FacLocal0},
+		{"local1", FacLocal1},
+		{"local2", FacLocal2},
+		{"local3", FacLocal3},
+		{"local4", FacLocal4},
+		{"local5", FacLocal5},
+		{"local6", FacLocal6},
+		{"local7", FacLocal7},
+		{"LOCAL5", FacLocal5},
+		{" Mail ", FacMail},
+		{"kern", FacKernel},
+		{"local8", UnknownFacility},
+		{"unknown", UnknownFacility},
+		{"", UnknownFacility},
+	}
+	for _, tt := range tests {
+		if got := FacilityFromString(tt.name); got != tt.fac {
+			t.Errorf("FacilityFromString(%q) = %d, want %d", tt.name, got, tt.fac)
+		}
+	}
+
+	// every valid facility is converted to its name and back
+	for fac := FacKernel; fac < UnknownFacility; fac++ {
+		if got := FacilityFromString(fac.String()); got != fac {
+			t.Errorf("facility %d: %q is converted to %d", fac, fac.String(), got)
+		}
+	}
+	for _, fac := range []Facility{UnknownFacility, -1, 100} {
+		if got := fac.String(); got != "unknown" {
+			t.Errorf("facility %d: expected \"unknown\", got %q", fac, got)
+		}
+	}
+}
+
+func TestSyslogHandlerFacility(t *testing.T) {
+
+	tests := []struct {
+		name string
+		pri  string
+		err  bool
+	}{
+		{"local7", "<188>", false},
+		{"mail", "<20>", false},
+		{"local8", "<132>", true},
+	}
+	for _, tt := range tests {
+		conn := listenUDP(t)
+		h, err := NewSyslogHandlerPort("127.0.0.1", conn.LocalAddr().(*net.UDPAddr).Port, "%s %s %s", Debug)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := h.SetFacility(tt.name); (err != nil) != tt.err {
+			t.Errorf("%s: SetFacility() returned %v", tt.name, err)
+		}
+		h.Start()
+		h.Send(Warning, "hello")
+		h.Close()
+
+		buf := make([]byte, 1024)
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatalf("%s: no message received: %s", tt.name, err)
+		}
+		if msg := string(buf[:n]); !strings.HasPrefix(msg, tt.pri) {
+			t.Errorf("%s: expected priority %s, got message %q", tt.name, tt.pri, msg)
+		}
+	}
+}
+
+// Return a local TCP port with nothing listening on it.
+func closedTCPPort(t *testing.T) int {
+
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+	return port
+}
+
+func TestSyslogHandlerBackoff(t *testing.T) {
+
+	h, err := NewSyslogHandlerTCP("127.0.0.1", "%s %s %s", Debug)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fallback bytes.Buffer
+	h.Port, h.Fallback, h.RetryDelay = closedTCPPort(t), &fallback, 10*time.Millisecond
+
+	// the delay doubles with every retry: 10ms, 20ms, 40ms...
+	tests := []struct {
+		retries int
+		wait    time.Duration
+	}{
+		{0, 0},
+		{1, 10 * time.Millisecond},
+		{3, 70 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		fallback.Reset()
+		h.Retries = tt.retries
+		start := time.Now()
+		if err := h.write(Error, "message"); err == nil {
+			t.Fatalf("%d retries: delivery to closed port succeeded", tt.retries)
+		}
+		if elapsed := time.Since(start); elapsed < tt.wait || elapsed > tt.wait+2*time.Second {
+			t.Errorf("%d retries: expected to wait for %s, got %s", tt.retries, tt.wait, elapsed)
+		}
+		// the undelivered message is written to the fallback only once, after all the retries
+		if got := fallback.String(); strings.Count(got, "ERROR message") != 1 || !strings.Contains(got, "refused") {
+			t.Errorf("%d retries: unexpected fallback %q", tt.retries, got)
+		}
+	}
+
+	// messages filtered by severity are neither sent nor written to fallback
+	h.SetSeverity(Error)
+	fallback.Reset()
+	if err := h.write(Informational, "filtered"); err != nil || fallback.Len() != 0 {
+		t.Errorf("filtered message has been processed: %v, %q", err, fallback.String())
+	}
+}
+
+func TestSyslogHandlerLateListener(t *testing.T) {
+
+	port := closedTCPPort(t)
+	h, err := NewSyslogHandlerTCP("127.0.0.1", "%s %s %s", Debug)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fallback bytes.Buffer
+	h.Port, h.Fallback, h.RetryDelay, h.Retries = port, &fallback, 20*time.Millisecond, 6
+	h.Start()
+	h.Send(Error, "first")
+	time.Sleep(50 * time.Millisecond)
+
+	// the server is brought up late, while the first message is being retried: all the messages are delivered
+	ln, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		t.Skipf("cannot listen on port %d: %s", port, err)
+	}
+	defer ln.Close()
+	received := make(chan []byte)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			close(received)
+			return
+		}
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		data, _ := io.ReadAll(conn)
+		received <- data
+	}()
+	for ix := 0; ix < 10; ix++ {
+		h.Send(Error, "message "+strconv.Itoa(ix))
+	}
+	h.Close()
+
+	frames := parseFrames(t, <-received)
+	if len(frames) != 11 {
+		t.Fatalf("expected 11 delivered messages, got %d: %q", len(frames), frames)
+	}
+	if !strings.HasSuffix(frames[0], "ERROR first") {
+		t.Errorf("expected the first failed message to be delivered, got %q", frames[0])
+	}
+	if last := frames[len(frames)-1]; !strings.HasSuffix(last, "ERROR message 9") {
+		t.Errorf("expected the last message to be delivered, got %q", last)
+	}
+	if fallback.Len() != 0 {
+		t.Errorf("delivered message has been written to fallback: %q", fallback.String())
+	}
+}
+
+func TestNewSyslogHandler(t *testing.T) {
+
+	constructors := []struct {
+		name      string
+		new       func(ip string) (*SyslogHandler, error)
+		port      int
+		transport string
+	}{
+		{"UDP", func(ip string) (*SyslogHandler, error) { return NewSyslogHandler(ip, "%s %s %s", Debug) }, SyslogPort, "udp"},
+		{"port", func(ip string) (*SyslogHandler, error) { return NewSyslogHandlerPort(ip, 1514, "%s %s %s", Debug) }, 1514, "udp"},
+		{"TCP", func(ip string) (*SyslogHandler, error) { return NewSyslogHandlerTCP(ip, "%s %s %s", Debug) }, SyslogPort, "tcp"},
+	}
+	tests := []struct {
+		ip    string
+		valid bool
+	}{
+		{"127.0.0.1", true},
+		{"192.168.100.254", true},
+		{"::1", true},
+		{"fe80::1", true},
+		{"", false},
+		{"localhost", false},
+		{"256.1.1.1", false},
+		{"10.0.0", false},
+		{"10.0.0.1:514", false},
+	}
+	for _, c := range constructors {
+		for _, tt := range tests {
+			h, err := c.new(tt.ip)
+			if (err == nil) != tt.valid {
+				t.Errorf("%s, %q: unexpected error %v", c.name, tt.ip, err)
+				continue
+			}
+			if !tt.valid {
+				if h != nil || !strings.Contains(err.Error(), tt.ip) {
+					t.Errorf("%s, %q: unexpected result %v, %v", c.name, tt.ip, h, err)
+				}
+				continue
+			}
+			if h.IP != tt.ip || h.Port != c.port || h.Transport != c.transport {
+				t.Errorf("%s, %q: unexpected handler %q, %d, %q", c.name, tt.ip, h.IP, h.Port, h.Transport)
+			}
+		}
+	}
+}
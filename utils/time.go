@@ -14,13 +14,20 @@ import (
 	"time"
 )
 
-// Now returns current timestamp as a string with the following format: "2006-01-02 15:04:05".
+// TimestampLayout is the default layout used by Now(); it can be changed globally (to time.RFC3339, for instance).
+var TimestampLayout = "2006-01-02 15:04:05"
+
+// Now returns current timestamp as a string formatted with the default layout (see TimestampLayout); by default, the
+// format is: "2006-01-02 15:04:05".
 func Now() string {
 	//	t := time.Now()
 	//	return t.Format("2006-01-02 15:04:05")
-	return time.Now().Format("2006-01-02 15:04:05")
+	return NowFormat(TimestampLayout)
 }
 
+// NowFormat returns current timestamp as a string formatted with the given layout.
+func NowFormat(layout string) string { return time.Now().Format(layout) }
+
 // NowFile returns current timestamp as a string with the following format: "2006_01_02_15_04_05".
 // Usually used as an extension for filenames so that existing files are not overwritten.
 func NowFile() string {
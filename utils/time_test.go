@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNowFormat(t *testing.T) {
+
+	tests := []struct {
+		layout string
+		global bool
+	}{
+		{"2006-01-02 15:04:05", false},
+		{time.RFC3339, false},
+		{time.RFC3339, true},
+		{"02.01.2006 15:04", true},
+	}
+	defer func(layout string) { TimestampLayout = layout }(TimestampLayout)
+	for _, tt := range tests {
+		before := time.Now().Truncate(time.Minute)
+		var s string
+		if tt.global {
+			TimestampLayout = tt.layout
+			s = Now()
+		} else {
+			s = NowFormat(tt.layout)
+		}
+		stamp, err := time.ParseInLocation(tt.layout, s, time.Local)
+		if err != nil || stamp.Before(before) || stamp.After(time.Now()) {
+			t.Errorf("%s: unexpected timestamp %q (%v)", tt.layout, s, err)
+		}
+	}
+}
+
+func TestNowDefault(t *testing.T) {
+	if _, err := time.Parse("2006-01-02 15:04:05", Now()); err != nil {
+		t.Errorf("unexpected default timestamp format: %s", err)
+	}
+}